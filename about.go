@@ -0,0 +1,80 @@
+package main
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// About describes the running Hera instance and its environment to make debugging easier
+type About struct {
+	Version            string            `json:"version"`
+	Platform           string            `json:"platform"`
+	CloudflaredVersion string            `json:"cloudflared_version"`
+	DockerVersion      string            `json:"docker_version"`
+	DockerAPIVersion   string            `json:"docker_api_version"`
+	Certificates       []string          `json:"certificates"`
+	Modes              []string          `json:"modes"`
+	Config             map[string]string `json:"config"`
+}
+
+// DetectAbout inspects the environment Hera is running in. Details that cannot be detected are left as "unknown".
+func DetectAbout(client *Client, commander Commander, fs afero.Fs) *About {
+	about := &About{
+		Version:            CurrentVersion,
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		CloudflaredVersion: "unknown",
+		DockerVersion:      "unknown",
+		DockerAPIVersion:   "unknown",
+		Certificates:       []string{},
+		Modes:              []string{"legacy"},
+		Config:             config.Summary(),
+	}
+
+	out, err := commander.Run("cloudflared", "--version")
+	if err == nil {
+		about.CloudflaredVersion = strings.TrimPrefix(strings.TrimSpace(string(out)), "cloudflared version ")
+	}
+
+	if client != nil {
+		version, err := client.Version()
+		if err == nil {
+			about.DockerVersion = version.Version
+			about.DockerAPIVersion = version.APIVersion
+		}
+	}
+
+	certs, err := FindAllCertificates(fs)
+	if err == nil {
+		for _, cert := range certs {
+			about.Certificates = append(about.Certificates, strings.TrimSuffix(cert.Name, ".pem"))
+		}
+	}
+
+	if config.ProxyDNS {
+		about.Modes = append(about.Modes, "proxy-dns")
+	}
+
+	return about
+}
+
+// Log writes the startup banner
+func (a *About) Log() {
+	log.Infof("Hera v%s has started on %s", a.Version, a.Platform)
+	log.Infof("cloudflared %s, Docker %s (API %s)", a.CloudflaredVersion, a.DockerVersion, a.DockerAPIVersion)
+	log.Infof("Modes: %s", strings.Join(a.Modes, ", "))
+
+	if len(a.Certificates) > 0 {
+		log.Infof("Certificate domains: %s", strings.Join(a.Certificates, ", "))
+	}
+
+	var settings []string
+	for name, value := range a.Config {
+		settings = append(settings, name+"="+value)
+	}
+	sort.Strings(settings)
+
+	log.Infof("Configuration: %s", strings.Join(settings, " "))
+}
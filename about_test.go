@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestDetectAbout(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	fs.Create("/certs/mysite.com.pem")
+	fs.Create("/certs/other.net.pem")
+
+	commander := &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte("cloudflared version 2020.5.1 (built 2020-05-07-0000 UTC)\n"), nil
+		},
+	}
+
+	about := DetectAbout(nil, commander, fs)
+
+	if about.CloudflaredVersion != "2020.5.1 (built 2020-05-07-0000 UTC)" {
+		t.Errorf("Unexpected cloudflared version, got %s", about.CloudflaredVersion)
+	}
+
+	if about.DockerVersion != "unknown" {
+		t.Errorf("Unexpected Docker version, got %s", about.DockerVersion)
+	}
+
+	if len(about.Certificates) != 2 || about.Certificates[0] != "mysite.com" {
+		t.Errorf("Unexpected certificates, got %v", about.Certificates)
+	}
+
+	if about.Config["HERA_DEFAULT_PROTOCOL"] != "http" {
+		t.Errorf("Unexpected config, got %v", about.Config)
+	}
+}
+
+func TestDetectAboutWithoutCloudflared(t *testing.T) {
+	commander := &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return nil, errors.New("not found")
+		},
+	}
+
+	about := DetectAbout(nil, commander, afero.NewMemMapFs())
+
+	if about.CloudflaredVersion != "unknown" {
+		t.Errorf("Unexpected cloudflared version, got %s", about.CloudflaredVersion)
+	}
+
+	if len(about.Certificates) != 0 {
+		t.Errorf("Unexpected certificates, got %v", about.Certificates)
+	}
+}
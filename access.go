@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/afero"
+)
+
+const (
+	heraAccessServiceToken = "hera.access-service-token"
+	heraAccessCreateToken  = "hera.access-create-token"
+
+	AccessTokenPath = "/var/run/hera/access"
+)
+
+// ServiceToken is a Cloudflare Access service token. The client secret is only known when the token
+// is created.
+type ServiceToken struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AccessApp is a Cloudflare Access application protecting a hostname
+type AccessApp struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+}
+
+// AccessPolicy is a policy of an Access application
+type AccessPolicy struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// configureAccess locks the hostname to the service token named by the container's hera.access-service-token
+// label. An error is returned if the hostname cannot be protected, so the tunnel is not exposed without it.
+func configureAccess(container types.ContainerJSON, hostname string) error {
+	name := getLabel(heraAccessServiceToken, container)
+	if name == "" {
+		return nil
+	}
+
+	if cloudflare == nil || cloudflare.AccountID == "" {
+		return fmt.Errorf("%s requires HERA_CLOUDFLARE_API_TOKEN and HERA_CLOUDFLARE_ACCOUNT_ID", heraAccessServiceToken)
+	}
+
+	create := getLabel(heraAccessCreateToken, container) == "true"
+
+	return cloudflare.ProtectWithServiceToken(hostname, name, create, fs)
+}
+
+// ProtectWithServiceToken creates an Access application for the hostname, unless one exists, that only
+// allows requests authenticated with the named service token. The token is created if it doesn't exist
+// and create is set, and its credentials are written to AccessTokenPath.
+func (c *CloudflareClient) ProtectWithServiceToken(hostname string, name string, create bool, fs afero.Fs) error {
+	token, err := c.findServiceToken(name)
+	if err != nil {
+		return err
+	}
+
+	if token == nil {
+		if !create {
+			return fmt.Errorf("Access service token %s does not exist, set %s=true to create it", name, heraAccessCreateToken)
+		}
+
+		token, err = c.createServiceToken(name, fs)
+		if err != nil {
+			return err
+		}
+	}
+
+	app, err := c.findAccessApp(hostname)
+	if err != nil {
+		return err
+	}
+
+	if app == nil {
+		log.Infof("Creating Access application for %s", hostname)
+
+		app = &AccessApp{}
+		body := map[string]string{"name": hostname, "domain": hostname, "type": "self_hosted"}
+
+		err = c.request("POST", c.accountPath("/access/apps"), body, app)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.ensureServiceTokenPolicy(app, token)
+}
+
+// findServiceToken returns the service token with the name, or nil if there is none
+func (c *CloudflareClient) findServiceToken(name string) (*ServiceToken, error) {
+	var tokens []*ServiceToken
+
+	err := c.request("GET", c.accountPath("/access/service_tokens?per_page=1000"), nil, &tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, token := range tokens {
+		if token.Name == name {
+			return token, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// createServiceToken creates a service token and writes its credentials to AccessTokenPath, since
+// the client secret cannot be retrieved later. The file is encrypted when HERA_PASSPHRASE is set.
+func (c *CloudflareClient) createServiceToken(name string, fs afero.Fs) (*ServiceToken, error) {
+	log.Infof("Creating Access service token %s", name)
+
+	token := &ServiceToken{}
+
+	err := c.request("POST", c.accountPath("/access/service_tokens"), map[string]string{"name": name}, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.MkdirAll(AccessTokenPath, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Passphrase != "" {
+		contents, err = Encrypt(contents, config.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(AccessTokenPath, name+".json")
+
+	err = afero.WriteFile(fs, path, contents, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Saved the credentials of Access service token %s to %s", name, path)
+
+	return token, nil
+}
+
+// findAccessApp returns the Access application for the hostname, or nil if there is none
+func (c *CloudflareClient) findAccessApp(hostname string) (*AccessApp, error) {
+	var apps []*AccessApp
+
+	err := c.request("GET", c.accountPath("/access/apps?per_page=1000"), nil, &apps)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, app := range apps {
+		if app.Domain == hostname {
+			return app, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ensureServiceTokenPolicy adds a policy allowing the service token to the application unless it
+// already has one
+func (c *CloudflareClient) ensureServiceTokenPolicy(app *AccessApp, token *ServiceToken) error {
+	name := "Hera service token " + token.Name
+
+	var policies []*AccessPolicy
+
+	err := c.request("GET", c.accountPath(fmt.Sprintf("/access/apps/%s/policies", app.ID)), nil, &policies)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if policy.Name == name {
+			return nil
+		}
+	}
+
+	log.Infof("Allowing Access service token %s for %s", token.Name, app.Domain)
+
+	body := map[string]interface{}{
+		"name":       name,
+		"decision":   "non_identity",
+		"precedence": 1,
+		"include": []interface{}{
+			map[string]interface{}{"service_token": map[string]string{"token_id": token.ID}},
+		},
+	}
+
+	return c.request("POST", c.accountPath(fmt.Sprintf("/access/apps/%s/policies", app.ID)), body, nil)
+}
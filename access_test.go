@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func newCloudflareServer(t *testing.T, created *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`))
+			return
+		}
+
+		route := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/accounts/account")
+
+		switch route {
+		case "GET /access/service_tokens", "GET /access/apps", "GET /access/apps/app/policies":
+			w.Write([]byte(`{"success": true, "result": []}`))
+
+		case "POST /access/service_tokens":
+			*created = append(*created, "token")
+			w.Write([]byte(`{"success": true, "result": {"id": "token", "name": "api", "client_id": "id.access", "client_secret": "secret"}}`))
+
+		case "POST /access/apps":
+			*created = append(*created, "app")
+			w.Write([]byte(`{"success": true, "result": {"id": "app", "name": "api.example.com", "domain": "api.example.com"}}`))
+
+		case "POST /access/apps/app/policies":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+
+			*created = append(*created, "policy:"+body["decision"].(string))
+			w.Write([]byte(`{"success": true, "result": {"id": "policy"}}`))
+
+		default:
+			t.Errorf("Unexpected request %s", route)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestProtectWithServiceToken(t *testing.T) {
+	var created []string
+	server := newCloudflareServer(t, &created)
+	defer server.Close()
+
+	client := NewCloudflareClient("token", "account")
+	client.BaseURL = server.URL
+	fs := afero.NewMemMapFs()
+
+	err := client.ProtectWithServiceToken("api.example.com", "api", false, fs)
+	if err == nil {
+		t.Error("Expected error for a missing token that may not be created")
+	}
+
+	err = client.ProtectWithServiceToken("api.example.com", "api", true, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(created, ",") != "token,app,policy:non_identity" {
+		t.Errorf("Unexpected resources created, got %v", created)
+	}
+
+	contents, _ := afero.ReadFile(fs, "/var/run/hera/access/api.json")
+	if !strings.Contains(string(contents), `"client_secret": "secret"`) {
+		t.Errorf("Expected the token credentials to be saved, got %s", contents)
+	}
+}
+
+func TestCreateServiceTokenEncrypted(t *testing.T) {
+	var created []string
+	server := newCloudflareServer(t, &created)
+	defer server.Close()
+
+	config.Passphrase = "correct horse"
+	defer func() { config.Passphrase = "" }()
+
+	client := NewCloudflareClient("token", "account")
+	client.BaseURL = server.URL
+	fs := afero.NewMemMapFs()
+
+	_, err := client.createServiceToken("api", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _ := afero.ReadFile(fs, "/var/run/hera/access/api.json")
+	if !IsEncrypted(contents) || strings.Contains(string(contents), "secret") {
+		t.Fatalf("Expected the token credentials to be encrypted, got %s", contents)
+	}
+
+	plain, err := Decrypt(contents, "correct horse")
+	if err != nil || !strings.Contains(string(plain), `"client_secret": "secret"`) {
+		t.Errorf("Expected the credentials to decrypt, got %s: %v", plain, err)
+	}
+}
+
+func TestCloudflareRequestError(t *testing.T) {
+	var created []string
+	server := newCloudflareServer(t, &created)
+	defer server.Close()
+
+	client := NewCloudflareClient("wrong", "account")
+	client.BaseURL = server.URL
+
+	_, err := client.findServiceToken("api")
+	if err == nil || !strings.Contains(err.Error(), "Authentication error (10000)") {
+		t.Errorf("Expected authentication error, got %v", err)
+	}
+}
+
+func TestConfigureAccessRequiresClient(t *testing.T) {
+	cloudflare = nil
+
+	container := newTenantContainer(map[string]string{heraAccessServiceToken: "api"})
+	if err := configureAccess(container, "api.example.com"); err == nil {
+		t.Error("Expected error without a Cloudflare API token")
+	}
+
+	if err := configureAccess(newTenantContainer(map[string]string{}), "api.example.com"); err != nil {
+		t.Errorf("Expected no error without the label, got %s", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	defaultAdHocTTL = time.Hour
+)
+
+// AdHocRequest is a request to expose an arbitrary origin through a temporary tunnel
+type AdHocRequest struct {
+	Hostname string `json:"hostname"`
+	Origin   string `json:"origin"`
+	Protocol string `json:"protocol,omitempty"`
+	TTL      string `json:"ttl,omitempty"`
+}
+
+// StartAdHocTunnel starts a tunnel from the hostname of the request to its host:port origin, which is
+// torn down once its TTL has passed. The hostname must be allowed and have a certificate, like the
+// hostname of a container. It must be called from the event loop.
+func (h *Handler) StartAdHocTunnel(request AdHocRequest) (*Tunnel, error) {
+	if !config.AdHocTunnels {
+		return nil, fmt.Errorf("On-demand tunnels are disabled, set HERA_ADHOC_TUNNELS=true to enable them")
+	}
+
+	if request.Hostname == "" {
+		return nil, fmt.Errorf("No hostname given")
+	}
+
+	if _, _, err := net.SplitHostPort(request.Origin); err != nil {
+		return nil, fmt.Errorf("Invalid origin %s, expected host:port", request.Origin)
+	}
+
+	protocol := request.Protocol
+	if protocol == "" {
+		protocol = config.DefaultProtocol
+	}
+
+	ttl, err := parseAdHocTTL(request.TTL, config.AdHocMaxTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := registry.FindByHostname(request.Hostname); err == nil {
+		return nil, fmt.Errorf("A tunnel for %s already exists", request.Hostname)
+	}
+
+	tunnel, err := newStaticTunnel(IngressRule{Hostname: request.Hostname, Service: protocol + "://" + request.Origin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.resolveOrigin(tunnel.Config)
+	if err != nil {
+		return nil, NewError(ErrUnresolvableOrigin, err)
+	}
+
+	tunnel.ExpiresAt = time.Now().Add(ttl)
+
+	log.Infof("Starting on-demand tunnel %s to %s until %s", request.Hostname, request.Origin, tunnel.ExpiresAt.Format(time.RFC3339))
+
+	err = tunnel.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return tunnel, nil
+}
+
+// parseAdHocTTL returns the TTL of an on-demand tunnel, which defaults to an hour and may not exceed limit
+func parseAdHocTTL(value string, limit time.Duration) (time.Duration, error) {
+	ttl := defaultAdHocTTL
+
+	if value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("Invalid TTL: %s", value)
+		}
+
+		ttl = parsed
+	}
+
+	if limit > 0 && ttl > limit {
+		return 0, fmt.Errorf("TTL %s exceeds the maximum of %s", ttl, limit)
+	}
+
+	return ttl, nil
+}
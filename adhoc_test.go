@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAdHocTTL(t *testing.T) {
+	ttl, err := parseAdHocTTL("", 0)
+	if err != nil || ttl != time.Hour {
+		t.Errorf("Expected default TTL of an hour, got %s (%v)", ttl, err)
+	}
+
+	ttl, err = parseAdHocTTL("30m", time.Hour)
+	if err != nil || ttl != 30*time.Minute {
+		t.Errorf("Unexpected TTL, got %s (%v)", ttl, err)
+	}
+
+	for _, value := range []string{"2h", "soon", "-1m"} {
+		if _, err := parseAdHocTTL(value, time.Hour); err == nil {
+			t.Errorf("Expected error for %s", value)
+		}
+	}
+}
+
+func TestStartAdHocTunnelValidation(t *testing.T) {
+	handler := &Handler{}
+
+	if _, err := handler.StartAdHocTunnel(AdHocRequest{Hostname: "debug.site.tld", Origin: "10.0.0.5:8080"}); err == nil {
+		t.Error("Expected error while on-demand tunnels are disabled")
+	}
+
+	config.AdHocTunnels = true
+	defer func() { config.AdHocTunnels = false }()
+
+	invalid := []AdHocRequest{
+		{Origin: "10.0.0.5:8080"},
+		{Hostname: "debug.site.tld", Origin: "10.0.0.5"},
+		{Hostname: "debug.site.tld", Origin: "10.0.0.5:8080", TTL: "forever"},
+	}
+
+	for _, request := range invalid {
+		if _, err := handler.StartAdHocTunnel(request); err == nil {
+			t.Errorf("Expected error for %+v", request)
+		}
+	}
+}
+
+func TestAPICreateTunnelDisabled(t *testing.T) {
+	config.APIToken = "secret"
+	defer func() { config.APIToken = "" }()
+
+	api := NewAPI(NewRegistry())
+	api.Handler = &Handler{}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/tunnels", strings.NewReader(`{"hostname": "debug.site.tld", "origin": "10.0.0.5:8080"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	api.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+)
+
+const heraAnnounce = "hera.announce"
+
+// Executor runs commands inside containers
+type Executor interface {
+	Exec(id string, cmd []string) (int, error)
+}
+
+// Announcer writes a line to the logs of a container when its tunnel becomes active or degraded, so
+// developers see where their app is exposed right in its logs
+type Announcer struct {
+	Executor Executor
+}
+
+// NewAnnouncer returns a new Announcer running its commands with the executor
+func NewAnnouncer(executor Executor) *Announcer {
+	announcer := &Announcer{
+		Executor: executor,
+	}
+
+	return announcer
+}
+
+// parseAnnounce returns whether the tunnel of a container is announced in its logs, from its hera.announce
+// label or HERA_ANNOUNCE when the label is not set
+func parseAnnounce(container types.ContainerJSON) (bool, error) {
+	value := getLabel(heraAnnounce, container)
+	if value == "" {
+		return config.Announce, nil
+	}
+
+	announce, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Invalid value for %s: %s", heraAnnounce, value)
+	}
+
+	return announce, nil
+}
+
+// Handle announces a tunnel event in the logs of the tunnel's container in the background, so the
+// event handler does not wait on the container
+func (a *Announcer) Handle(event *BusEvent) {
+	tunnel, err := registry.FindByHostname(event.Hostname)
+	if err != nil || !tunnel.Announce || tunnel.ContainerID == "" {
+		return
+	}
+
+	var line string
+	switch event.Kind {
+	case EventTunnelStarted:
+		line = fmt.Sprintf("[hera] Exposed at https://%s", event.Hostname)
+	case EventTunnelDegraded:
+		line = fmt.Sprintf("[hera] https://%s is unreachable, its tunnel is degraded: %s", event.Hostname, event.Message)
+	default:
+		return
+	}
+
+	go a.announce(tunnel.ContainerID, line)
+}
+
+// announce writes the line to the standard output of the container's main process, which is what
+// docker logs shows
+func (a *Announcer) announce(id string, line string) {
+	code, err := a.Executor.Exec(id, []string{"sh", "-c", `echo "$1" > /proc/1/fd/1`, "hera", line})
+	if err != nil || code != 0 {
+		log.Debugf("Unable to announce the tunnel in the logs of %s: exit code %d, %v", shortID(id), code, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type recordingExecutor struct {
+	commands chan []string
+}
+
+func (e *recordingExecutor) Exec(id string, cmd []string) (int, error) {
+	e.commands <- append([]string{id}, cmd...)
+	return 0, nil
+}
+
+func TestParseAnnounce(t *testing.T) {
+	defer func() { config.Announce = false }()
+
+	announce, err := parseAnnounce(newTenantContainer(map[string]string{heraAnnounce: "true"}))
+	if err != nil || !announce {
+		t.Errorf("Expected tunnel to be announced, got %t %v", announce, err)
+	}
+
+	config.Announce = true
+	announce, _ = parseAnnounce(newTenantContainer(map[string]string{}))
+	if !announce {
+		t.Error("Expected HERA_ANNOUNCE to be the default")
+	}
+
+	announce, _ = parseAnnounce(newTenantContainer(map[string]string{heraAnnounce: "false"}))
+	if announce {
+		t.Error("Expected label to override HERA_ANNOUNCE")
+	}
+
+	_, err = parseAnnounce(newTenantContainer(map[string]string{heraAnnounce: "loud"}))
+	if err == nil {
+		t.Error("Expected error for invalid value")
+	}
+}
+
+func TestAnnouncerHandle(t *testing.T) {
+	registry = NewRegistry()
+	executor := &recordingExecutor{commands: make(chan []string, 1)}
+	announcer := NewAnnouncer(executor)
+
+	tunnel := newRegistryTunnel("app.example.com", "container-a")
+	tunnel.Announce = true
+	registry.Add(tunnel)
+
+	quiet := newRegistryTunnel("quiet.example.com", "container-b")
+	registry.Add(quiet)
+
+	announcer.Handle(&BusEvent{Kind: EventTunnelStarted, Hostname: "quiet.example.com"})
+	announcer.Handle(&BusEvent{Kind: EventTunnelStarted, Hostname: "app.example.com"})
+
+	select {
+	case command := <-executor.commands:
+		if command[0] != "container-a" || command[len(command)-1] != "[hera] Exposed at https://app.example.com" {
+			t.Errorf("Unexpected command, got %v", command)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the tunnel to be announced")
+	}
+
+	select {
+	case command := <-executor.commands:
+		t.Errorf("Expected only one announcement, got %v", command)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
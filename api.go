@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API serves the state of Hera and its tunnels over HTTP
+type API struct {
+	Registry *Registry
+	About    *About
+
+	// Handler starts on-demand tunnels, which are unavailable when nil
+	Handler *Handler
+
+	mux *http.ServeMux
+}
+
+// TunnelResponse is the API representation of a tunnel
+type TunnelResponse struct {
+	Hostname    string             `json:"hostname"`
+	ContainerID string             `json:"container_id,omitempty"`
+	OriginID    string             `json:"origin_id,omitempty"`
+	IP          string             `json:"ip"`
+	Port        string             `json:"port"`
+	Protocol    string             `json:"protocol"`
+	State       string             `json:"state"`
+	Drifted     bool               `json:"drifted"`
+	Stats       *TunnelStats       `json:"stats,omitempty"`
+	Latency     map[string]float64 `json:"start_latency,omitempty"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty"`
+	Backends    []*Backend         `json:"backends,omitempty"`
+	Effective   EffectiveConfig    `json:"effective_config,omitempty"`
+	Process     *ProcessStats      `json:"process,omitempty"`
+	SmokeTest   *SmokeResult       `json:"smoke_test,omitempty"`
+	Tags        map[string]string  `json:"tags,omitempty"`
+}
+
+// NewAPI returns a new API for the given registry
+func NewAPI(registry *Registry) *API {
+	api := &API{
+		Registry: registry,
+		mux:      http.NewServeMux(),
+	}
+
+	api.mux.HandleFunc("/tunnels", api.handleTunnels)
+	api.mux.HandleFunc("/tunnels/", api.handleTunnelAction)
+	api.mux.HandleFunc("/projects/", api.handleProjectAction)
+	api.mux.HandleFunc("/metrics", api.handleMetrics)
+	api.mux.HandleFunc("/errors", api.handleErrors)
+	api.mux.HandleFunc("/about", api.handleAbout)
+	api.mux.HandleFunc("/labels", api.handleLabels)
+	api.mux.HandleFunc("/healthz", api.handleHealthz)
+	api.mux.HandleFunc("/readyz", api.handleReadyz)
+
+	return api
+}
+
+// ListenAndServe serves the API on the given TCP address or unix socket
+func (a *API) ListenAndServe(address string) error {
+	listener, err := listenAddress(address)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("API listening on %s", address)
+
+	return http.Serve(listener, a)
+}
+
+// ListenAndServeMetrics serves only the metrics on the given TCP address or unix socket, so they can be
+// scraped without exposing the rest of the API
+func (a *API) ListenAndServeMetrics(address string) error {
+	listener, err := listenAddress(address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", a.handleMetrics)
+
+	log.Infof("Metrics listening on %s", address)
+
+	return http.Serve(listener, mux)
+}
+
+// ServeHTTP dispatches a request to the matching API handler. Requests that change tunnels must
+// authenticate with the HERA_API_TOKEN bearer token, and are rejected when no token is configured.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if config.APIToken == "" {
+			writeError(w, http.StatusForbidden, "Set HERA_API_TOKEN to allow changes through the API")
+			return
+		}
+
+		if !isAuthorized(r, config.APIToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "Invalid or missing API token")
+			return
+		}
+	}
+
+	a.mux.ServeHTTP(w, r)
+}
+
+// isAuthorized returns true if the request carries the token as a bearer token
+func isAuthorized(r *http.Request, token string) bool {
+	presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// handleTunnels responds with the registered tunnels and their statistics, or starts an on-demand
+// tunnel for POST requests
+func (a *API) handleTunnels(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		a.createTunnel(w, r)
+		return
+	}
+
+	tunnels := []*TunnelResponse{}
+
+	for _, tunnel := range a.Registry.List() {
+		tunnels = append(tunnels, newTunnelResponse(tunnel))
+	}
+
+	writeJSON(w, http.StatusOK, tunnels)
+}
+
+// createTunnel starts an on-demand tunnel from the AdHocRequest in the request body
+func (a *API) createTunnel(w http.ResponseWriter, r *http.Request) {
+	if a.Handler == nil || !config.AdHocTunnels {
+		writeError(w, http.StatusForbidden, "On-demand tunnels are disabled")
+		return
+	}
+
+	var request AdHocRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	var tunnel *Tunnel
+
+	eventLoop.Do(func() {
+		tunnel, err = a.Handler.StartAdHocTunnel(request)
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newTunnelResponse(tunnel))
+}
+
+// handleTunnelAction performs an action on a single tunnel, requested with POST /tunnels/<hostname>/<action>
+func (a *API) handleTunnelAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tunnels/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	hostname, action := parts[0], parts[1]
+	if _, err := a.Registry.FindByHostname(hostname); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var tunnel *Tunnel
+	var err error
+
+	switch action {
+	case "pause", "unpause":
+		eventLoop.Do(func() {
+			tunnel, err = SetMaintenance(a.Registry, hostname, action == "pause")
+		})
+	default:
+		writeError(w, http.StatusNotFound, "Unknown action: "+action)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newTunnelResponse(tunnel))
+}
+
+// handleProjectAction stops or starts the tunnels of a compose project, requested with
+// POST /projects/<project>/<action>
+func (a *API) handleProjectAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	project, action := parts[0], parts[1]
+
+	var changed []*Tunnel
+	var err error
+
+	switch action {
+	case "stop":
+		if len(projectTunnels(a.Registry, project)) == 0 {
+			writeError(w, http.StatusNotFound, "No tunnels found for project "+project)
+			return
+		}
+
+		eventLoop.Do(func() {
+			changed, err = StopProject(a.Registry, project)
+		})
+
+	case "start":
+		if a.Handler == nil {
+			writeError(w, http.StatusForbidden, "Starting projects is unavailable")
+			return
+		}
+
+		if !a.Registry.IsProjectStopped(project) {
+			writeError(w, http.StatusConflict, "Project "+project+" is not stopped")
+			return
+		}
+
+		eventLoop.Do(func() {
+			changed, err = a.Handler.StartProject(a.Registry, project)
+		})
+
+	default:
+		writeError(w, http.StatusNotFound, "Unknown action: "+action)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tunnels := []*TunnelResponse{}
+	for _, tunnel := range changed {
+		tunnels = append(tunnels, newTunnelResponse(tunnel))
+	}
+
+	writeJSON(w, http.StatusOK, tunnels)
+}
+
+// handleHealthz responds as long as the process is alive
+func (a *API) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"alive": true})
+}
+
+// handleReadyz responds with the readiness checks, with a 503 status until all of them pass
+func (a *API) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks, ready := readiness.Checks()
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, map[string]interface{}{"ready": ready, "checks": checks})
+}
+
+// handleLabels responds with a JSON schema of the labels Hera supports
+func (a *API) handleLabels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, labelSchema(labelCatalog()))
+}
+
+// handleAbout responds with the versions, certificates, modes, and configuration detected at startup
+func (a *API) handleAbout(w http.ResponseWriter, r *http.Request) {
+	if a.About == nil {
+		writeError(w, http.StatusServiceUnavailable, "Hera is still starting")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.About)
+}
+
+// handleErrors responds with the most recent errors and their kinds
+func (a *API) handleErrors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, recentErrors.List())
+}
+
+// handleMetrics responds with the tunnel metrics in the Prometheus text format
+func (a *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics := NewMetricsWriter(w)
+
+	tunnels := a.Registry.List()
+	metrics.Write("hera_tunnels", "gauge", "Number of registered tunnels.", nil, float64(len(tunnels)))
+
+	if elector != nil {
+		leader := 0.0
+		if elector.IsLeader() {
+			leader = 1
+		}
+		metrics.Write("hera_leader", "gauge", "Whether this instance holds the leader lock.", nil, leader)
+	}
+
+	for _, tunnel := range tunnels {
+		labels := tunnel.metricLabels()
+
+		if process := tunnel.Process(); process != nil {
+			metrics.Write("hera_tunnel_process_resident_memory_bytes", "gauge", "Resident memory of the cloudflared process.", labels, float64(process.RSS))
+			metrics.Write("hera_tunnel_process_cpu_percent", "gauge", "CPU usage of the cloudflared process.", labels, process.CPU)
+			metrics.Write("hera_tunnel_process_restarts_total", "counter", "Number of times the cloudflared process was restarted.", labels, float64(process.Restarts))
+		}
+
+		if smoke := tunnel.Smoke(); smoke != nil {
+			verified := 0.0
+			if smoke.Result == SmokeVerified {
+				verified = 1
+			}
+			metrics.Write("hera_tunnel_smoke_test_verified", "gauge", "Whether the most recent smoke test of the tunnel passed.", labels, verified)
+		}
+
+		stats, err := tunnel.Stats()
+		if err != nil {
+			continue
+		}
+
+		metrics.Write("hera_tunnel_requests_total", "counter", "Number of requests proxied by the tunnel.", labels, stats.Requests)
+		metrics.Write("hera_tunnel_active_connections", "gauge", "Number of active connections to the Cloudflare edge.", labels, stats.ActiveConnections)
+		metrics.Write("hera_tunnel_concurrent_requests", "gauge", "Number of requests currently being proxied by the tunnel.", labels, stats.ConcurrentRequests)
+
+		for code, count := range stats.ResponseCodes {
+			codeLabels := tunnel.metricLabels()
+			codeLabels["code"] = code
+			metrics.Write("hera_tunnel_responses_total", "counter", "Number of responses by status code.", codeLabels, count)
+		}
+	}
+
+	collectAll(metrics)
+
+	err := metrics.Flush()
+	if err != nil {
+		log.Errorf("Unable to write metrics: %s", err)
+	}
+}
+
+// newTunnelResponse returns the API representation of a tunnel including its statistics
+func newTunnelResponse(tunnel *Tunnel) *TunnelResponse {
+	stats, err := tunnel.Stats()
+	if err != nil {
+		log.Debugf("Unable to scrape stats for %s: %s", tunnel.Config.Hostname, err)
+	}
+
+	response := &TunnelResponse{
+		Hostname:    tunnel.Config.Hostname,
+		ContainerID: tunnel.ContainerID,
+		OriginID:    tunnel.OriginID,
+		IP:          tunnel.Config.IP,
+		Port:        tunnel.Config.Port,
+		Protocol:    tunnel.Config.Protocol,
+		State:       tunnel.State,
+		Drifted:     tunnel.Drifted,
+		Stats:       stats,
+		Effective:   tunnel.Effective,
+		Process:     tunnel.Process(),
+		SmokeTest:   tunnel.Smoke(),
+		Tags:        tunnel.Tags,
+	}
+
+	if tunnel.Balancer != nil {
+		response.Backends = tunnel.Balancer.Backends()
+	}
+
+	if tunnel.Latency != nil {
+		response.Latency = tunnel.Latency.Phases()
+	}
+
+	if !tunnel.ExpiresAt.IsZero() {
+		expiresAt := tunnel.ExpiresAt
+		response.ExpiresAt = &expiresAt
+	}
+
+	return response
+}
+
+// writeError writes an error message as a JSON response with the given status code
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeJSON writes the value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Errorf("Unable to write response: %s", err)
+	}
+}
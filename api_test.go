@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func newAPIWithTunnel() (*API, func()) {
+	cloudflared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, cloudflaredMetrics)
+	}))
+
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.MetricsAddress = strings.TrimPrefix(cloudflared.URL, "http://")
+
+	r := NewRegistry()
+	r.Add(tunnel)
+
+	return NewAPI(r), cloudflared.Close
+}
+
+func TestAPITunnels(t *testing.T) {
+	api, closeServer := newAPIWithTunnel()
+	defer closeServer()
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/tunnels", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status, got %d", rec.Code)
+	}
+
+	var tunnels []TunnelResponse
+	err := json.NewDecoder(rec.Body).Decode(&tunnels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tunnels) != 1 || tunnels[0].Hostname != "site.tld" {
+		t.Fatalf("Unexpected tunnels, got %v", tunnels)
+	}
+
+	if tunnels[0].Stats == nil || tunnels[0].Stats.Requests != 42 {
+		t.Errorf("Expected tunnel stats, got %v", tunnels[0].Stats)
+	}
+}
+
+func TestAPIMetrics(t *testing.T) {
+	api, closeServer := newAPIWithTunnel()
+	defer closeServer()
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	expected := []string{
+		"hera_tunnels 1",
+		`hera_tunnel_requests_total{hostname="site.tld"} 42`,
+		`hera_tunnel_responses_total{code="502",hostname="site.tld"} 2`,
+		`hera_tunnel_active_connections{hostname="site.tld"} 4`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %s", line)
+		}
+	}
+}
+
+func TestAPIHealthAndReadiness(t *testing.T) {
+	readiness = NewReadiness()
+	defer func() { readiness = NewReadiness() }()
+	api := NewAPI(NewRegistry())
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected liveness status, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready, got %d", rec.Code)
+	}
+
+	for _, check := range []string{CheckDocker, CheckCertificates, CheckEvents, CheckReconciled} {
+		readiness.Set(check, true)
+	}
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected ready, got %d", rec.Code)
+	}
+}
+
+func TestAPIRequiresTokenForChanges(t *testing.T) {
+	api := NewAPI(NewRegistry())
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/tunnels/site.tld/pause", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected changes to be rejected without a configured token, got %d", rec.Code)
+	}
+
+	config.APIToken = "secret"
+	defer func() { config.APIToken = "" }()
+
+	rec = httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/tunnels/site.tld/pause", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	api.ServeHTTP(rec, request)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected wrong token to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	request = httptest.NewRequest("POST", "/tunnels/site.tld/pause", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	api.ServeHTTP(rec, request)
+	if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+		t.Errorf("Expected token to be accepted, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected reads without a token, got %d", rec.Code)
+	}
+}
+
+func TestAPIPauseTunnel(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	r := NewRegistry()
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(""), nil
+		},
+	}
+	r.Add(tunnel)
+	api := NewAPI(r)
+
+	config.APIToken = "secret"
+	defer func() { config.APIToken = "" }()
+	defer serveEventLoop()()
+
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/tunnels/site.tld/pause", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	api.ServeHTTP(rec, request)
+
+	if rec.Code != http.StatusOK || !r.IsPaused("site.tld") {
+		t.Errorf("Expected tunnel to be paused, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reservedArgs are the cloudflared flags Hera sets itself, which cannot be overridden by hera.cloudflared-args
+var reservedArgs = map[string]bool{
+	"config":        true,
+	"hostname":      true,
+	"url":           true,
+	"logfile":       true,
+	"loglevel":      true,
+	"origincert":    true,
+	"metrics":       true,
+	"no-autoupdate": true,
+}
+
+// parseCloudflaredArgs returns the arguments of a hera.cloudflared-args label value quoted for the run file,
+// along with the grace period set by a --grace-period flag, so Hera waits for it when stopping the tunnel.
+// An error is returned if the value cannot be split, does not start with a flag, or sets a flag managed by Hera.
+func parseCloudflaredArgs(value string) (string, time.Duration, error) {
+	args, err := splitArgs(value)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid arguments for %s: %s", heraArgs, err)
+	}
+
+	if len(args) == 0 {
+		return "", 0, nil
+	}
+
+	if !strings.HasPrefix(args[0], "-") {
+		return "", 0, fmt.Errorf("Invalid arguments for %s: %s is not a flag", heraArgs, args[0])
+	}
+
+	var gracePeriod time.Duration
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, "\x00\n\r") {
+			return "", 0, fmt.Errorf("Invalid arguments for %s: arguments cannot contain control characters", heraArgs)
+		}
+
+		name := flagName(arg)
+		if reservedArgs[name] {
+			return "", 0, fmt.Errorf("Invalid arguments for %s: --%s is set by Hera", heraArgs, name)
+		}
+
+		if name == "grace-period" {
+			gracePeriod, err = flagDuration(args, i)
+			if err != nil {
+				return "", 0, fmt.Errorf("Invalid arguments for %s: %s", heraArgs, err)
+			}
+		}
+
+		quoted[i] = quoteArg(arg)
+	}
+
+	return strings.Join(quoted, " "), gracePeriod, nil
+}
+
+// flagDuration returns the duration value of the flag at index i, given either as --flag=value or
+// as the next argument
+func flagDuration(args []string, i int) (time.Duration, error) {
+	value := ""
+	if parts := strings.SplitN(args[i], "=", 2); len(parts) == 2 {
+		value = parts[1]
+	} else if i+1 < len(args) {
+		value = args[i+1]
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration for --%s: %s", flagName(args[i]), value)
+	}
+
+	return duration, nil
+}
+
+// splitArgs splits a value into arguments on whitespace, keeping single or double quoted text together
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// flagName returns the name of a flag argument without its dashes or value, or an empty string
+// if the argument is not a flag
+func flagName(arg string) string {
+	if !strings.HasPrefix(arg, "-") {
+		return ""
+	}
+
+	name := strings.TrimLeft(arg, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// quoteArg quotes an argument so the shell of the run file passes it to cloudflared unchanged
+func quoteArg(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	auditLog = &AuditLog{Path: filepath.Join(LogDir, "audit.log")}
+)
+
+// AuditEntry is a single record in the audit log
+type AuditEntry struct {
+	Time        time.Time         `json:"time"`
+	Action      string            `json:"action"`
+	ContainerID string            `json:"container_id,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+}
+
+// AuditLog appends entries as JSON lines to a file, for decisions administrators need to review
+type AuditLog struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Record writes an entry to the audit log and to the main log
+func (a *AuditLog) Record(entry *AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	log.Warningf("Audit: %s %s for container %s (tenant %q): %s", entry.Action, entry.Hostname, shortID(entry.ContainerID), entry.Tenant, entry.Reason)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Unable to encode audit entry: %s", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file, err := fs.OpenFile(a.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Errorf("Unable to open audit log: %s", err)
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		log.Errorf("Unable to write audit log: %s", err)
+	}
+}
+
+// recordRejection records a rejected tunnel in the audit log
+func recordRejection(event *BusEvent) {
+	auditLog.Record(&AuditEntry{
+		Time:        event.Time,
+		Action:      "tunnel_rejected",
+		ContainerID: event.ContainerID,
+		Tenant:      event.Tenant,
+		Hostname:    event.Hostname,
+		Tags:        event.Tags,
+		Reason:      event.Message,
+	})
+}
+
+// shortID returns the short form of a container ID
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	balancers = NewBalancers()
+)
+
+// Balancer splits the requests of a hostname between several containers according to their weights.
+// It serves on a local address that the tunnel for the hostname proxies to.
+type Balancer struct {
+	Hostname string
+	mu       sync.RWMutex
+	backends map[string]*Backend
+	listener net.Listener
+}
+
+// Backend is a container receiving a weighted share of a Balancer's requests
+type Backend struct {
+	ContainerID string `json:"container_id"`
+	URL         string `json:"url"`
+	Weight      int    `json:"weight"`
+	proxy       *httputil.ReverseProxy
+}
+
+// Balancers holds the Balancer of each weighted hostname
+type Balancers struct {
+	mu        sync.Mutex
+	hostnames map[string]*Balancer
+}
+
+// NewBalancers returns a new, empty Balancers
+func NewBalancers() *Balancers {
+	balancers := &Balancers{
+		hostnames: make(map[string]*Balancer),
+	}
+
+	return balancers
+}
+
+// Get returns the Balancer for the hostname, starting a new one if none exists
+func (b *Balancers) Get(hostname string) (*Balancer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if balancer, ok := b.hostnames[hostname]; ok {
+		return balancer, nil
+	}
+
+	balancer, err := NewBalancer(hostname)
+	if err != nil {
+		return nil, err
+	}
+	b.hostnames[hostname] = balancer
+
+	return balancer, nil
+}
+
+// Remove stops and removes the Balancer for the hostname if one exists
+func (b *Balancers) Remove(hostname string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if balancer, ok := b.hostnames[hostname]; ok {
+		balancer.listener.Close()
+		delete(b.hostnames, hostname)
+	}
+}
+
+// NewBalancer returns a Balancer for the hostname serving on a free local address
+func NewBalancer(hostname string) (*Balancer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to start balancer for %s: %s", hostname, err)
+	}
+
+	balancer := &Balancer{
+		Hostname: hostname,
+		backends: make(map[string]*Backend),
+		listener: listener,
+	}
+
+	go http.Serve(listener, balancer)
+
+	return balancer, nil
+}
+
+// URL returns the local URL the tunnel proxies to
+func (b *Balancer) URL() string {
+	return fmt.Sprintf("http://%s", b.listener.Addr().String())
+}
+
+// Set adds the container as a backend or updates its URL and weight
+func (b *Balancer) Set(containerID string, target string, weight int) error {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(parsed)
+	proxy.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.backends[containerID] = &Backend{
+		ContainerID: containerID,
+		URL:         target,
+		Weight:      weight,
+		proxy:       proxy,
+	}
+
+	return nil
+}
+
+// Has returns a bool to indicate if the container is a backend of the Balancer
+func (b *Balancer) Has(containerID string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.backends[containerID]
+
+	return ok
+}
+
+// Remove removes the container from the backends and returns the number of remaining backends
+func (b *Balancer) Remove(containerID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.backends, containerID)
+
+	return len(b.backends)
+}
+
+// Backends returns a snapshot of the backends sorted by container ID
+func (b *Balancer) Backends() []*Backend {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	backends := make([]*Backend, 0, len(b.backends))
+	for _, backend := range b.backends {
+		backends = append(backends, backend)
+	}
+
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].ContainerID < backends[j].ContainerID
+	})
+
+	return backends
+}
+
+// ServeHTTP proxies the request to a backend picked according to the weights
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	backend := b.pick(rand.Intn)
+	if backend == nil {
+		http.Error(w, "No backend available", http.StatusServiceUnavailable)
+		return
+	}
+
+	backend.proxy.ServeHTTP(w, r)
+}
+
+// pick returns a backend chosen with a probability proportional to its weight, using intn
+// to draw a random number, or nil if no backend has a positive weight
+func (b *Balancer) pick(intn func(int) int) *Backend {
+	backends := b.Backends()
+
+	total := 0
+	for _, backend := range backends {
+		total += backend.Weight
+	}
+
+	if total <= 0 {
+		return nil
+	}
+
+	n := intn(total)
+	for _, backend := range backends {
+		if n < backend.Weight {
+			return backend
+		}
+		n -= backend.Weight
+	}
+
+	return nil
+}
+
+// parseWeight returns the weight from a hera.weight label value.
+// An error is returned if the weight is not a non-negative integer.
+func parseWeight(value string) (int, error) {
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 0 {
+		return 0, fmt.Errorf("Invalid weight for %s: %s", heraWeight, value)
+	}
+
+	return weight, nil
+}
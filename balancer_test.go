@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBalancerPick(t *testing.T) {
+	balancer, err := NewBalancer("site.tld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balancer.listener.Close()
+
+	balancer.Set("blue", "http://172.23.0.4:80", 90)
+	balancer.Set("green", "http://172.23.0.5:80", 10)
+
+	picks := map[int]string{0: "blue", 89: "blue", 90: "green", 99: "green"}
+	for n, expected := range picks {
+		backend := balancer.pick(func(int) int { return n })
+		if backend.ContainerID != expected {
+			t.Errorf("Unexpected backend for %d, got %s", n, backend.ContainerID)
+		}
+	}
+
+	if remaining := balancer.Remove("green"); remaining != 1 {
+		t.Errorf("Unexpected remaining backends, got %d", remaining)
+	}
+
+	if balancer.Has("green") {
+		t.Error("Expected green to be removed")
+	}
+
+	balancer.Set("blue", "http://172.23.0.4:80", 0)
+	if balancer.pick(func(int) int { return 0 }) != nil {
+		t.Error("Expected no backend without weight")
+	}
+}
+
+func TestBalancerServeHTTP(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "origin")
+	}))
+	defer origin.Close()
+
+	balancers := NewBalancers()
+	balancer, err := balancers.Get("site.tld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balancers.Remove("site.tld")
+
+	again, _ := balancers.Get("site.tld")
+	if again != balancer {
+		t.Error("Expected the same balancer for the hostname")
+	}
+
+	resp, err := http.Get(balancer.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected unavailable without backends, got %d", resp.StatusCode)
+	}
+
+	balancer.Set("blue", origin.URL, 1)
+
+	resp, err = http.Get(balancer.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "origin" {
+		t.Errorf("Unexpected response, got %s", body)
+	}
+}
+
+func TestParseWeight(t *testing.T) {
+	weights := map[string]bool{"90": true, "0": true, "-1": false, "ten": false}
+
+	for value, valid := range weights {
+		_, err := parseWeight(value)
+		if (err == nil) != valid {
+			t.Errorf("Unexpected result for weight %s", value)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+var (
+	dockerBreakerTrips = NewCounterVec("hera_docker_breaker_trips_total", "Number of times requests to the Docker API were paused after repeated failures.")
+	dockerBreaker      = NewBreaker(breakerThreshold, breakerCooldown)
+
+	errDockerPaused = NewError(ErrDockerUnavailable, fmt.Errorf("Requests to Docker are paused after repeated failures"))
+)
+
+// Breaker pauses requests to the Docker daemon once they fail Threshold times in a row. While it is
+// open, a single request is let through every Cooldown to probe whether the daemon has recovered.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	probeAt  time.Time
+}
+
+// NewBreaker returns a closed Breaker
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	breaker := &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+
+	return breaker
+}
+
+// Allow returns whether a request may be made. An open breaker allows one probe per cooldown.
+func (b *Breaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+
+	if now.Before(b.probeAt) {
+		return false
+	}
+
+	b.probeAt = now.Add(b.Cooldown)
+
+	return true
+}
+
+// IsOpen returns whether requests are paused
+func (b *Breaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
+
+// Record counts the result of a request, opening the breaker after Threshold consecutive failures and
+// closing it again after a success. Missing containers are answered by a healthy daemon, so they count
+// as successes.
+func (b *Breaker) Record(err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || client.IsErrNotFound(err) {
+		if b.open {
+			log.Infof("Docker has recovered, resuming requests")
+			readiness.Set(CheckDocker, true)
+		}
+
+		b.failures = 0
+		b.open = false
+
+		return
+	}
+
+	b.failures++
+
+	if b.open || b.failures < b.Threshold {
+		return
+	}
+
+	log.Errorf("Requests to Docker failed %d times in a row, pausing them and probing every %s: %s", b.failures, b.Cooldown, err)
+	dockerBreakerTrips.Inc()
+	readiness.Set(CheckDocker, false)
+
+	b.open = true
+	b.probeAt = now.Add(b.Cooldown)
+}
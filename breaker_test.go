@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBreakerTrips(t *testing.T) {
+	defer func(previous *Readiness) { readiness = previous }(readiness)
+	readiness = NewReadiness()
+	readiness.Set(CheckDocker, true)
+
+	breaker := NewBreaker(3, time.Minute)
+	now := time.Now()
+	failure := fmt.Errorf("Error response from daemon: no space left on device")
+
+	for i := 0; i < 2; i++ {
+		breaker.Record(failure, now)
+	}
+
+	if breaker.IsOpen() || !breaker.Allow(now) {
+		t.Fatal("Expected the breaker to stay closed below the threshold")
+	}
+
+	breaker.Record(failure, now)
+
+	if !breaker.IsOpen() {
+		t.Fatal("Expected the breaker to open at the threshold")
+	}
+
+	if checks, _ := readiness.Checks(); checks[CheckDocker] {
+		t.Error("Expected Docker to be reported as not ready")
+	}
+
+	if breaker.Allow(now.Add(30 * time.Second)) {
+		t.Error("Expected requests to be paused during the cooldown")
+	}
+
+	if !breaker.Allow(now.Add(time.Minute)) {
+		t.Error("Expected a probe after the cooldown")
+	}
+
+	if breaker.Allow(now.Add(time.Minute)) {
+		t.Error("Expected a single probe per cooldown")
+	}
+
+	breaker.Record(nil, now.Add(time.Minute))
+
+	if breaker.IsOpen() || !breaker.Allow(now.Add(time.Minute)) {
+		t.Error("Expected the breaker to close after a successful probe")
+	}
+
+	if checks, _ := readiness.Checks(); !checks[CheckDocker] {
+		t.Error("Expected Docker to be reported as ready again")
+	}
+}
+
+func TestBreakerResetsOnSuccess(t *testing.T) {
+	breaker := NewBreaker(2, time.Minute)
+	now := time.Now()
+
+	breaker.Record(fmt.Errorf("timeout"), now)
+	breaker.Record(nil, now)
+	breaker.Record(fmt.Errorf("timeout"), now)
+
+	if breaker.IsOpen() {
+		t.Error("Expected failures to be counted only when consecutive")
+	}
+}
+
+func TestReportErrorSkipsPausedRequests(t *testing.T) {
+	defer func(previous *Bus) { bus = previous }(bus)
+	bus = NewBus()
+
+	published := false
+	bus.Subscribe(func(e *BusEvent) { published = true })
+
+	reportError(errDockerPaused, "5aa5a300dd0e")
+
+	if published {
+		t.Error("Expected paused requests not to be reported again")
+	}
+}
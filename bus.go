@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies what happened to a tunnel or container
+type EventKind string
+
+const (
+	EventTunnelStarted     EventKind = "tunnel_started"
+	EventTunnelStopped     EventKind = "tunnel_stopped"
+	EventTunnelDegraded    EventKind = "tunnel_degraded"
+	EventTunnelFailed      EventKind = "tunnel_failed"
+	EventCertMissing       EventKind = "cert_missing"
+	EventOriginUnreachable EventKind = "origin_unreachable"
+	EventHostnameRejected  EventKind = "hostname_rejected"
+	EventDNSMismatch       EventKind = "dns_mismatch"
+	EventError             EventKind = "error"
+)
+
+var (
+	eventsTotal = NewCounterVec("hera_events_total", "Number of events published by kind.", "kind")
+	bus         = newBus()
+)
+
+// BusEvent is published on the bus when the state of a tunnel changes or an error is reported
+type BusEvent struct {
+	Kind        EventKind
+	Time        time.Time
+	Hostname    string
+	ContainerID string
+	Tenant      string
+	Tags        map[string]string
+	Message     string
+	Err         error
+}
+
+// Bus delivers the events published by Hera to the features interested in them, so the handler and
+// tunnels don't need to know about metrics, notifications, audits, or the status API
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[EventKind][]func(*BusEvent)
+}
+
+// NewBus returns a Bus without subscribers
+func NewBus() *Bus {
+	bus := &Bus{
+		subscribers: make(map[EventKind][]func(*BusEvent)),
+	}
+
+	return bus
+}
+
+// newBus returns the bus with the subscribers of Hera's features
+func newBus() *Bus {
+	bus := NewBus()
+
+	bus.Subscribe(func(e *BusEvent) { eventsTotal.Inc(string(e.Kind)) })
+	bus.Subscribe(recordError, EventCertMissing, EventOriginUnreachable, EventError)
+	bus.Subscribe(recordRejection, EventHostnameRejected)
+	bus.Subscribe(func(e *BusEvent) { notifiers.Handle(e) }, EventTunnelStarted, EventTunnelStopped, EventTunnelDegraded, EventTunnelFailed, EventDNSMismatch)
+	bus.Subscribe(func(e *BusEvent) { requestDependencyRetry() }, EventTunnelStarted)
+
+	return bus
+}
+
+// Subscribe calls the handler for each published event of the given kinds, or of every kind if none are given
+func (b *Bus) Subscribe(handler func(*BusEvent), kinds ...EventKind) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(kinds) == 0 {
+		kinds = []EventKind{""}
+	}
+
+	for _, kind := range kinds {
+		b.subscribers[kind] = append(b.subscribers[kind], handler)
+	}
+}
+
+// Publish calls the subscribers of the event in the order they subscribed. Subscribers are called
+// synchronously, so ones that do slow work, such as sending notifications, must do so in the background.
+func (b *Bus) Publish(event *BusEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	var handlers []func(*BusEvent)
+	handlers = append(handlers, b.subscribers[""]...)
+	handlers = append(handlers, b.subscribers[event.Kind]...)
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBusSubscribe(t *testing.T) {
+	b := NewBus()
+
+	var received []string
+	b.Subscribe(func(e *BusEvent) { received = append(received, "all:"+string(e.Kind)) })
+	b.Subscribe(func(e *BusEvent) { received = append(received, "started:"+e.Hostname) }, EventTunnelStarted)
+
+	b.Publish(&BusEvent{Kind: EventTunnelStarted, Hostname: "site.tld"})
+	b.Publish(&BusEvent{Kind: EventTunnelStopped, Hostname: "site.tld"})
+
+	expected := []string{"all:tunnel_started", "started:site.tld", "all:tunnel_stopped"}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected deliveries, got %v want %v", received, expected)
+	}
+}
+
+func TestBusPublishSetsTime(t *testing.T) {
+	b := NewBus()
+
+	var event *BusEvent
+	b.Subscribe(func(e *BusEvent) { event = e })
+	b.Publish(&BusEvent{Kind: EventError})
+
+	if event == nil || event.Time.IsZero() {
+		t.Error("Expected the event to be timestamped")
+	}
+}
+
+func TestReportErrorPublishesKind(t *testing.T) {
+	defer func(previous *Bus) { bus = previous }(bus)
+	bus = newBus()
+
+	var kinds []EventKind
+	bus.Subscribe(func(e *BusEvent) { kinds = append(kinds, e.Kind) })
+
+	reportError(NewError(ErrNoCertificate, fmt.Errorf("No certificate for site.tld")), "container-a")
+	reportError(NewError(ErrUnresolvableOrigin, fmt.Errorf("Unable to resolve db")), "container-a")
+	reportError(fmt.Errorf("Something else"), "container-a")
+
+	expected := []EventKind{EventCertMissing, EventOriginUnreachable, EventError}
+	if fmt.Sprint(kinds) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected event kinds, got %v want %v", kinds, expected)
+	}
+
+	entries := recentErrors.List()
+	last := entries[len(entries)-1]
+	if last.Message != "Something else" || last.ContainerID != "container-a" {
+		t.Errorf("Expected the error to be recorded for the API, got %+v", last)
+	}
+}
+
+func TestTunnelPublishesLifecycle(t *testing.T) {
+	defer func(previous *Bus) { bus = previous }(bus)
+	bus = NewBus()
+
+	var kinds []EventKind
+	bus.Subscribe(func(e *BusEvent) { kinds = append(kinds, e.Kind) })
+
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(""), nil
+		},
+	}
+
+	tunnel.Stop()
+	tunnel.Stop()
+
+	if fmt.Sprint(kinds) != fmt.Sprint([]EventKind{EventTunnelStopped}) {
+		t.Errorf("Expected a single stop event, got %v", kinds)
+	}
+}
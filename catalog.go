@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	integerPattern  = `^[0-9]+$`
+	portsPattern    = `^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`
+)
+
+var (
+	booleanValues = []string{"true", "false"}
+)
+
+// LabelSpec describes a container label Hera reads, for linters and editors validating hera.* labels
+type LabelSpec struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+}
+
+// labelCatalog returns the labels Hera supports, with the defaults of the current config
+func labelCatalog() []LabelSpec {
+	return []LabelSpec{
+		{Name: heraHostname, Type: "hostname", Required: true, Description: "The public hostname of the tunnel, a template using {{.Port}} when several ports are published."},
+		{Name: heraPort, Type: "ports", Required: config.DefaultPort == "", Default: config.DefaultPort, Pattern: portsPattern, Description: "The port the service listens on inside the container, or a list of ports and ranges like 8080-8082,9000 with a tunnel for each."},
+		{Name: heraIP, Type: "ip", Description: "A fixed IP address to connect to instead of resolving the container's hostname."},
+		{Name: heraIPFrom, Type: "cidr", Description: "A CIDR used to pick which of the container's network IPs to connect to."},
+		{Name: heraProtocol, Type: "string", Default: config.DefaultProtocol, Enum: []string{"http", "https"}, Description: "The protocol used to connect to the service."},
+		{Name: heraOrigin, Type: "string", Description: "The name or ID of another container the tunnel points to."},
+		{Name: heraReady, Type: "string", Description: "A command run inside the container that must succeed before the tunnel is started."},
+		{Name: heraWeight, Type: "integer", Pattern: integerPattern, Description: "The share of requests sent to the container when several containers use the same hostname."},
+		{Name: heraLogLevel, Type: "string", Enum: []string{"debug", "info", "warn", "error", "fatal"}, Description: "The log level of the tunnel's cloudflared process."},
+		{Name: heraLogFile, Type: "path", Default: "<hostname>.log", Description: "The file cloudflared logs to, relative to /var/log/hera."},
+		{Name: heraArgs, Type: "string", Description: "Extra arguments appended to the tunnel's cloudflared command."},
+		{Name: heraTTL, Type: "duration", Default: durationDefault(config.TunnelTTL), Pattern: durationPattern, Description: "How long the tunnel stays up after the container starts."},
+		{Name: heraSchedule, Type: "string", Description: "The windows during which the tunnel is available, such as Mon-Fri 08:00-18:00."},
+		{Name: heraDependsOn, Type: "list", Description: "Comma separated hostnames or containers that must be up before the tunnel is started."},
+		{Name: heraGrace, Type: "duration", Pattern: durationPattern, Description: "How long cloudflared keeps serving in-flight requests after the tunnel is stopped."},
+		{Name: heraSmokePath, Type: "string", Default: "/", Description: "The path requested through the public hostname by the smoke test."},
+		{Name: heraSmokeStatus, Type: "integer", Pattern: integerPattern, Description: "The status code the smoke test expects."},
+		{Name: heraRedirect, Type: "url", Pattern: `^https?://`, Description: "A URL to redirect every request for the hostname to instead of proxying to the container."},
+		{Name: heraRedirectStatus, Type: "integer", Default: "301", Enum: []string{"301", "302", "307", "308"}, Description: "The status code of the redirect."},
+		{Name: heraStaticDir, Type: "path", Pattern: "^/", Description: "A directory mounted into the Hera container to serve instead of proxying to the container."},
+		{Name: heraAnnounce, Type: "boolean", Default: fmt.Sprint(config.Announce), Enum: booleanValues, Description: "Whether tunnel state changes are written to the container's logs."},
+		{Name: heraKeepAliveConnections, Type: "integer", Pattern: integerPattern, Description: "The maximum number of idle connections cloudflared keeps open to the service."},
+		{Name: heraKeepAliveTimeout, Type: "duration", Pattern: durationPattern, Description: "How long cloudflared keeps an idle connection to the service open."},
+		{Name: heraTCPKeepAlive, Type: "duration", Pattern: durationPattern, Description: "The interval of TCP keepalive probes on connections to the service."},
+		{Name: heraAccessServiceToken, Type: "string", Description: "The name of a Cloudflare Access service token requests to the hostname must be authenticated with."},
+		{Name: heraAccessCreateToken, Type: "boolean", Default: "false", Enum: booleanValues, Description: "Whether the service token is created if it doesn't exist."},
+		{Name: heraExposeEphemeral, Type: "boolean", Default: "false", Enum: booleanValues, Description: "Whether one-off containers of docker compose run and init containers get a tunnel."},
+		{Name: heraTagPrefix + "<name>", Type: "string", Description: "Arbitrary metadata carried to the API, metrics, audit log, and notifications."},
+	}
+}
+
+// durationDefault returns a duration as a label default, or an empty string if it is not set
+func durationDefault(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+// labelNames returns the names of the labels in the catalog with a fixed name
+func labelNames(catalog []LabelSpec) []string {
+	var names []string
+	for _, spec := range catalog {
+		if spec.Name != heraTagPrefix+"<name>" {
+			names = append(names, spec.Name)
+		}
+	}
+
+	return names
+}
+
+// labelSchema returns a JSON schema for the labels of a container, so tools can validate hera.* labels
+func labelSchema(catalog []LabelSpec) map[string]interface{} {
+	properties := map[string]interface{}{}
+	patternProperties := map[string]interface{}{}
+
+	for _, spec := range catalog {
+		property := map[string]interface{}{
+			"type":        "string",
+			"description": spec.Description,
+			"x-hera-type": spec.Type,
+		}
+
+		if spec.Required {
+			property["x-hera-required"] = true
+		}
+		if spec.Default != "" {
+			property["default"] = spec.Default
+		}
+		if len(spec.Enum) > 0 {
+			property["enum"] = spec.Enum
+		}
+		if spec.Pattern != "" {
+			property["pattern"] = spec.Pattern
+		}
+
+		if spec.Name == heraTagPrefix+"<name>" {
+			patternProperties[`^hera\.tag\..+$`] = property
+			continue
+		}
+
+		properties[spec.Name] = property
+	}
+
+	schema := map[string]interface{}{
+		"$schema":           "http://json-schema.org/draft-07/schema#",
+		"title":             "Hera container labels",
+		"type":              "object",
+		"properties":        properties,
+		"patternProperties": patternProperties,
+	}
+
+	return schema
+}
+
+// writeLabelTable writes the catalog as a table for people reading it in a terminal
+func writeLabelTable(w io.Writer, catalog []LabelSpec) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "LABEL\tTYPE\tDEFAULT\tDESCRIPTION")
+
+	for _, spec := range catalog {
+		value := spec.Default
+		if spec.Required {
+			value = "(required)"
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", spec.Name, spec.Type, value, spec.Description)
+	}
+
+	table.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLabelSchema(t *testing.T) {
+	catalog := labelCatalog()
+	schema := labelSchema(catalog)
+
+	properties := schema["properties"].(map[string]interface{})
+	if len(properties) != len(labelNames(catalog)) {
+		t.Errorf("Expected a property for each label, got %d", len(properties))
+	}
+
+	hostname := properties[heraHostname].(map[string]interface{})
+	if hostname["x-hera-required"] != true {
+		t.Error("Expected hostname to be required")
+	}
+
+	status := properties[heraRedirectStatus].(map[string]interface{})
+	if status["default"] != "301" || len(status["enum"].([]string)) != 4 {
+		t.Errorf("Unexpected redirect status property, got %v", status)
+	}
+
+	patterns := schema["patternProperties"].(map[string]interface{})
+	if _, ok := patterns[`^hera\.tag\..+$`]; !ok {
+		t.Error("Expected a pattern for tags")
+	}
+}
+
+func TestLabelCatalogDefaults(t *testing.T) {
+	config.DefaultPort = "8080"
+	defer func() { config.DefaultPort = "" }()
+
+	for _, spec := range labelCatalog() {
+		if spec.Name == heraPort && (spec.Required || spec.Default != "8080") {
+			t.Errorf("Expected HERA_DEFAULT_PORT to be the default port, got %+v", spec)
+		}
+	}
+
+	if !isKnownLabel(heraAnnounce) || isKnownLabel("hera.hostnme") {
+		t.Error("Expected the known labels to come from the catalog")
+	}
+}
+
+func TestWriteLabelTable(t *testing.T) {
+	var out bytes.Buffer
+	writeLabelTable(&out, labelCatalog())
+
+	if !strings.Contains(out.String(), "hera.hostname") || !strings.Contains(out.String(), "(required)") {
+		t.Errorf("Unexpected table, got %s", out.String())
+	}
+}
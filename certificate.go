@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -13,10 +15,32 @@ const (
 	CertificatePath = "/certs"
 )
 
+var (
+	certificateSource CertificateSource = &DirectorySource{Path: CertificatePath}
+)
+
+// CertificateSource provides the certificates tunnels can be created with
+type CertificateSource interface {
+	// Certificates returns the available certificates, which cloudflared reads from their FullPath in fs
+	Certificates(fs afero.Fs) ([]*Certificate, error)
+}
+
+// DirectorySource provides the .pem files of a directory as certificates. Files encrypted with
+// hera encrypt are decrypted to DecryptedCertificatePath with the configured passphrase.
+type DirectorySource struct {
+	Path string
+
+	mu        sync.Mutex
+	decrypted map[string]time.Time
+}
+
 // Certificate holds config a certificate
 type Certificate struct {
 	Name string
 	Fs   afero.Fs
+
+	// Dir is the directory of the certificate file, which defaults to CertificatePath
+	Dir string
 }
 
 // NewCertificate returns a new Certificate
@@ -29,11 +53,16 @@ func NewCertificate(name string, fs afero.Fs) *Certificate {
 	return cert
 }
 
-// FindAllCertificates scans the /certs directory for .pem files and returns a collection of Certificates
+// FindAllCertificates returns a collection of Certificates from the configured certificate source
 func FindAllCertificates(fs afero.Fs) ([]*Certificate, error) {
+	return certificateSource.Certificates(fs)
+}
+
+// Certificates scans the directory for .pem files and returns a collection of Certificates
+func (d *DirectorySource) Certificates(fs afero.Fs) ([]*Certificate, error) {
 	var certs []*Certificate
 
-	files, err := afero.ReadDir(fs, CertificatePath)
+	files, err := afero.ReadDir(fs, d.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -46,12 +75,63 @@ func FindAllCertificates(fs afero.Fs) ([]*Certificate, error) {
 		}
 
 		cert := NewCertificate(name, fs)
+		cert.Dir = d.Path
+
+		err := d.decrypt(cert, file.ModTime())
+		if err != nil {
+			log.Errorf("Unable to decrypt certificate %s: %s", name, err)
+			continue
+		}
+
 		certs = append(certs, cert)
 	}
 
 	return certs, nil
 }
 
+// decrypt points the certificate at a decrypted copy if its file is encrypted. Files are only
+// decrypted again when they have been modified.
+func (d *DirectorySource) decrypt(cert *Certificate, modified time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	decrypted := NewCertificate(cert.Name, cert.Fs)
+	decrypted.Dir = DecryptedCertificatePath
+
+	if d.decrypted[cert.Name].Equal(modified) && decrypted.isExist() {
+		cert.Dir = decrypted.Dir
+		return nil
+	}
+
+	contents, err := afero.ReadFile(cert.Fs, cert.FullPath())
+	if err != nil || !IsEncrypted(contents) {
+		return err
+	}
+
+	plain, err := Decrypt(contents, config.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	err = cert.Fs.MkdirAll(DecryptedCertificatePath, 0700)
+	if err != nil {
+		return err
+	}
+
+	err = afero.WriteFile(cert.Fs, decrypted.FullPath(), plain, 0600)
+	if err != nil {
+		return err
+	}
+
+	if d.decrypted == nil {
+		d.decrypted = make(map[string]time.Time)
+	}
+	d.decrypted[cert.Name] = modified
+	cert.Dir = decrypted.Dir
+
+	return nil
+}
+
 // VerifyCertificates returns an error if no valid certificates are found
 func VerifyCertificates(fs afero.Fs) error {
 	certs, err := FindAllCertificates(fs)
@@ -85,6 +165,10 @@ func FindCertificateForHost(hostname string, fs afero.Fs) (*Certificate, error)
 
 // FullPath returns the full path of a certificate file
 func (c *Certificate) FullPath() string {
+	if c.Dir != "" {
+		return filepath.Join(c.Dir, c.Name)
+	}
+
 	return filepath.Join(CertificatePath, c.Name)
 }
 
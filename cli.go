@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const usage = `Usage: hera [command]
+
+Runs Hera when no command is given. Commands are sent to the control socket of a running Hera:
+
+  pause <hostname>    Serve the maintenance response instead of proxying to the origin
+  unpause <hostname>  Resume proxying to the origin
+  config <hostname>   Print the effective settings of a tunnel and where each came from
+  stop <hostname>     Stop a tunnel without stopping its container
+  stop --project <project>
+                      Stop the tunnels of every container in a Docker Compose project
+  start --project <project>
+                      Start the tunnels of a stopped Docker Compose project again
+  export [format]     Print the tunnels as a cloudflared ingress config ("ingress", the default)
+                      or as the config file of each tunnel ("config")
+  state export        Print the tunnels as JSON to move them to another host
+  state import <file> Re-establish the tunnels of a state exported on another host ("-" for stdin)
+
+Commands that run without a running Hera:
+
+  simulate --container <id>  Print the tunnel config Hera would create for a container
+  simulate --fixture <file>  Print the tunnel config for the JSON output of docker inspect
+  encrypt <file>             Encrypt a certificate in place with HERA_PASSPHRASE
+  decrypt <file>             Print a file encrypted with HERA_PASSPHRASE, such as saved Access credentials
+  login <domain>             Log in to Cloudflare and save the certificate for the domain
+  labels [--json]            Print the supported labels, or a JSON schema of them for linters and editors
+`
+
+// RunCommand runs a command against a running Hera and returns the exit code
+func RunCommand(args []string) int {
+	switch args[0] {
+	case "pause", "unpause", "config":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		return sendCommand(ControlRequest{Command: args[0], Hostname: args[1]})
+
+	case "stop":
+		if len(args) == 3 && args[1] == "--project" {
+			return sendCommand(ControlRequest{Command: "stop", Project: args[2]})
+		}
+
+		if len(args) != 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		return sendCommand(ControlRequest{Command: "stop", Hostname: args[1]})
+
+	case "start":
+		if len(args) != 3 || args[1] != "--project" {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		return sendCommand(ControlRequest{Command: "start", Project: args[2]})
+
+	case "export":
+		if len(args) > 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		request := ControlRequest{Command: "export"}
+		if len(args) == 2 {
+			request.Format = args[1]
+		}
+
+		return sendCommand(request)
+
+	case "state":
+		return runState(args[1:])
+
+	case "simulate":
+		return runSimulate(args[1:])
+
+	case "encrypt":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		return encryptFile(args[1])
+
+	case "decrypt":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		return decryptFile(args[1])
+
+	case "labels":
+		if len(args) > 2 || (len(args) == 2 && args[1] != "--json") {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		if len(args) == 1 {
+			writeLabelTable(os.Stdout, labelCatalog())
+			return 0
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(labelSchema(labelCatalog()))
+
+		return 0
+
+	case "login":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		err := login(args[1], InteractiveCommand{}, fs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("Saved the certificate for %s\n", args[1])
+
+		return 0
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+// sendCommand sends a request to the control socket and prints the result
+func sendCommand(request ControlRequest) int {
+	response, err := SendControlRequest(config.ControlSocket, request)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to reach Hera: %s\n", err)
+		return 1
+	}
+
+	if !response.OK {
+		fmt.Fprintln(os.Stderr, response.Error)
+		return 1
+	}
+
+	if response.Export != "" {
+		fmt.Print(response.Export)
+		return 0
+	}
+
+	if response.Config != nil {
+		fmt.Print(response.Config.String())
+		return 0
+	}
+
+	if response.State != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(response.State)
+		return 0
+	}
+
+	for _, line := range response.Report {
+		fmt.Println(line)
+	}
+	if len(response.Report) > 0 {
+		return 0
+	}
+
+	for _, tunnel := range response.Tunnels {
+		fmt.Printf("Stopped %s\n", tunnel.Hostname)
+	}
+	if len(response.Tunnels) > 0 {
+		return 0
+	}
+
+	fmt.Println("OK")
+
+	return 0
+}
+
+// decryptFile prints the decrypted contents of a file encrypted with the configured passphrase
+func decryptFile(path string) int {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	plain, err := Decrypt(contents, config.Passphrase)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	os.Stdout.Write(plain)
+
+	return 0
+}
+
+// runState exports the state of a running Hera or imports it from a file
+func runState(args []string) int {
+	if len(args) == 1 && args[0] == "export" {
+		return sendCommand(ControlRequest{Command: "state-export"})
+	}
+
+	if len(args) != 2 || args[0] != "import" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var contents []byte
+	var err error
+	if args[1] == "-" {
+		contents, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		contents, err = afero.ReadFile(fs, args[1])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	state := &State{}
+
+	err = json.Unmarshal(contents, state)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid state: %s\n", err)
+		return 1
+	}
+
+	return sendCommand(ControlRequest{Command: "state-import", State: state})
+}
+
+// encryptFile encrypts a file in place with the configured passphrase
+func encryptFile(path string) int {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if IsEncrypted(contents) {
+		fmt.Fprintf(os.Stderr, "%s is already encrypted\n", path)
+		return 1
+	}
+
+	encrypted, err := Encrypt(contents, config.Passphrase)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	err = afero.WriteFile(fs, path, encrypted, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println("OK")
+
+	return 0
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
@@ -9,40 +13,217 @@ import (
 )
 
 const (
-	Socket     = "unix:///var/run/docker.sock"
-	APIVersion = "v1.22"
+	Socket       = "unix:///var/run/docker.sock"
+	APIVersion   = "v1.22"
+	ExecTimeout  = 30 * time.Second
+	execInterval = 250 * time.Millisecond
+)
+
+var (
+	dockerRequests = NewCounterVec("hera_docker_requests_total", "Number of requests to the Docker API.", "operation")
+	dockerErrors   = NewCounterVec("hera_docker_errors_total", "Number of failed requests to the Docker API.", "operation")
+	dockerDuration = NewHistogramVec("hera_docker_request_duration_seconds", "Duration of requests to the Docker API.", "operation")
+	dockerEventLag = NewHistogramVec("hera_docker_event_lag_seconds", "Time between Docker emitting an event and Hera receiving it.")
 )
 
 // Client holds an instance of the docker client
 type Client struct {
 	DockerClient *client.Client
+	Inspects     *InspectCache
 }
 
-// NewClient returns a new Client or an error if not able to connect to the Docker daemon
+// NewClient returns a new Client for the Docker daemon at DOCKER_HOST, or the Docker socket if it is
+// not set. An error is returned if not able to connect to the Docker daemon.
 func NewClient() (*Client, error) {
-	cli, err := client.NewClient(Socket, APIVersion, nil, nil)
+	host := Socket
+	if env := os.Getenv("DOCKER_HOST"); env != "" {
+		host = env
+	}
+
+	return newClient(host)
+}
+
+// newClient returns a new Client for the Docker daemon at the host
+func newClient(host string) (*Client, error) {
+	cli, err := client.NewClient(host, APIVersion, nil, nil)
+	if err != nil {
+		return nil, NewError(ErrDockerUnavailable, err)
+	}
+
+	_, err = cli.Ping(context.Background())
 	if err != nil {
-		return nil, err
+		return nil, NewError(ErrDockerUnavailable, err)
 	}
 
 	client := &Client{
 		DockerClient: cli,
 	}
 
+	if config.InspectCacheTTL > 0 {
+		client.Inspects = NewInspectCache(config.InspectCacheTTL)
+	}
+
 	return client, nil
 }
 
 // Events returns a channel of Docker events
 func (c *Client) Events() (<-chan events.Message, <-chan error) {
-	return c.DockerClient.Events(context.Background(), types.EventsOptions{})
+	dockerRequests.Inc("events")
+	messages, errs := c.DockerClient.Events(context.Background(), types.EventsOptions{})
+
+	out := make(chan events.Message)
+	outErrs := make(chan error, 1)
+
+	go func() {
+		for {
+			select {
+			case message := <-messages:
+				// Events stamped ahead of Hera's clock are not observed, the daemon's clock is skewed
+				if lag := time.Since(time.Unix(0, message.TimeNano)); message.TimeNano > 0 && lag >= 0 {
+					dockerEventLag.Observe(lag.Seconds())
+				}
+				out <- message
+
+			case err := <-errs:
+				if err != nil && err != io.EOF {
+					dockerErrors.Inc("events")
+					dockerBreaker.Record(err, time.Now())
+				}
+				outErrs <- err
+				return
+			}
+		}
+	}()
+
+	return out, outErrs
 }
 
 // ListContainers returns a collection of Docker containers
 func (c *Client) ListContainers() ([]types.Container, error) {
-	return c.DockerClient.ContainerList(context.Background(), types.ContainerListOptions{})
+	if !dockerBreaker.Allow(time.Now()) {
+		return nil, errDockerPaused
+	}
+	defer observeRequest("list", time.Now())
+
+	containers, err := c.DockerClient.ContainerList(context.Background(), types.ContainerListOptions{})
+	dockerBreaker.Record(err, time.Now())
+	if err != nil {
+		dockerErrors.Inc("list")
+	}
+
+	return containers, categorizeDockerError(err)
 }
 
-// Inspect returns the full information for a container with the given container ID
+// Inspect returns the full information for a container with the given container ID. Recent results are
+// reused when the inspect cache is enabled.
 func (c *Client) Inspect(id string) (types.ContainerJSON, error) {
-	return c.DockerClient.ContainerInspect(context.Background(), id)
+	if c.Inspects != nil {
+		return c.Inspects.Get(id, c.inspect)
+	}
+
+	return c.inspect(id)
+}
+
+// Invalidate discards the cached inspect result for the container with the given ID after it changed
+func (c *Client) Invalidate(id string) {
+	if c.Inspects != nil {
+		c.Inspects.Invalidate(id)
+	}
+}
+
+// inspect requests the full information for a container with the given container ID from the Docker API
+func (c *Client) inspect(id string) (types.ContainerJSON, error) {
+	if !dockerBreaker.Allow(time.Now()) {
+		return types.ContainerJSON{}, errDockerPaused
+	}
+	defer observeRequest("inspect", time.Now())
+
+	container, err := c.DockerClient.ContainerInspect(context.Background(), id)
+	dockerBreaker.Record(err, time.Now())
+	if err != nil {
+		dockerErrors.Inc("inspect")
+	}
+
+	return container, categorizeDockerError(err)
+}
+
+// Ping checks that the Docker daemon is responding
+func (c *Client) Ping() error {
+	defer observeRequest("ping", time.Now())
+
+	_, err := c.DockerClient.Ping(context.Background())
+	dockerBreaker.Record(err, time.Now())
+	if err != nil {
+		dockerErrors.Inc("ping")
+	}
+
+	return categorizeDockerError(err)
+}
+
+// categorizeDockerError categorizes a failed connection to the Docker daemon as ErrDockerUnavailable
+func categorizeDockerError(err error) error {
+	if err != nil && client.IsErrConnectionFailed(err) {
+		return NewError(ErrDockerUnavailable, err)
+	}
+
+	return err
+}
+
+// observeRequest records a request to the Docker API and its duration since start
+func observeRequest(operation string, start time.Time) {
+	dockerRequests.Inc(operation)
+	dockerDuration.Observe(time.Since(start).Seconds(), operation)
+}
+
+// Version returns the version of the Docker daemon
+func (c *Client) Version() (types.Version, error) {
+	defer observeRequest("version", time.Now())
+
+	version, err := c.DockerClient.ServerVersion(context.Background())
+	if err != nil {
+		dockerErrors.Inc("version")
+	}
+
+	return version, categorizeDockerError(err)
+}
+
+// Exec runs a command inside the container with the given ID and returns its exit code.
+// An error is returned if the command cannot be run or does not finish within ExecTimeout.
+func (c *Client) Exec(id string, cmd []string) (code int, err error) {
+	defer observeRequest("exec", time.Now())
+	defer func() {
+		if err != nil {
+			dockerErrors.Inc("exec")
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExecTimeout)
+	defer cancel()
+
+	exec, err := c.DockerClient.ContainerExecCreate(ctx, id, types.ExecConfig{Cmd: cmd})
+	if err != nil {
+		return -1, err
+	}
+
+	err = c.DockerClient.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true})
+	if err != nil {
+		return -1, err
+	}
+
+	for {
+		inspect, err := c.DockerClient.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return -1, err
+		}
+
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return -1, fmt.Errorf("Command timed out in %s", id[:12])
+		case <-time.After(execInterval):
+		}
+	}
 }
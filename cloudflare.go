@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CloudflareAPI     = "https://api.cloudflare.com/client/v4"
+	cloudflareTimeout = 30 * time.Second
+
+	cloudflareAttempts   = 4
+	cloudflareRetryDelay = time.Second
+	cloudflareMaxDelay   = time.Minute
+)
+
+var (
+	// cloudflare is the client for the Cloudflare API, or nil if no API token is configured
+	cloudflare *CloudflareClient
+
+	cloudflareErrors = NewCounterVec("hera_cloudflare_api_errors_total", "Number of failed requests to the Cloudflare API by kind.", "kind")
+
+	// cloudflareAuthCodes are the API error codes of invalid or insufficient credentials
+	cloudflareAuthCodes = map[int]bool{6003: true, 6111: true, 9103: true, 9109: true, 10000: true, 10001: true}
+
+	// cloudflareNotFoundCodes are the API error codes of missing zones and resources
+	cloudflareNotFoundCodes = map[int]bool{1001: true, 7000: true, 7003: true, 81044: true}
+)
+
+// CloudflareClient sends requests to the Cloudflare API for the resources of an account
+type CloudflareClient struct {
+	BaseURL   string
+	Token     string
+	AccountID string
+
+	// RetryDelay is the delay before retrying a request, doubled for every further attempt
+	RetryDelay time.Duration
+
+	client *http.Client
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// NewCloudflareClient returns a CloudflareClient authenticated with the API token
+func NewCloudflareClient(token string, accountID string) *CloudflareClient {
+	client := &CloudflareClient{
+		BaseURL:    CloudflareAPI,
+		Token:      token,
+		AccountID:  accountID,
+		RetryDelay: cloudflareRetryDelay,
+		client:     &http.Client{Timeout: cloudflareTimeout},
+	}
+
+	return client
+}
+
+// newCloudflareClient returns the client selected by the config, or nil if no API token is configured
+func newCloudflareClient(c *Config) *CloudflareClient {
+	if c.CloudflareAPIToken == "" {
+		return nil
+	}
+
+	return NewCloudflareClient(c.CloudflareAPIToken, c.CloudflareAccountID)
+}
+
+// accountPath returns the API path of a resource of the account
+func (c *CloudflareClient) accountPath(path string) string {
+	return fmt.Sprintf("/accounts/%s%s", c.AccountID, path)
+}
+
+// request sends a request to the Cloudflare API and decodes the result of the response into result.
+// Errors are categorized by their cause. Rate limited requests are retried after backing off, as are
+// requests that can safely be repeated when the API is unavailable, while other errors are not retried.
+func (c *CloudflareClient) request(method string, path string, body interface{}, result interface{}) error {
+	delay := c.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := c.send(method, path, body, result)
+		if err == nil {
+			return nil
+		}
+
+		kind := KindOf(err)
+		cloudflareErrors.Inc(string(kind))
+
+		retry := kind == ErrCloudflareRateLimit || (kind == ErrCloudflareUnavailable && (method == "GET" || method == "DELETE"))
+		if !retry || attempt == cloudflareAttempts {
+			return err
+		}
+
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		if delay > cloudflareMaxDelay {
+			delay = cloudflareMaxDelay
+		}
+
+		log.Warningf("%s, retrying in %s (%d/%d)", err, delay, attempt, cloudflareAttempts-1)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send sends a single request to the Cloudflare API and returns the delay the API asked to wait
+// before retrying, if any
+func (c *CloudflareClient) send(method string, path string, body interface{}, result interface{}) (time.Duration, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, &payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, NewError(ErrCloudflareUnavailable, fmt.Errorf("Unable to reach the Cloudflare API: %s", err))
+	}
+	defer resp.Body.Close()
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var envelope cloudflareResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&envelope)
+	if err != nil {
+		err = fmt.Errorf("Unexpected response from the Cloudflare API for %s: %s", strings.Split(path, "?")[0], resp.Status)
+		return retryAfter, NewError(classifyCloudflareError(resp.StatusCode, nil), err)
+	}
+
+	if !envelope.Success {
+		var messages []string
+		var codes []int
+		for _, e := range envelope.Errors {
+			messages = append(messages, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+			codes = append(codes, e.Code)
+		}
+
+		err = fmt.Errorf("Cloudflare API request for %s failed: %s", strings.Split(path, "?")[0], strings.Join(messages, ", "))
+		return retryAfter, NewError(classifyCloudflareError(resp.StatusCode, codes), err)
+	}
+
+	if result == nil {
+		return 0, nil
+	}
+
+	return 0, json.Unmarshal(envelope.Result, result)
+}
+
+// classifyCloudflareError returns the kind of a failed Cloudflare API request from its status code and
+// the codes of its errors
+func classifyCloudflareError(status int, codes []int) ErrorKind {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrCloudflareRateLimit
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrCloudflareAuth
+	case status >= 500:
+		return ErrCloudflareUnavailable
+	}
+
+	for _, code := range codes {
+		switch {
+		case code == 971 || code == 10013:
+			return ErrCloudflareRateLimit
+		case cloudflareAuthCodes[code]:
+			return ErrCloudflareAuth
+		case cloudflareNotFoundCodes[code]:
+			return ErrCloudflareNotFound
+		}
+	}
+
+	if status == http.StatusNotFound {
+		return ErrCloudflareNotFound
+	}
+
+	return ErrCloudflareRequest
+}
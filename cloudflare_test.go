@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyCloudflareError(t *testing.T) {
+	cases := []struct {
+		status int
+		codes  []int
+		kind   ErrorKind
+	}{
+		{http.StatusForbidden, []int{10000}, ErrCloudflareAuth},
+		{http.StatusBadRequest, []int{9109}, ErrCloudflareAuth},
+		{http.StatusTooManyRequests, nil, ErrCloudflareRateLimit},
+		{http.StatusBadRequest, []int{971}, ErrCloudflareRateLimit},
+		{http.StatusBadRequest, []int{7003}, ErrCloudflareNotFound},
+		{http.StatusNotFound, nil, ErrCloudflareNotFound},
+		{http.StatusBadGateway, nil, ErrCloudflareUnavailable},
+		{http.StatusBadRequest, []int{81057}, ErrCloudflareRequest},
+	}
+
+	for _, c := range cases {
+		if kind := classifyCloudflareError(c.status, c.codes); kind != c.kind {
+			t.Errorf("Unexpected kind for %d %v, got %s want %s", c.status, c.codes, kind, c.kind)
+		}
+	}
+}
+
+func TestCloudflareRetries(t *testing.T) {
+	responses := map[string][]int{
+		"/rate-limited": {http.StatusTooManyRequests, http.StatusOK},
+		"/auth":         {http.StatusForbidden, http.StatusOK},
+		"/unavailable":  {http.StatusServiceUnavailable, http.StatusOK},
+	}
+	requests := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := responses[r.URL.Path][requests[r.Method+" "+r.URL.Path]%2]
+		requests[r.Method+" "+r.URL.Path]++
+
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"success": true, "result": {}}`))
+			return
+		}
+
+		w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "Request failed"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewCloudflareClient("token", "account")
+	client.BaseURL = server.URL
+	client.RetryDelay = time.Millisecond
+
+	err := client.request("POST", "/rate-limited", nil, nil)
+	if err != nil || requests["POST /rate-limited"] != 2 {
+		t.Errorf("Expected rate limited request to be retried, got %d requests: %v", requests["POST /rate-limited"], err)
+	}
+
+	err = client.request("GET", "/auth", nil, nil)
+	if KindOf(err) != ErrCloudflareAuth || requests["GET /auth"] != 1 {
+		t.Errorf("Expected auth error without retrying, got %d requests: %v", requests["GET /auth"], err)
+	}
+
+	err = client.request("GET", "/unavailable", nil, nil)
+	if err != nil || requests["GET /unavailable"] != 2 {
+		t.Errorf("Expected GET to be retried while unavailable, got %d requests: %v", requests["GET /unavailable"], err)
+	}
+
+	err = client.request("POST", "/unavailable", nil, nil)
+	if KindOf(err) != ErrCloudflareUnavailable || requests["POST /unavailable"] != 1 {
+		t.Errorf("Expected POST to not be retried while unavailable, got %d requests: %v", requests["POST /unavailable"], err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"os/exec"
 )
 
@@ -16,3 +17,16 @@ func (c Command) Run(name string, arg ...string) ([]byte, error) {
 	out, err := exec.Command(name, arg...).Output()
 	return out, err
 }
+
+// InteractiveCommand runs commands attached to the terminal so the user can follow and respond to them
+type InteractiveCommand struct{}
+
+// Run executes a command attached to the terminal. No output is returned as it is shown to the user.
+func (c InteractiveCommand) Run(name string, arg ...string) ([]byte, error) {
+	cmd := exec.Command(name, arg...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return nil, cmd.Run()
+}
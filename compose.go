@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	heraExposeEphemeral = "hera.expose-ephemeral"
+
+	composeService   = "com.docker.compose.service"
+	composeOneoff    = "com.docker.compose.oneoff"
+	composeDependsOn = "com.docker.compose.depends_on"
+
+	// completedCondition is the depends_on condition of a service that has to run to completion, such as
+	// one that migrates a database, before its dependents start
+	completedCondition = "service_completed_successfully"
+)
+
+// ephemeralReason returns why the container is a short-lived compose container that should not get a
+// tunnel, or an empty string if it is not one. One-off containers of docker compose run are ephemeral,
+// as are init containers that other services of the project wait on to complete. The others are the
+// running containers used to find init containers.
+func ephemeralReason(container types.ContainerJSON, others []types.Container) string {
+	if getLabel(heraExposeEphemeral, container) == "true" {
+		return ""
+	}
+
+	if strings.EqualFold(getLabel(composeOneoff, container), "true") {
+		return "it is a one-off container of docker compose run"
+	}
+
+	project := getLabel(composeProject, container)
+	service := getLabel(composeService, container)
+	if project == "" || service == "" {
+		return ""
+	}
+
+	for _, other := range others {
+		if other.Labels[composeProject] != project || other.Labels[composeService] == service {
+			continue
+		}
+
+		if dependsOnCompletion(other.Labels[composeDependsOn], service) {
+			return fmt.Sprintf("it is an init container of service %s", other.Labels[composeService])
+		}
+	}
+
+	return ""
+}
+
+// dependsOnCompletion returns whether a compose depends_on label, a list of service:condition:restart
+// entries, waits for the service to complete
+func dependsOnCompletion(value string, service string) bool {
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) >= 2 && parts[0] == service && parts[1] == completedCondition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEphemeral returns whether the container is a short-lived compose container, logging why it gets no
+// tunnel if it is
+func (h *Handler) isEphemeral(container types.ContainerJSON) bool {
+	var others []types.Container
+
+	// Init containers can only be told apart by the services waiting on them
+	if h.Client != nil && getLabel(composeService, container) != "" {
+		containers, err := h.Client.ListContainers()
+		if err != nil {
+			log.Debugf("Unable to list containers to find init containers: %s", err)
+		}
+		others = containers
+	}
+
+	reason := ephemeralReason(container, others)
+	if reason == "" {
+		return false
+	}
+
+	log.Infof("Ignoring %s since %s, set %s=true to start its tunnel", container.ID[:12], reason, heraExposeEphemeral)
+
+	return true
+}
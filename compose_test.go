@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestEphemeralReason(t *testing.T) {
+	others := []types.Container{
+		{Labels: map[string]string{composeProject: "shop", composeService: "web", composeDependsOn: "db:service_healthy:false,migrate:service_completed_successfully:false"}},
+		{Labels: map[string]string{composeProject: "blog", composeService: "web", composeDependsOn: "setup:service_completed_successfully:false"}},
+	}
+
+	cases := []struct {
+		labels   map[string]string
+		expected string
+	}{
+		{map[string]string{composeProject: "shop", composeService: "web"}, ""},
+		{map[string]string{composeProject: "shop", composeService: "web", composeOneoff: "True"}, "one-off container"},
+		{map[string]string{composeProject: "shop", composeService: "migrate"}, "init container of service web"},
+		{map[string]string{composeProject: "shop", composeService: "db"}, ""},
+		{map[string]string{composeProject: "shop", composeService: "setup"}, ""},
+		{map[string]string{composeProject: "shop", composeService: "migrate", heraExposeEphemeral: "true"}, ""},
+		{map[string]string{composeProject: "shop", composeService: "web", composeOneoff: "True", heraExposeEphemeral: "true"}, ""},
+	}
+
+	for _, c := range cases {
+		reason := ephemeralReason(newTenantContainer(c.labels), others)
+
+		if (c.expected == "") != (reason == "") || !strings.Contains(reason, c.expected) {
+			t.Errorf("Unexpected reason for %v, want %q got %q", c.labels, c.expected, reason)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ModeManage  = "manage"
+	ModeObserve = "observe"
+)
+
+var (
+	config = NewConfig()
+)
+
+// Config holds the settings Hera is configured with through the environment
+type Config struct {
+	Mode            string
+	LeaderLock      string
+	LeaderTTL       time.Duration
+	APIAddress      string
+	APIToken        string
+	MetricsAddress  string
+	DebugAddress    string
+	ControlSocket   string
+	DefaultProtocol string
+	DefaultPort     string
+	DetectProtocol  bool
+	SmokeTest       bool
+	DNSCheck        string
+	Announce        bool
+
+	MaintenancePage   string
+	MaintenanceStatus int
+
+	ProxyDNS          bool
+	ProxyDNSAddress   string
+	ProxyDNSPort      string
+	ProxyDNSUpstreams []string
+
+	ResolverAddress string
+	ResolverTimeout time.Duration
+
+	DenyHostnames []string
+	AllowDomains  []string
+	Tenants       map[string][]string
+
+	// TenantNetworks maps each tenant to the Docker networks whose containers belong to it
+	TenantNetworks map[string][]string
+
+	EventBuffer   int
+	EventOverflow string
+
+	InspectCacheTTL time.Duration
+
+	DriftInterval  time.Duration
+	DriftRemediate bool
+
+	PoolSize int
+	PoolName string
+
+	LowMemory         bool
+	MaxTunnels        int
+	CertWatchInterval time.Duration
+
+	CertRotationStagger time.Duration
+
+	CloudflaredConfig     string
+	OriginResolveInterval time.Duration
+
+	TunnelTTL time.Duration
+
+	CertificateSource string
+	VaultAddress      string
+	VaultPath         string
+	VaultToken        string
+	VaultRoleID       string
+	VaultSecretID     string
+	VaultCacheTTL     time.Duration
+
+	Passphrase     string
+	PassphraseFile string
+
+	EnvLabels bool
+
+	HTTPSProxy string
+	HTTPProxy  string
+	NoProxy    string
+
+	CloudflareAPIToken  string
+	CloudflareAccountID string
+
+	AdHocTunnels bool
+	AdHocMaxTTL  time.Duration
+
+	RestartKeepAlive time.Duration
+
+	DomainDefaults string
+
+	LogFormat          string
+	LogSummaryInterval time.Duration
+
+	HostsFile string
+
+	// StaticRoot is the directory hera.static-dir labels must be within, static directories are refused if it is not set
+	StaticRoot string
+
+	NotifySlackWebhook   string
+	NotifySlackEvents    []string
+	NotifyDiscordWebhook string
+	NotifyDiscordEvents  []string
+	NotifyTelegramToken  string
+	NotifyTelegramChatID string
+	NotifyTelegramEvents []string
+	NotifySMTPAddress    string
+	NotifySMTPUsername   string
+	NotifySMTPPassword   string
+	NotifyEmailFrom      string
+	NotifyEmailTo        []string
+	NotifyEmailEvents    []string
+	NotifyTemplates      map[string]string
+	NotifyRateLimit      time.Duration
+}
+
+// NewConfig returns a Config with default settings
+func NewConfig() *Config {
+	config := &Config{
+		Mode:            ModeManage,
+		LeaderTTL:       15 * time.Second,
+		APIAddress:      ":8080",
+		ControlSocket:   "/var/run/hera.sock",
+		DefaultProtocol: "http",
+
+		MaintenanceStatus: http.StatusServiceUnavailable,
+
+		ProxyDNSAddress:   "0.0.0.0",
+		ProxyDNSPort:      "53",
+		ProxyDNSUpstreams: []string{"https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"},
+
+		ResolverTimeout: 5 * time.Second,
+
+		EventBuffer:   1024,
+		EventOverflow: "block",
+
+		InspectCacheTTL: 2 * time.Second,
+
+		DriftInterval: time.Minute,
+
+		CertWatchInterval: 5 * time.Second,
+
+		CertRotationStagger: 10 * time.Second,
+
+		OriginResolveInterval: time.Minute,
+
+		AdHocMaxTTL: 24 * time.Hour,
+
+		RestartKeepAlive: 30 * time.Second,
+
+		LogFormat:          LogFormatAuto,
+		LogSummaryInterval: time.Minute,
+
+		PoolName: "hera",
+
+		NotifyTemplates: map[string]string{},
+		NotifyRateLimit: 5 * time.Minute,
+	}
+
+	return config
+}
+
+// applyLowMemory tunes the defaults for devices with little memory by polling less often, capping the
+// number of tunnels, and only starting cloudflared once the origin is reachable
+func (c *Config) applyLowMemory() {
+	c.LowMemory = true
+	c.MaxTunnels = 5
+	c.EventBuffer = 64
+	c.DriftInterval = 10 * time.Minute
+	c.CertWatchInterval = 30 * time.Second
+}
+
+// LoadConfig returns a Config with default settings overridden by environment variables
+func LoadConfig() *Config {
+	config := NewConfig()
+
+	if os.Getenv("HERA_LOW_MEMORY") == "true" {
+		config.applyLowMemory()
+	}
+
+	if mode := os.Getenv("HERA_MODE"); mode != "" {
+		config.Mode = mode
+	}
+
+	config.LeaderLock = os.Getenv("HERA_LEADER_LOCK")
+
+	if ttl, err := time.ParseDuration(os.Getenv("HERA_LEADER_TTL")); err == nil && ttl > 0 {
+		config.LeaderTTL = ttl
+	}
+
+	// An empty address disables the API, so only override when the variable is set
+	if address, ok := os.LookupEnv("HERA_API_ADDRESS"); ok {
+		config.APIAddress = address
+	}
+
+	config.APIToken = os.Getenv("HERA_API_TOKEN")
+	config.MetricsAddress = os.Getenv("HERA_METRICS_ADDRESS")
+	config.DebugAddress = os.Getenv("HERA_DEBUG_ADDRESS")
+
+	if socket, ok := os.LookupEnv("HERA_CONTROL_SOCKET"); ok {
+		config.ControlSocket = socket
+	}
+
+	if protocol := os.Getenv("HERA_DEFAULT_PROTOCOL"); protocol != "" {
+		config.DefaultProtocol = protocol
+	}
+
+	if port := os.Getenv("HERA_DEFAULT_PORT"); port != "" {
+		config.DefaultPort = port
+	}
+
+	config.DetectProtocol = os.Getenv("HERA_DETECT_PROTOCOL") == "true"
+	config.SmokeTest = os.Getenv("HERA_SMOKE_TEST") == "true"
+	config.DNSCheck = os.Getenv("HERA_DNS_CHECK")
+	config.Announce = os.Getenv("HERA_ANNOUNCE") == "true"
+
+	if size, err := strconv.Atoi(os.Getenv("HERA_POOL_SIZE")); err == nil && size > 0 {
+		config.PoolSize = size
+	}
+
+	if name := os.Getenv("HERA_POOL_NAME"); name != "" {
+		config.PoolName = name
+	}
+
+	config.MaintenancePage = os.Getenv("HERA_MAINTENANCE_PAGE")
+
+	if status, err := strconv.Atoi(os.Getenv("HERA_MAINTENANCE_STATUS")); err == nil && status >= 100 && status <= 599 {
+		config.MaintenanceStatus = status
+	}
+
+	config.ProxyDNS = os.Getenv("HERA_PROXY_DNS") == "true"
+
+	if address := os.Getenv("HERA_PROXY_DNS_ADDRESS"); address != "" {
+		config.ProxyDNSAddress = address
+	}
+
+	if port := os.Getenv("HERA_PROXY_DNS_PORT"); port != "" {
+		config.ProxyDNSPort = port
+	}
+
+	if upstreams := os.Getenv("HERA_PROXY_DNS_UPSTREAM"); upstreams != "" {
+		config.ProxyDNSUpstreams = splitList(upstreams)
+	}
+
+	config.ResolverAddress = os.Getenv("HERA_RESOLVER")
+
+	if timeout, err := time.ParseDuration(os.Getenv("HERA_RESOLVER_TIMEOUT")); err == nil && timeout > 0 {
+		config.ResolverTimeout = timeout
+	}
+
+	config.DenyHostnames = splitList(os.Getenv("HERA_DENY_HOSTNAMES"))
+	config.AllowDomains = splitList(os.Getenv("HERA_ALLOW_DOMAINS"))
+	config.Tenants = parseTenants(os.Getenv("HERA_TENANTS"))
+	config.TenantNetworks = parseTenants(os.Getenv("HERA_TENANT_NETWORKS"))
+
+	if size, err := strconv.Atoi(os.Getenv("HERA_EVENT_BUFFER")); err == nil && size > 0 {
+		config.EventBuffer = size
+	}
+
+	if overflow := os.Getenv("HERA_EVENT_OVERFLOW"); overflow != "" {
+		config.EventOverflow = overflow
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("HERA_INSPECT_CACHE_TTL")); err == nil && ttl >= 0 {
+		config.InspectCacheTTL = ttl
+	}
+
+	// A zero interval disables drift detection, so only override when the variable is set
+	if interval, err := time.ParseDuration(os.Getenv("HERA_DRIFT_INTERVAL")); err == nil {
+		config.DriftInterval = interval
+	}
+
+	config.DriftRemediate = os.Getenv("HERA_DRIFT_REMEDIATE") == "true"
+
+	// Zero removes the cap on tunnels, so only override when the variable is set
+	if limit, err := strconv.Atoi(os.Getenv("HERA_MAX_TUNNELS")); err == nil && limit >= 0 {
+		config.MaxTunnels = limit
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("HERA_CERT_WATCH_INTERVAL")); err == nil && interval > 0 {
+		config.CertWatchInterval = interval
+	}
+
+	if stagger, err := time.ParseDuration(os.Getenv("HERA_CERT_ROTATION_STAGGER")); err == nil && stagger >= 0 {
+		config.CertRotationStagger = stagger
+	}
+
+	config.CloudflaredConfig = os.Getenv("HERA_CLOUDFLARED_CONFIG")
+
+	if interval, err := time.ParseDuration(os.Getenv("HERA_ORIGIN_RESOLVE_INTERVAL")); err == nil && interval > 0 {
+		config.OriginResolveInterval = interval
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("HERA_TUNNEL_TTL")); err == nil && ttl > 0 {
+		config.TunnelTTL = ttl
+	}
+
+	config.CertificateSource = os.Getenv("HERA_CERT_SOURCE")
+	config.VaultAddress = firstEnv("HERA_VAULT_ADDR", "VAULT_ADDR")
+	config.VaultPath = os.Getenv("HERA_VAULT_PATH")
+	config.VaultToken = firstEnv("HERA_VAULT_TOKEN", "VAULT_TOKEN")
+	config.VaultRoleID = os.Getenv("HERA_VAULT_ROLE_ID")
+	config.VaultSecretID = os.Getenv("HERA_VAULT_SECRET_ID")
+
+	if ttl, err := time.ParseDuration(os.Getenv("HERA_VAULT_CACHE_TTL")); err == nil && ttl > 0 {
+		config.VaultCacheTTL = ttl
+	}
+
+	config.Passphrase = os.Getenv("HERA_PASSPHRASE")
+	config.PassphraseFile = os.Getenv("HERA_PASSPHRASE_FILE")
+
+	config.EnvLabels = os.Getenv("HERA_ENV_LABELS") == "true"
+
+	config.HTTPSProxy = firstEnv("HTTPS_PROXY", "https_proxy")
+	config.HTTPProxy = firstEnv("HTTP_PROXY", "http_proxy")
+	config.NoProxy = firstEnv("NO_PROXY", "no_proxy")
+
+	config.CloudflareAPIToken = firstEnv("HERA_CLOUDFLARE_API_TOKEN", "CF_API_TOKEN")
+	config.CloudflareAccountID = os.Getenv("HERA_CLOUDFLARE_ACCOUNT_ID")
+
+	config.AdHocTunnels = os.Getenv("HERA_ADHOC_TUNNELS") == "true"
+
+	if ttl, err := time.ParseDuration(os.Getenv("HERA_ADHOC_MAX_TTL")); err == nil && ttl >= 0 {
+		config.AdHocMaxTTL = ttl
+	}
+
+	config.DomainDefaults = os.Getenv("HERA_DOMAIN_DEFAULTS")
+
+	switch format := os.Getenv("HERA_LOG_FORMAT"); format {
+	case LogFormatConsole, LogFormatPlain, LogFormatJSON:
+		config.LogFormat = format
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("HERA_LOG_SUMMARY_INTERVAL")); err == nil && interval >= 0 {
+		config.LogSummaryInterval = interval
+	}
+
+	if window, err := time.ParseDuration(os.Getenv("HERA_RESTART_KEEPALIVE")); err == nil && window >= 0 {
+		config.RestartKeepAlive = window
+	}
+
+	config.HostsFile = os.Getenv("HERA_HOSTS_FILE")
+	config.StaticRoot = os.Getenv("HERA_STATIC_ROOT")
+
+	config.NotifySlackWebhook = os.Getenv("HERA_NOTIFY_SLACK_WEBHOOK")
+	config.NotifySlackEvents = splitList(os.Getenv("HERA_NOTIFY_SLACK_EVENTS"))
+	config.NotifyDiscordWebhook = os.Getenv("HERA_NOTIFY_DISCORD_WEBHOOK")
+	config.NotifyDiscordEvents = splitList(os.Getenv("HERA_NOTIFY_DISCORD_EVENTS"))
+	config.NotifyTelegramToken = os.Getenv("HERA_NOTIFY_TELEGRAM_TOKEN")
+	config.NotifyTelegramChatID = os.Getenv("HERA_NOTIFY_TELEGRAM_CHAT_ID")
+	config.NotifyTelegramEvents = splitList(os.Getenv("HERA_NOTIFY_TELEGRAM_EVENTS"))
+	config.NotifySMTPAddress = os.Getenv("HERA_NOTIFY_SMTP_ADDRESS")
+	config.NotifySMTPUsername = os.Getenv("HERA_NOTIFY_SMTP_USERNAME")
+	config.NotifySMTPPassword = os.Getenv("HERA_NOTIFY_SMTP_PASSWORD")
+	config.NotifyEmailFrom = os.Getenv("HERA_NOTIFY_EMAIL_FROM")
+	config.NotifyEmailTo = splitList(os.Getenv("HERA_NOTIFY_EMAIL_TO"))
+	config.NotifyEmailEvents = splitList(os.Getenv("HERA_NOTIFY_EMAIL_EVENTS"))
+
+	for _, event := range notifyEvents {
+		if text := os.Getenv("HERA_NOTIFY_TEMPLATE_" + strings.ToUpper(event)); text != "" {
+			config.NotifyTemplates[event] = text
+		}
+	}
+
+	if limit, err := time.ParseDuration(os.Getenv("HERA_NOTIFY_RATE_LIMIT")); err == nil && limit >= 0 {
+		config.NotifyRateLimit = limit
+	}
+
+	return config
+}
+
+// IsObserving returns whether Hera only reports the tunnels it would manage without starting cloudflared,
+// either because it is in observe mode or because it is the standby of another instance
+func (c *Config) IsObserving() bool {
+	return c.Mode == ModeObserve || (elector != nil && !elector.IsLeader())
+}
+
+// splitList returns the trimmed, non-empty values of a comma separated list
+func splitList(value string) []string {
+	var values []string
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// Summary returns the active settings by their environment variable names
+func (c *Config) Summary() map[string]string {
+	summary := map[string]string{
+		"HERA_MODE":                    c.Mode,
+		"HERA_LEADER_LOCK":             c.LeaderLock,
+		"HERA_LEADER_TTL":              c.LeaderTTL.String(),
+		"HERA_API_ADDRESS":             c.APIAddress,
+		"HERA_METRICS_ADDRESS":         c.MetricsAddress,
+		"HERA_DEBUG_ADDRESS":           c.DebugAddress,
+		"HERA_CONTROL_SOCKET":          c.ControlSocket,
+		"HERA_DEFAULT_PROTOCOL":        c.DefaultProtocol,
+		"HERA_DEFAULT_PORT":            c.DefaultPort,
+		"HERA_DETECT_PROTOCOL":         strconv.FormatBool(c.DetectProtocol),
+		"HERA_SMOKE_TEST":              strconv.FormatBool(c.SmokeTest),
+		"HERA_DNS_CHECK":               c.DNSCheck,
+		"HERA_ANNOUNCE":                strconv.FormatBool(c.Announce),
+		"HERA_POOL_SIZE":               strconv.Itoa(c.PoolSize),
+		"HERA_POOL_NAME":               c.PoolName,
+		"HERA_MAINTENANCE_PAGE":        c.MaintenancePage,
+		"HERA_MAINTENANCE_STATUS":      strconv.Itoa(c.MaintenanceStatus),
+		"HERA_PROXY_DNS":               strconv.FormatBool(c.ProxyDNS),
+		"HERA_RESOLVER":                c.ResolverAddress,
+		"HERA_RESOLVER_TIMEOUT":        c.ResolverTimeout.String(),
+		"HERA_DENY_HOSTNAMES":          strings.Join(c.DenyHostnames, ","),
+		"HERA_ALLOW_DOMAINS":           strings.Join(c.AllowDomains, ","),
+		"HERA_TENANTS":                 formatTenants(c.Tenants),
+		"HERA_TENANT_NETWORKS":         formatTenants(c.TenantNetworks),
+		"HERA_EVENT_BUFFER":            strconv.Itoa(c.EventBuffer),
+		"HERA_EVENT_OVERFLOW":          c.EventOverflow,
+		"HERA_INSPECT_CACHE_TTL":       c.InspectCacheTTL.String(),
+		"HERA_DRIFT_INTERVAL":          c.DriftInterval.String(),
+		"HERA_DRIFT_REMEDIATE":         strconv.FormatBool(c.DriftRemediate),
+		"HERA_LOW_MEMORY":              strconv.FormatBool(c.LowMemory),
+		"HERA_MAX_TUNNELS":             strconv.Itoa(c.MaxTunnels),
+		"HERA_CERT_WATCH_INTERVAL":     c.CertWatchInterval.String(),
+		"HERA_CERT_ROTATION_STAGGER":   c.CertRotationStagger.String(),
+		"HERA_CLOUDFLARED_CONFIG":      c.CloudflaredConfig,
+		"HERA_ORIGIN_RESOLVE_INTERVAL": c.OriginResolveInterval.String(),
+		"HERA_TUNNEL_TTL":              c.TunnelTTL.String(),
+		"HERA_CERT_SOURCE":             c.CertificateSource,
+		"HERA_ENV_LABELS":              strconv.FormatBool(c.EnvLabels),
+		"HTTPS_PROXY":                  redactProxy(c.HTTPSProxy),
+		"HTTP_PROXY":                   redactProxy(c.HTTPProxy),
+		"NO_PROXY":                     c.NoProxy,
+		"HERA_CLOUDFLARE_ACCOUNT_ID":   c.CloudflareAccountID,
+		"HERA_ADHOC_TUNNELS":           strconv.FormatBool(c.AdHocTunnels),
+		"HERA_ADHOC_MAX_TTL":           c.AdHocMaxTTL.String(),
+		"HERA_RESTART_KEEPALIVE":       c.RestartKeepAlive.String(),
+		"HERA_DOMAIN_DEFAULTS":         c.DomainDefaults,
+		"HERA_LOG_FORMAT":              c.LogFormat,
+		"HERA_LOG_SUMMARY_INTERVAL":    c.LogSummaryInterval.String(),
+		"HERA_HOSTS_FILE":              c.HostsFile,
+		"HERA_STATIC_ROOT":             c.StaticRoot,
+		"HERA_NOTIFY_RATE_LIMIT":       c.NotifyRateLimit.String(),
+	}
+
+	// Credentials are left out so the summary can be shared
+	if c.CertificateSource == "vault" {
+		summary["HERA_VAULT_ADDR"] = c.VaultAddress
+		summary["HERA_VAULT_PATH"] = c.VaultPath
+	}
+
+	if c.ProxyDNS {
+		summary["HERA_PROXY_DNS_ADDRESS"] = c.ProxyDNSAddress
+		summary["HERA_PROXY_DNS_PORT"] = c.ProxyDNSPort
+		summary["HERA_PROXY_DNS_UPSTREAM"] = strings.Join(c.ProxyDNSUpstreams, ",")
+	}
+
+	if c.NotifySMTPAddress != "" {
+		summary["HERA_NOTIFY_SMTP_ADDRESS"] = c.NotifySMTPAddress
+		summary["HERA_NOTIFY_EMAIL_FROM"] = c.NotifyEmailFrom
+		summary["HERA_NOTIFY_EMAIL_TO"] = strings.Join(c.NotifyEmailTo, ",")
+	}
+
+	return summary
+}
+
+// formatTenants formats a tenant mapping in the form it is configured with
+func formatTenants(tenants map[string][]string) string {
+	var entries []string
+	for tenant, domains := range tenants {
+		entries = append(entries, tenant+"="+strings.Join(domains, ","))
+	}
+	sort.Strings(entries)
+
+	return strings.Join(entries, ";")
+}
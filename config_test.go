@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	os.Unsetenv("HERA_DEFAULT_PROTOCOL")
+	os.Unsetenv("HERA_DEFAULT_PORT")
+
+	config := LoadConfig()
+
+	if config.DefaultProtocol != "http" {
+		t.Errorf("Unexpected default protocol, got %s", config.DefaultProtocol)
+	}
+
+	if config.DefaultPort != "" {
+		t.Errorf("Unexpected default port, got %s", config.DefaultPort)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	os.Setenv("HERA_DEFAULT_PROTOCOL", "https")
+	os.Setenv("HERA_DEFAULT_PORT", "8443")
+	defer os.Unsetenv("HERA_DEFAULT_PROTOCOL")
+	defer os.Unsetenv("HERA_DEFAULT_PORT")
+
+	config := LoadConfig()
+
+	if config.DefaultProtocol != "https" {
+		t.Errorf("Unexpected default protocol, got %s", config.DefaultProtocol)
+	}
+
+	if config.DefaultPort != "8443" {
+		t.Errorf("Unexpected default port, got %s", config.DefaultPort)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	values := splitList(" https://1.1.1.1/dns-query, ,https://1.0.0.1/dns-query ")
+
+	if len(values) != 2 || values[0] != "https://1.1.1.1/dns-query" || values[1] != "https://1.0.0.1/dns-query" {
+		t.Errorf("Unexpected values, got %v", values)
+	}
+}
+
+func TestLoadConfigLowMemory(t *testing.T) {
+	os.Setenv("HERA_LOW_MEMORY", "true")
+	os.Setenv("HERA_MAX_TUNNELS", "2")
+	defer os.Unsetenv("HERA_LOW_MEMORY")
+	defer os.Unsetenv("HERA_MAX_TUNNELS")
+
+	config := LoadConfig()
+
+	if !config.LowMemory || config.EventBuffer != 64 {
+		t.Errorf("Expected low memory defaults, got %+v", config)
+	}
+
+	if config.MaxTunnels != 2 {
+		t.Errorf("Unexpected max tunnels, got %d", config.MaxTunnels)
+	}
+}
+
+func TestLoadConfigResolverTimeout(t *testing.T) {
+	os.Setenv("HERA_RESOLVER_TIMEOUT", "0s")
+	defer os.Unsetenv("HERA_RESOLVER_TIMEOUT")
+
+	if config := LoadConfig(); config.ResolverTimeout != 5*time.Second {
+		t.Errorf("Expected the default timeout for a zero timeout, got %s", config.ResolverTimeout)
+	}
+
+	os.Setenv("HERA_RESOLVER_TIMEOUT", "2s")
+
+	if config := LoadConfig(); config.ResolverTimeout != 2*time.Second {
+		t.Errorf("Unexpected resolver timeout, got %s", config.ResolverTimeout)
+	}
+}
+
+func TestLoadConfigMaintenanceStatus(t *testing.T) {
+	os.Setenv("HERA_MAINTENANCE_STATUS", "1000")
+	defer os.Unsetenv("HERA_MAINTENANCE_STATUS")
+
+	if config := LoadConfig(); config.MaintenanceStatus != http.StatusServiceUnavailable {
+		t.Errorf("Expected the default status for an invalid status, got %d", config.MaintenanceStatus)
+	}
+
+	os.Setenv("HERA_MAINTENANCE_STATUS", "200")
+
+	if config := LoadConfig(); config.MaintenanceStatus != http.StatusOK {
+		t.Errorf("Unexpected maintenance status, got %d", config.MaintenanceStatus)
+	}
+}
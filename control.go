@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ControlServer accepts commands on a unix socket so Hera can be driven by scripts and other containers.
+// Each line sent to the socket is a JSON ControlRequest and is answered with a JSON ControlResponse.
+type ControlServer struct {
+	Handler  *Handler
+	Registry *Registry
+}
+
+// ControlRequest is a command sent to the control socket
+type ControlRequest struct {
+	Command  string `json:"command"`
+	Hostname string `json:"hostname,omitempty"`
+	Project  string `json:"project,omitempty"`
+	Format   string `json:"format,omitempty"`
+	State    *State `json:"state,omitempty"`
+}
+
+// ControlResponse is the result of a command sent to the control socket
+type ControlResponse struct {
+	OK      bool              `json:"ok"`
+	Error   string            `json:"error,omitempty"`
+	Tunnels []*TunnelResponse `json:"tunnels,omitempty"`
+	Export  string            `json:"export,omitempty"`
+	Config  EffectiveConfig   `json:"config,omitempty"`
+	State   *State            `json:"state,omitempty"`
+	Report  []string          `json:"report,omitempty"`
+}
+
+// SendControlRequest sends a command to the control socket at the given address and returns its response
+func SendControlRequest(address string, request ControlRequest) (*ControlResponse, error) {
+	conn, err := dialAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ControlResponse{}
+
+	err = json.NewDecoder(conn).Decode(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// NewControlServer returns a new ControlServer
+func NewControlServer(handler *Handler, registry *Registry) *ControlServer {
+	server := &ControlServer{
+		Handler:  handler,
+		Registry: registry,
+	}
+
+	return server
+}
+
+// ListenAndServe listens on the unix socket and serves commands until the listener fails. TCP addresses
+// are refused, since commands are not authenticated and access is only limited by the permissions of the socket.
+func (c *ControlServer) ListenAndServe(address string) error {
+	if network, _ := splitAddress(address); network != "unix" {
+		return fmt.Errorf("The control socket must be a unix socket, got %s", address)
+	}
+
+	listener, err := listenAddress(address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	log.Infof("Control socket listening on %s", address)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go c.serveConn(conn)
+	}
+}
+
+// serveConn answers the commands sent on a connection until it is closed
+func (c *ControlServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	for {
+		var request ControlRequest
+
+		err := decoder.Decode(&request)
+		if err == io.EOF {
+			return
+		}
+
+		// The stream cannot be recovered after invalid input, so respond and close the connection
+		if err != nil {
+			encoder.Encode(&ControlResponse{Error: fmt.Sprintf("Invalid request: %s", err)})
+			return
+		}
+
+		err = encoder.Encode(c.execute(request))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// execute runs a single command and returns its response. Commands changing tunnels run on the event
+// loop, since tunnels and the registry are only changed there.
+func (c *ControlServer) execute(request ControlRequest) *ControlResponse {
+	var err error
+	response := &ControlResponse{}
+
+	switch request.Command {
+	case "list":
+		response.Tunnels = []*TunnelResponse{}
+		for _, tunnel := range c.Registry.List() {
+			response.Tunnels = append(response.Tunnels, newTunnelResponse(tunnel))
+		}
+
+	case "stop":
+		eventLoop.Do(func() {
+			if request.Project != "" {
+				response.Tunnels, err = c.stopProject(request.Project)
+				return
+			}
+
+			err = c.stop(request.Hostname)
+		})
+
+	case "start":
+		eventLoop.Do(func() {
+			response.Tunnels, err = c.startProject(request.Project)
+		})
+
+	case "restart":
+		eventLoop.Do(func() {
+			err = c.restart(request.Hostname)
+		})
+
+	case "reload":
+		eventLoop.Do(func() {
+			err = c.reload(request.Hostname)
+		})
+
+	case "export":
+		response.Export, err = Export(c.Registry.List(), request.Format)
+
+	case "config":
+		response.Config, err = c.effectiveConfig(request.Hostname)
+
+	case "state-export":
+		response.State = ExportState(c.Registry.List(), time.Now())
+
+	case "state-import":
+		eventLoop.Do(func() {
+			response.Report, err = c.Handler.ImportState(request.State, time.Now())
+		})
+
+	case "pause", "unpause":
+		eventLoop.Do(func() {
+			_, err = SetMaintenance(c.Registry, request.Hostname, request.Command == "pause")
+		})
+
+	default:
+		err = fmt.Errorf("Unknown command: %s", request.Command)
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+		return response
+	}
+
+	response.OK = true
+
+	return response
+}
+
+// stop stops the tunnel for the hostname and removes it from the registry
+func (c *ControlServer) stop(hostname string) error {
+	tunnel, err := c.Registry.FindByHostname(hostname)
+	if err != nil {
+		return err
+	}
+
+	_, err = tunnel.Stop()
+	if err != nil {
+		return err
+	}
+
+	c.Registry.Remove(tunnel)
+
+	return nil
+}
+
+// stopProject stops the tunnels of the compose project and returns them
+func (c *ControlServer) stopProject(project string) ([]*TunnelResponse, error) {
+	stopped, err := StopProject(c.Registry, project)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnels := []*TunnelResponse{}
+	for _, tunnel := range stopped {
+		tunnels = append(tunnels, newTunnelResponse(tunnel))
+	}
+
+	return tunnels, nil
+}
+
+// startProject starts the tunnels of a stopped compose project again and returns them
+func (c *ControlServer) startProject(project string) ([]*TunnelResponse, error) {
+	started, err := c.Handler.StartProject(c.Registry, project)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnels := []*TunnelResponse{}
+	for _, tunnel := range started {
+		tunnels = append(tunnels, newTunnelResponse(tunnel))
+	}
+
+	return tunnels, nil
+}
+
+// effectiveConfig returns the resolved settings of the tunnel for the hostname
+func (c *ControlServer) effectiveConfig(hostname string) (EffectiveConfig, error) {
+	tunnel, err := c.Registry.FindByHostname(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	if tunnel.Effective == nil {
+		return nil, fmt.Errorf("Tunnel %s was not created from container labels", hostname)
+	}
+
+	return tunnel.Effective, nil
+}
+
+// restart restarts the tunnel process for the hostname with its current config
+func (c *ControlServer) restart(hostname string) error {
+	tunnel, err := c.Registry.FindByHostname(hostname)
+	if err != nil {
+		return err
+	}
+
+	if config.IsObserving() {
+		return fmt.Errorf("Unable to restart tunnel %s: Hera is observing and does not run cloudflared", hostname)
+	}
+
+	log.Infof("Restarting tunnel %s", hostname)
+
+	return tunnel.Service.Restart()
+}
+
+// reload recreates the tunnel for the hostname from its container's current labels.
+// All tunnels are reloaded if no hostname is given.
+func (c *ControlServer) reload(hostname string) error {
+	tunnels := c.Registry.List()
+
+	if hostname != "" {
+		tunnel, err := c.Registry.FindByHostname(hostname)
+		if err != nil {
+			return err
+		}
+
+		tunnels = []*Tunnel{tunnel}
+	}
+
+	for _, tunnel := range tunnels {
+		if tunnel.ContainerID == "" {
+			continue
+		}
+
+		log.Infof("Reloading tunnel %s", tunnel.Config.Hostname)
+
+		err := c.Handler.HandleContainer(tunnel.ContainerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
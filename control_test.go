@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func sendControlRequest(t *testing.T, server *ControlServer, request string) *ControlResponse {
+	client, conn := net.Pipe()
+	defer client.Close()
+	defer serveEventLoop()()
+
+	go server.serveConn(conn)
+
+	_, err := client.Write([]byte(request + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(client).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := &ControlResponse{}
+	err = json.Unmarshal(line, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+func TestControlList(t *testing.T) {
+	r := NewRegistry()
+	r.Add(newRegistryTunnel("site.tld", "container-a"))
+	server := NewControlServer(nil, r)
+
+	response := sendControlRequest(t, server, `{"command":"list"}`)
+	if !response.OK {
+		t.Fatalf("Unexpected error: %s", response.Error)
+	}
+
+	if len(response.Tunnels) != 1 || response.Tunnels[0].Hostname != "site.tld" {
+		t.Errorf("Unexpected tunnels, got %v", response.Tunnels)
+	}
+}
+
+func TestControlStop(t *testing.T) {
+	r := NewRegistry()
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(""), nil
+		},
+	}
+	r.Add(tunnel)
+	server := NewControlServer(nil, r)
+
+	response := sendControlRequest(t, server, `{"command":"stop","hostname":"site.tld"}`)
+	if !response.OK {
+		t.Fatalf("Unexpected error: %s", response.Error)
+	}
+
+	if len(r.List()) != 0 {
+		t.Error("Expected tunnel to be removed")
+	}
+
+	response = sendControlRequest(t, server, `{"command":"stop","hostname":"site.tld"}`)
+	if response.OK || response.Error == "" {
+		t.Error("Expected error for unknown hostname")
+	}
+}
+
+func TestControlStopProject(t *testing.T) {
+	r := NewRegistry()
+	for _, hostname := range []string{"a.site.tld", "b.site.tld", "other.tld"} {
+		tunnel := newRegistryTunnel(hostname, "container-"+hostname)
+		tunnel.Project = "myapp"
+		if hostname == "other.tld" {
+			tunnel.Project = "other"
+		}
+		tunnel.Service.Commander = &MockCommander{
+			mockRun: func() ([]byte, error) {
+				return []byte(""), nil
+			},
+		}
+		r.Add(tunnel)
+	}
+	server := NewControlServer(nil, r)
+
+	response := sendControlRequest(t, server, `{"command":"stop","project":"myapp"}`)
+	if !response.OK {
+		t.Fatalf("Unexpected error: %s", response.Error)
+	}
+
+	if len(response.Tunnels) != 2 {
+		t.Errorf("Expected 2 stopped tunnels, got %d", len(response.Tunnels))
+	}
+
+	if tunnels := r.List(); len(tunnels) != 1 || tunnels[0].Config.Hostname != "other.tld" {
+		t.Error("Expected only the tunnels of the project to be removed")
+	}
+
+	if !r.IsProjectStopped("myapp") || r.IsProjectStopped("other") {
+		t.Error("Expected only the project to be marked as stopped")
+	}
+
+	response = sendControlRequest(t, server, `{"command":"start","project":"other"}`)
+	if response.OK {
+		t.Error("Expected error for starting a project that is not stopped")
+	}
+
+	response = sendControlRequest(t, server, `{"command":"stop","project":"myapp"}`)
+	if response.OK {
+		t.Error("Expected error for a project without tunnels")
+	}
+}
+
+func TestControlInvalidRequests(t *testing.T) {
+	server := NewControlServer(nil, NewRegistry())
+
+	response := sendControlRequest(t, server, `{"command":"explode"}`)
+	if response.OK {
+		t.Error("Expected error for unknown command")
+	}
+
+	response = sendControlRequest(t, server, `not json`)
+	if response.OK {
+		t.Error("Expected error for invalid request")
+	}
+}
+
+func TestControlConfig(t *testing.T) {
+	r := NewRegistry()
+
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Effective = EffectiveConfig{"port": {Value: "80", Source: "label hera.port"}}
+	r.Add(tunnel)
+	r.Add(newRegistryTunnel("static.tld", ""))
+
+	server := NewControlServer(nil, r)
+
+	response := server.execute(ControlRequest{Command: "config", Hostname: "site.tld"})
+	if !response.OK || response.Config["port"].Value != "80" {
+		t.Errorf("Unexpected response, got %+v", response)
+	}
+
+	response = server.execute(ControlRequest{Command: "config", Hostname: "static.tld"})
+	if response.OK {
+		t.Error("Expected error for a tunnel without an effective config")
+	}
+}
+
+func TestControlRequiresUnixSocket(t *testing.T) {
+	server := NewControlServer(nil, NewRegistry())
+
+	err := server.ListenAndServe("127.0.0.1:0")
+	if err == nil {
+		t.Error("Expected error for a TCP control address")
+	}
+}
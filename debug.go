@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// DebugServer serves profiles and dumps of the internal state of Hera, for diagnosing leaks in
+// long-running deployments
+type DebugServer struct {
+	Registry *Registry
+
+	mux *http.ServeMux
+}
+
+// DebugTunnel is the debug representation of a registered tunnel, including its internal fields
+type DebugTunnel struct {
+	Hostname       string        `json:"hostname"`
+	Config         *TunnelConfig `json:"config"`
+	Certificate    string        `json:"certificate,omitempty"`
+	ContainerID    string        `json:"container_id,omitempty"`
+	OriginID       string        `json:"origin_id,omitempty"`
+	Project        string        `json:"project,omitempty"`
+	State          string        `json:"state"`
+	Paused         bool          `json:"paused"`
+	Drifted        bool          `json:"drifted"`
+	Pooled         string        `json:"pooled_tunnel,omitempty"`
+	MetricsAddress string        `json:"metrics_address,omitempty"`
+	Backends       []*Backend    `json:"backends,omitempty"`
+	ExpiresAt      *time.Time    `json:"expires_at,omitempty"`
+}
+
+// DebugRegistry is a dump of the registry and the containers Hera is waiting on
+type DebugRegistry struct {
+	Tunnels             []*DebugTunnel `json:"tunnels"`
+	PendingCertificates []string       `json:"pending_certificates"`
+	PendingDependencies []string       `json:"pending_dependencies"`
+	Restarting          []string       `json:"restarting"`
+	PoolIdle            *int           `json:"pool_idle,omitempty"`
+}
+
+// DebugRuntime is a summary of the Go runtime
+type DebugRuntime struct {
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heap_alloc_bytes"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	Sys          uint64 `json:"sys_bytes"`
+	NumGC        uint32 `json:"gc_runs"`
+	PauseTotalNs uint64 `json:"gc_pause_total_ns"`
+	Version      string `json:"go_version"`
+}
+
+// NewDebugServer returns a new DebugServer for the given registry
+func NewDebugServer(registry *Registry) *DebugServer {
+	server := &DebugServer{
+		Registry: registry,
+		mux:      http.NewServeMux(),
+	}
+
+	server.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	server.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	server.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	server.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	server.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server.mux.HandleFunc("/debug/goroutines", server.handleGoroutines)
+	server.mux.HandleFunc("/debug/registry", server.handleRegistry)
+	server.mux.HandleFunc("/debug/runtime", server.handleRuntime)
+
+	return server
+}
+
+// ListenAndServe serves the debug endpoints on the given TCP address or unix socket
+func (s *DebugServer) ListenAndServe(address string) error {
+	listener, err := listenAddress(address)
+	if err != nil {
+		return err
+	}
+
+	log.Warningf("Debug endpoints listening on %s, do not expose them to untrusted clients", address)
+
+	return http.Serve(listener, s)
+}
+
+// ServeHTTP dispatches a request to the matching debug handler
+func (s *DebugServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleGoroutines responds with the stack of every goroutine in plain text
+func (s *DebugServer) handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			w.Write(buf[:n])
+			return
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// handleRegistry responds with a dump of the registry and the containers Hera is waiting on
+func (s *DebugServer) handleRegistry(w http.ResponseWriter, r *http.Request) {
+	dump := &DebugRegistry{
+		Tunnels:             []*DebugTunnel{},
+		PendingCertificates: pendingCertificates.List(),
+		PendingDependencies: pendingDependencies.List(),
+		Restarting:          restarts.List(),
+	}
+
+	for _, tunnel := range s.Registry.List() {
+		dump.Tunnels = append(dump.Tunnels, newDebugTunnel(tunnel))
+	}
+
+	if pool != nil {
+		idle := pool.Idle()
+		dump.PoolIdle = &idle
+	}
+
+	writeJSON(w, http.StatusOK, dump)
+}
+
+// handleRuntime responds with a summary of the Go runtime
+func (s *DebugServer) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	writeJSON(w, http.StatusOK, &DebugRuntime{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    stats.HeapAlloc,
+		HeapObjects:  stats.HeapObjects,
+		Sys:          stats.Sys,
+		NumGC:        stats.NumGC,
+		PauseTotalNs: stats.PauseTotalNs,
+		Version:      runtime.Version(),
+	})
+}
+
+// newDebugTunnel returns the debug representation of the tunnel
+func newDebugTunnel(tunnel *Tunnel) *DebugTunnel {
+	debug := &DebugTunnel{
+		Hostname:       tunnel.Config.Hostname,
+		Config:         tunnel.Config,
+		ContainerID:    tunnel.ContainerID,
+		OriginID:       tunnel.OriginID,
+		Project:        tunnel.Project,
+		State:          tunnel.State,
+		Paused:         tunnel.Paused,
+		Drifted:        tunnel.Drifted,
+		MetricsAddress: tunnel.MetricsAddress,
+	}
+
+	if tunnel.Certificate != nil {
+		debug.Certificate = tunnel.Certificate.Name
+	}
+
+	if tunnel.pooled != nil {
+		debug.Pooled = tunnel.pooled.Tunnel.Name
+	}
+
+	if tunnel.Balancer != nil {
+		debug.Backends = tunnel.Balancer.Backends()
+	}
+
+	if !tunnel.ExpiresAt.IsZero() {
+		debug.ExpiresAt = &tunnel.ExpiresAt
+	}
+
+	return debug
+}
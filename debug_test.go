@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugRegistry(t *testing.T) {
+	registry = NewRegistry()
+	tunnel := newRegistryTunnel("debug.example.com", "5aa5a300dd0e")
+	registry.Add(tunnel)
+
+	rec := httptest.NewRecorder()
+	NewDebugServer(registry).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/registry", nil))
+
+	var dump DebugRegistry
+	err := json.NewDecoder(rec.Body).Decode(&dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dump.Tunnels) != 1 || dump.Tunnels[0].Hostname != "debug.example.com" || dump.Tunnels[0].ContainerID != "5aa5a300dd0e" {
+		t.Errorf("Unexpected tunnels, got %+v", dump.Tunnels)
+	}
+}
+
+func TestDebugGoroutines(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewDebugServer(NewRegistry()).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/goroutines", nil))
+
+	if !strings.Contains(rec.Body.String(), "TestDebugGoroutines") {
+		t.Error("Expected the stack of the test goroutine")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+var (
+	pendingDependencies = NewPendingContainers()
+
+	// dependencyRetries is signalled when a tunnel started, so the event loop retries the containers
+	// waiting for dependencies
+	dependencyRetries = make(chan struct{}, 1)
+
+	// reportedCycles holds the dependency cycles that were logged, keyed by their sorted hostnames, so each
+	// cycle is only logged once
+	reportedCycles = make(map[string]bool)
+)
+
+// parseDependencies returns the tunnel hostnames and container references of a hera.depends-on label
+func parseDependencies(value string) []string {
+	return splitList(value)
+}
+
+// unmetDependencies returns the dependencies of the container's hera.depends-on label that are not up yet
+func (h *Handler) unmetDependencies(container types.ContainerJSON) []string {
+	var unmet []string
+
+	for _, dependency := range parseDependencies(getLabel(heraDependsOn, container)) {
+		if !h.isDependencyUp(dependency) {
+			unmet = append(unmet, dependency)
+		}
+	}
+
+	return unmet
+}
+
+// isDependencyUp returns whether the dependency is the hostname of a running tunnel or refers to a
+// running container
+func (h *Handler) isDependencyUp(dependency string) bool {
+	if isTunnelUp(dependency) {
+		return true
+	}
+
+	container, err := h.Client.Inspect(dependency)
+	if err != nil || container.State == nil {
+		return false
+	}
+
+	return container.State.Running
+}
+
+// isTunnelUp returns whether a tunnel for the hostname is registered and not degraded
+func isTunnelUp(hostname string) bool {
+	tunnel, err := registry.FindByHostname(hostname)
+	if err != nil {
+		return false
+	}
+
+	return tunnel.State != TunnelDegraded
+}
+
+// waitForDependencies marks the container as waiting when some of its dependencies are not up yet, and
+// returns whether it is waiting
+func waitForDependencies(container types.ContainerJSON, unmet []string) bool {
+	if len(unmet) == 0 {
+		pendingDependencies.Remove(container.ID)
+		return false
+	}
+
+	log.Infof("Waiting for %s before starting %s", strings.Join(unmet, ", "), getLabel(heraHostname, container))
+	pendingDependencies.Add(container.ID, getLabel(heraHostname, container))
+
+	return true
+}
+
+// requestDependencyRetry asks the event loop to retry the containers waiting for dependencies. Requests
+// made before the retry runs are merged into one.
+func requestDependencyRetry() {
+	select {
+	case dependencyRetries <- struct{}{}:
+	default:
+	}
+}
+
+// logDependencyCycle logs the cycle of dependencies through the waiting containers that the container is
+// part of, if any, since none of the tunnels in it can ever be started
+func (h *Handler) logDependencyCycle(container types.ContainerJSON) {
+	var waiting []types.ContainerJSON
+	for _, id := range pendingDependencies.List() {
+		if id == container.ID {
+			continue
+		}
+
+		other, err := h.Client.Inspect(id)
+		if err != nil {
+			continue
+		}
+
+		waiting = append(waiting, other)
+	}
+
+	cycle := dependencyCycle(container, waiting)
+	if cycle == nil {
+		return
+	}
+
+	members := append([]string{}, cycle[:len(cycle)-1]...)
+	sort.Strings(members)
+	key := strings.Join(members, ",")
+	if reportedCycles[key] {
+		return
+	}
+	reportedCycles[key] = true
+
+	log.Errorf("Dependency cycle %s, none of these tunnels can start until %s is changed", strings.Join(cycle, " -> "), heraDependsOn)
+}
+
+// dependencyCycle returns the dependencies of a cycle through the waiting containers that leads back to
+// the container, starting with its hostname, or nil if there is none
+func dependencyCycle(container types.ContainerJSON, waiting []types.ContainerJSON) []string {
+	seen := map[string]bool{container.ID: true}
+
+	var visit func(current types.ContainerJSON, path []string) []string
+	visit = func(current types.ContainerJSON, path []string) []string {
+		for _, dependency := range parseDependencies(getLabel(heraDependsOn, current)) {
+			if refersTo(dependency, container) {
+				return append(path, dependency)
+			}
+
+			for _, other := range waiting {
+				if seen[other.ID] || !refersTo(dependency, other) {
+					continue
+				}
+				seen[other.ID] = true
+
+				cycle := visit(other, append(append([]string{}, path...), dependency))
+				if cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return visit(container, []string{getLabel(heraHostname, container)})
+}
+
+// refersTo returns whether a dependency is a hostname of the container, its name, or its ID
+func refersTo(dependency string, container types.ContainerJSON) bool {
+	if container.ContainerJSONBase == nil {
+		return false
+	}
+
+	if strings.TrimPrefix(container.Name, "/") == dependency || container.ID == dependency {
+		return true
+	}
+
+	if len(dependency) >= 12 && strings.HasPrefix(container.ID, dependency) {
+		return true
+	}
+
+	routes, err := containerRoutes(container)
+	if err != nil {
+		return false
+	}
+
+	for _, route := range routes {
+		if route.Hostname == dependency {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryPendingDependencies handles the containers waiting for dependencies again until no more of
+// them can be started, so chains of dependencies are started in order
+func (h *Handler) retryPendingDependencies() {
+	for {
+		progressed := false
+
+		for _, id := range pendingDependencies.List() {
+			pendingDependencies.Remove(id)
+
+			err := h.HandleContainer(id)
+			if err != nil {
+				reportError(err, id)
+			}
+
+			if !pendingDependencies.Has(id) {
+				progressed = true
+			}
+		}
+
+		if !progressed {
+			return
+		}
+	}
+}
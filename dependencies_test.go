@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestParseDependencies(t *testing.T) {
+	dependencies := parseDependencies("api.example.com, db ,")
+
+	if len(dependencies) != 2 || dependencies[0] != "api.example.com" || dependencies[1] != "db" {
+		t.Errorf("Unexpected dependencies, got %v", dependencies)
+	}
+}
+
+func TestIsTunnelUp(t *testing.T) {
+	registry = NewRegistry()
+
+	active := newRegistryTunnel("api.example.com", "container-a")
+	active.State = TunnelActive
+	registry.Add(active)
+
+	degraded := newRegistryTunnel("db.example.com", "container-b")
+	degraded.State = TunnelDegraded
+	registry.Add(degraded)
+
+	if !isTunnelUp("api.example.com") {
+		t.Error("Expected active tunnel to be up")
+	}
+
+	if isTunnelUp("db.example.com") {
+		t.Error("Expected degraded tunnel not to be up")
+	}
+
+	if isTunnelUp("www.example.com") {
+		t.Error("Expected missing tunnel not to be up")
+	}
+}
+
+func TestUnmetDependenciesOfRunningTunnels(t *testing.T) {
+	registry = NewRegistry()
+	registry.Add(newRegistryTunnel("api.example.com", "container-a"))
+
+	container := newTenantContainer(map[string]string{heraHostname: "www.example.com", heraDependsOn: "api.example.com"})
+
+	handler := &Handler{}
+	if unmet := handler.unmetDependencies(container); len(unmet) != 0 {
+		t.Errorf("Expected no unmet dependencies, got %v", unmet)
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	container := newTenantContainer(map[string]string{heraHostname: "www.example.com"})
+
+	if !waitForDependencies(container, []string{"api.example.com"}) {
+		t.Error("Expected container to wait for its dependency")
+	}
+
+	if !pendingDependencies.Has(container.ID) {
+		t.Error("Expected container to be pending")
+	}
+
+	if waitForDependencies(container, nil) {
+		t.Error("Expected container not to wait without unmet dependencies")
+	}
+
+	if pendingDependencies.Has(container.ID) {
+		t.Error("Expected container to no longer be pending")
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	www := newTenantContainer(map[string]string{heraHostname: "www.example.com", heraDependsOn: "api.example.com"})
+
+	api := newTenantContainer(map[string]string{heraHostname: "api.example.com", heraDependsOn: "db"})
+	api.ID = "a1b2c3d4e5f6a1b2c3d4e5f6"
+
+	db := newTenantContainer(map[string]string{heraHostname: "db.example.com", heraDependsOn: "www.example.com"})
+	db.ID = "f6e5d4c3b2a1f6e5d4c3b2a1"
+	db.Name = "/db"
+
+	cycle := dependencyCycle(www, []types.ContainerJSON{api, db})
+	if strings.Join(cycle, " -> ") != "www.example.com -> api.example.com -> db -> www.example.com" {
+		t.Errorf("Unexpected cycle, got %v", cycle)
+	}
+
+	db.Config.Labels[heraDependsOn] = "cache.example.com"
+	if cycle := dependencyCycle(www, []types.ContainerJSON{api, db}); cycle != nil {
+		t.Errorf("Expected no cycle, got %v", cycle)
+	}
+}
+
+func TestRequestDependencyRetryMerges(t *testing.T) {
+	requestDependencyRetry()
+	requestDependencyRetry()
+
+	if len(dependencyRetries) != 1 {
+		t.Errorf("Expected retries to be merged, got %d", len(dependencyRetries))
+	}
+
+	<-dependencyRetries
+}
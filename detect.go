@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolTCP = "tcp"
+
+	// detectTimeout bounds the whole probe of an origin, since detection runs on the event loop
+	detectTimeout = time.Second
+)
+
+var detectedProtocols = NewDetectedProtocols()
+
+// DetectedProtocols remembers the protocol detected for each origin address, so origins are only probed
+// once and a tunnel does not change protocol when its origin is briefly unavailable
+type DetectedProtocols struct {
+	mu        sync.Mutex
+	addresses map[string]string
+}
+
+// NewDetectedProtocols returns an empty DetectedProtocols
+func NewDetectedProtocols() *DetectedProtocols {
+	detected := &DetectedProtocols{
+		addresses: make(map[string]string),
+	}
+
+	return detected
+}
+
+// Detect returns the protocol spoken by the origin at the address, probing it once if it was not detected
+// before. An empty string is returned if the origin cannot be reached, and it is probed again next time.
+func (d *DetectedProtocols) Detect(hostname string, address string) string {
+	d.mu.Lock()
+	protocol, ok := d.addresses[address]
+	d.mu.Unlock()
+
+	if ok {
+		return protocol
+	}
+
+	protocol = probeProtocol(hostname, address, detectTimeout)
+	if protocol == "" {
+		return ""
+	}
+
+	d.mu.Lock()
+	d.addresses[address] = protocol
+	d.mu.Unlock()
+
+	return protocol
+}
+
+// probeProtocol guesses the protocol of the origin at the address by attempting a TLS handshake and then
+// an HTTP request. Origins that accept connections but answer neither are assumed to be raw TCP. The whole
+// probe takes at most the timeout.
+func probeProtocol(hostname string, address string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return ""
+	}
+	conn.SetDeadline(deadline)
+
+	// Origins are commonly served with self-signed certificates, which cloudflared does not verify either
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: hostname, InsecureSkipVerify: true})
+	err = tlsConn.Handshake()
+	tlsConn.Close()
+
+	if err == nil {
+		return "https"
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return ProtocolTCP
+	}
+
+	conn, err = net.DialTimeout("tcp", address, remaining)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	_, err = conn.Write([]byte("HEAD / HTTP/1.0\r\nHost: " + hostname + "\r\n\r\n"))
+	if err != nil {
+		return ProtocolTCP
+	}
+
+	status, err := bufio.NewReader(conn).ReadString('\n')
+	if err == nil && strings.HasPrefix(status, "HTTP/") {
+		return "http"
+	}
+
+	return ProtocolTCP
+}
+
+// detectProtocol returns the detected protocol of the tunnel's origin, or the default protocol if it
+// cannot be reached
+func detectProtocol(hostname string, ip string, port string) (string, bool) {
+	protocol := detectedProtocols.Detect(hostname, net.JoinHostPort(ip, port))
+	if protocol == "" {
+		log.Warningf("Unable to detect the protocol of %s, using %s", hostname, config.DefaultProtocol)
+		return config.DefaultProtocol, false
+	}
+
+	log.Infof("Detected protocol %s for %s at %s:%s", protocol, hostname, ip, port)
+
+	return protocol, true
+}
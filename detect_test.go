@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	// A server that greets clients first, like SSH or SMTP
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	go func() {
+		for {
+			conn, err := raw.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_7.9\r\n"))
+			time.Sleep(500 * time.Millisecond)
+			conn.Close()
+		}
+	}()
+
+	origins := map[string]string{
+		strings.TrimPrefix(plain.URL, "http://"):   "http",
+		strings.TrimPrefix(secure.URL, "https://"): "https",
+		raw.Addr().String():                        ProtocolTCP,
+	}
+
+	for address, expected := range origins {
+		protocol := probeProtocol("site.tld", address, 200*time.Millisecond)
+		if protocol != expected {
+			t.Errorf("Unexpected protocol for %s, got %s want %s", address, protocol, expected)
+		}
+	}
+}
+
+func TestProbeProtocolUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if protocol := probeProtocol("site.tld", address, 200*time.Millisecond); protocol != "" {
+		t.Errorf("Expected no protocol for an unreachable origin, got %s", protocol)
+	}
+}
+
+func TestDetectedProtocolsRemembersOrigins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	detected := NewDetectedProtocols()
+
+	if protocol := detected.Detect("site.tld", address); protocol != "https" {
+		t.Errorf("Unexpected protocol, got %s", protocol)
+	}
+
+	// The origin is not probed again, so it keeps its protocol while unavailable
+	server.Close()
+
+	if protocol := detected.Detect("site.tld", address); protocol != "https" {
+		t.Errorf("Expected the detected protocol to be remembered, got %s", protocol)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	DNSCheckWarn = "warn"
+	DNSCheckFix  = "fix"
+)
+
+var (
+	// tunnelDomains are the domains the CNAME of a hostname served by a tunnel points into
+	tunnelDomains = []string{"cfargotunnel.com", "argotunnel.com"}
+)
+
+// Zone is a Cloudflare zone
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// DNSRecord is a DNS record of a Cloudflare zone
+type DNSRecord struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+}
+
+// isTunnelTarget returns whether a CNAME target is a tunnel endpoint
+func isTunnelTarget(target string) bool {
+	target = strings.TrimSuffix(target, ".")
+
+	for _, domain := range tunnelDomains {
+		if strings.HasSuffix(target, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyDNS warns when the hostname of the tunnel does not point at a tunnel, which leaves the tunnel
+// connected while the site is unreachable. The records of the hostname are checked through the Cloudflare
+// API when it is configured, since proxied records hide their CNAME from public DNS. In fix mode, records
+// in the way are removed and the tunnel is restarted on the event loop so cloudflared routes the hostname
+// to it again.
+func (t *Tunnel) verifyDNS(resolver *net.Resolver, mode string) {
+	hostname := t.Config.Hostname
+
+	var problem string
+	var conflicts []*DNSRecord
+	var zone *Zone
+	var err error
+
+	if cloudflare != nil {
+		zone, err = cloudflare.FindZone(hostname)
+		if err == nil && zone == nil {
+			err = fmt.Errorf("no zone of the account contains it")
+		}
+		if err == nil {
+			problem, conflicts, err = cloudflare.checkDNS(zone, hostname)
+		}
+	} else {
+		problem, err = checkPublicDNS(resolver, hostname)
+	}
+
+	if err != nil {
+		log.Warningf("Unable to verify the DNS of %s: %s", hostname, err)
+		return
+	}
+
+	if problem == "" {
+		log.Debugf("DNS of %s points at its tunnel", hostname)
+		return
+	}
+
+	t.publish(EventDNSMismatch, problem)
+
+	if mode != DNSCheckFix || len(conflicts) == 0 {
+		log.Warningf("Tunnel %s is connected, but the site is unreachable because %s. Point %s at the tunnel with a CNAME record to its cfargotunnel.com address, or set HERA_DNS_CHECK=fix with a Cloudflare API token to replace the record.", hostname, problem, hostname)
+		return
+	}
+
+	eventLoop.Do(func() {
+		t.fixDNS(zone, conflicts)
+	})
+}
+
+// fixDNS removes the records in the way of the tunnel's hostname and restarts the tunnel, unless the
+// tunnel was stopped or replaced since its DNS was checked. Each record is logged in full before it is
+// removed, so it can be restored by hand.
+func (t *Tunnel) fixDNS(zone *Zone, conflicts []*DNSRecord) {
+	hostname := t.Config.Hostname
+
+	current, err := registry.FindByHostname(hostname)
+	if err != nil || current != t {
+		return
+	}
+
+	for _, record := range conflicts {
+		log.Warningf("Removing the %s record %s of %s in zone %s: %s (proxied: %t)", record.Type, record.ID, record.Name, zone.Name, record.Content, record.Proxied)
+
+		err := cloudflare.DeleteDNSRecord(zone, record)
+		if err != nil {
+			reportError(err, t.ContainerID)
+			return
+		}
+
+		log.Infof("Removed the %s record of %s pointing at %s", record.Type, hostname, record.Content)
+	}
+
+	err = t.Restart()
+	if err != nil {
+		reportError(err, t.ContainerID)
+	}
+}
+
+// checkPublicDNS resolves the hostname and returns why it does not point at a tunnel, or an empty string
+// if it does or its target is hidden behind a proxied record
+func checkPublicDNS(resolver *net.Resolver, hostname string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.ResolverTimeout)
+	defer cancel()
+
+	target, err := resolver.LookupCNAME(ctx, hostname)
+	if err != nil {
+		return fmt.Sprintf("%s does not resolve", hostname), nil
+	}
+
+	target = strings.TrimSuffix(target, ".")
+	if target == hostname || isTunnelTarget(target) {
+		return "", nil
+	}
+
+	return fmt.Sprintf("%s is a CNAME for %s", hostname, target), nil
+}
+
+// checkDNS returns why the records of the hostname in the zone do not point at a tunnel, along with
+// the records in the way, or an empty string if they do
+func (c *CloudflareClient) checkDNS(zone *Zone, hostname string) (string, []*DNSRecord, error) {
+	records, err := c.DNSRecords(zone, hostname)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(records) == 0 {
+		return fmt.Sprintf("%s has no DNS record", hostname), nil, nil
+	}
+
+	var conflicts []*DNSRecord
+	var targets []string
+	for _, record := range records {
+		if record.Type == "CNAME" && isTunnelTarget(record.Content) {
+			return "", nil, nil
+		}
+
+		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" {
+			conflicts = append(conflicts, record)
+			targets = append(targets, fmt.Sprintf("%s %s", record.Type, record.Content))
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return fmt.Sprintf("%s has no address or CNAME record", hostname), nil, nil
+	}
+
+	return fmt.Sprintf("%s points at %s", hostname, strings.Join(targets, ", ")), conflicts, nil
+}
+
+// FindZone returns the zone the hostname belongs to, or nil if it is not in a zone of the account
+func (c *CloudflareClient) FindZone(hostname string) (*Zone, error) {
+	labels := strings.Split(hostname, ".")
+
+	for i := 0; i < len(labels)-1; i++ {
+		name := strings.Join(labels[i:], ".")
+
+		var zones []*Zone
+		err := c.request("GET", "/zones?name="+url.QueryEscape(name), nil, &zones)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(zones) > 0 {
+			return zones[0], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// DNSRecords returns the records of the hostname in the zone
+func (c *CloudflareClient) DNSRecords(zone *Zone, hostname string) ([]*DNSRecord, error) {
+	var records []*DNSRecord
+
+	err := c.request("GET", fmt.Sprintf("/zones/%s/dns_records?name=%s", zone.ID, url.QueryEscape(hostname)), nil, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// DeleteDNSRecord deletes a record from the zone
+func (c *CloudflareClient) DeleteDNSRecord(zone *Zone, record *DNSRecord) error {
+	return c.request("DELETE", fmt.Sprintf("/zones/%s/dns_records/%s", zone.ID, record.ID), nil, nil)
+}
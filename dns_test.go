@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsTunnelTarget(t *testing.T) {
+	targets := map[string]bool{
+		"6f5f3d1c-2a8b-4c1e-9d3f-0b1a2c3d4e5f.cfargotunnel.com.": true,
+		"site.argotunnel.com":      true,
+		"cfargotunnel.com":         false,
+		"site.example.com":         false,
+		"site.cfargotunnel.com.io": false,
+	}
+
+	for target, expected := range targets {
+		if isTunnelTarget(target) != expected {
+			t.Errorf("Unexpected result for %s, expected %t", target, expected)
+		}
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery {
+		case "GET /zones?name=www.example.com":
+			w.Write([]byte(`{"success": true, "result": []}`))
+
+		case "GET /zones?name=example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "zone", "name": "example.com"}]}`))
+
+		case "GET /zones/zone/dns_records?name=www.example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "a", "type": "A", "name": "www.example.com", "content": "203.0.113.7"}, {"id": "txt", "type": "TXT", "name": "www.example.com", "content": "v=spf1"}]}`))
+
+		case "GET /zones/zone/dns_records?name=api.example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "cname", "type": "CNAME", "name": "api.example.com", "content": "abc.cfargotunnel.com", "proxied": true}]}`))
+
+		case "GET /zones/zone/dns_records?name=new.example.com":
+			w.Write([]byte(`{"success": true, "result": []}`))
+
+		case "DELETE /zones/zone/dns_records/a?":
+			deleted = append(deleted, "a")
+			w.Write([]byte(`{"success": true, "result": {"id": "a"}}`))
+
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewCloudflareClient("token", "account")
+	client.BaseURL = server.URL
+
+	zone, err := client.FindZone("www.example.com")
+	if err != nil || zone == nil || zone.ID != "zone" {
+		t.Fatalf("Unexpected zone, got %+v %v", zone, err)
+	}
+
+	problem, conflicts, err := client.checkDNS(zone, "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(problem, "A 203.0.113.7") || len(conflicts) != 1 {
+		t.Errorf("Expected the A record to conflict, got %s with %d conflicts", problem, len(conflicts))
+	}
+
+	problem, _, _ = client.checkDNS(zone, "api.example.com")
+	if problem != "" {
+		t.Errorf("Expected the tunnel CNAME to pass, got %s", problem)
+	}
+
+	problem, _, _ = client.checkDNS(zone, "new.example.com")
+	if problem != "new.example.com has no DNS record" {
+		t.Errorf("Unexpected problem for a missing record, got %s", problem)
+	}
+
+	err = client.DeleteDNSRecord(zone, conflicts[0])
+	if err != nil || len(deleted) != 1 {
+		t.Errorf("Expected the conflicting record to be deleted, got %v", err)
+	}
+}
+
+func TestFixDNS(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"success": true, "result": {"id": "a"}}`))
+	}))
+	defer server.Close()
+
+	defer func(previous *CloudflareClient) { cloudflare = previous }(cloudflare)
+	cloudflare = NewCloudflareClient("token", "account")
+	cloudflare.BaseURL = server.URL
+
+	registry = NewRegistry()
+
+	restarted := false
+	tunnel := newRegistryTunnel("www.example.com", "container-a")
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			restarted = true
+			return []byte(""), nil
+		},
+	}
+
+	zone := &Zone{ID: "zone", Name: "example.com"}
+	conflicts := []*DNSRecord{{ID: "a", Type: "A", Name: "www.example.com", Content: "203.0.113.7"}}
+
+	// Tunnels that are no longer registered are left alone
+	tunnel.fixDNS(zone, conflicts)
+	if len(deleted) != 0 || restarted {
+		t.Fatalf("Expected no fix for an unregistered tunnel, got %v", deleted)
+	}
+
+	registry.Add(tunnel)
+	tunnel.fixDNS(zone, conflicts)
+
+	if strings.Join(deleted, ",") != "DELETE /zones/zone/dns_records/a" || !restarted {
+		t.Errorf("Expected the record to be deleted and the tunnel restarted, got %v", deleted)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// domainDefaults holds the default settings of each domain from HERA_DOMAIN_DEFAULTS
+var domainDefaults DomainDefaults
+
+// DomainDefault holds the default settings for the hostnames under a domain. Labels of a container
+// always take precedence over them.
+type DomainDefault struct {
+	// Certificate is the name of the certificate used instead of the one named after the hostname
+	Certificate string `yaml:"certificate"`
+
+	// Labels are the default hera.* labels of containers with a hostname under the domain
+	Labels map[string]string `yaml:"labels"`
+}
+
+// DomainDefaults holds the default settings by domain
+type DomainDefaults map[string]*DomainDefault
+
+// domainDefaultsFile is the layout of the HERA_DOMAIN_DEFAULTS file
+type domainDefaultsFile struct {
+	Domains DomainDefaults `yaml:"domains"`
+}
+
+// LoadDomainDefaults parses the domain defaults file at the given path. An error is returned if the file
+// cannot be read, or a domain sets hera.hostname, a tag, or a label Hera does not know.
+func LoadDomainDefaults(path string) (DomainDefaults, error) {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read domain defaults: %s", err)
+	}
+
+	file := &domainDefaultsFile{}
+
+	err = yaml.UnmarshalStrict(contents, file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse domain defaults %s: %s", path, err)
+	}
+
+	defaults := DomainDefaults{}
+
+	for domain, settings := range file.Domains {
+		if settings == nil {
+			settings = &DomainDefault{}
+		}
+
+		for name := range settings.Labels {
+			if name == heraHostname || strings.HasPrefix(name, heraTagPrefix) {
+				return nil, fmt.Errorf("Domain %s can't set a default %s", domain, name)
+			}
+
+			if !isKnownLabel(name) {
+				return nil, fmt.Errorf("Domain %s sets an unknown label %s%s", domain, name, suggestionHint(name))
+			}
+		}
+
+		defaults[strings.ToLower(strings.TrimSuffix(domain, "."))] = settings
+	}
+
+	return defaults, nil
+}
+
+// Find returns the domain and defaults of the most specific domain the hostname is under, or an empty
+// domain and nil if there is none
+func (d DomainDefaults) Find(hostname string) (string, *DomainDefault) {
+	hostname = strings.ToLower(hostname)
+
+	var match string
+	for domain := range d {
+		if hostname != domain && !strings.HasSuffix(hostname, "."+domain) {
+			continue
+		}
+
+		if len(domain) > len(match) {
+			match = domain
+		}
+	}
+
+	if match == "" {
+		return "", nil
+	}
+
+	return match, d[match]
+}
+
+// Domains returns the configured domains, sorted
+func (d DomainDefaults) Domains() []string {
+	var domains []string
+	for domain := range d {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	return domains
+}
+
+// getDomainLabel returns the default value of a label for the domain of the container's hostname, and
+// the domain it came from
+func getDomainLabel(name string, container types.ContainerJSON) (string, string) {
+	if name == heraHostname || len(domainDefaults) == 0 {
+		return "", ""
+	}
+
+	domain, defaults := domainDefaults.Find(getLabel(heraHostname, container))
+	if defaults == nil || defaults.Labels[name] == "" {
+		return "", ""
+	}
+
+	return defaults.Labels[name], domain
+}
+
+// getDomainCertificate returns the certificate configured for the domain of the hostname, or nil if the
+// domain has none
+func getDomainCertificate(hostname string) (*Certificate, error) {
+	domain, defaults := domainDefaults.Find(hostname)
+	if defaults == nil || defaults.Certificate == "" {
+		return nil, nil
+	}
+
+	name := strings.TrimSuffix(defaults.Certificate, ".pem")
+
+	cert, err := FindCertificateForHost(name, fs)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find certificate %s of domain %s: %s", defaults.Certificate, domain, err)
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"time"
+)
+
+// WatchDrift periodically checks the registered tunnels for drift from their desired config, restarting
+// drifted tunnels with the desired config when remediate is set. Tunnels are checked on the event loop
+// so remediation doesn't race with the events of their containers.
+func WatchDrift(handler *Handler, interval time.Duration, remediate bool) {
+	for {
+		time.Sleep(interval)
+
+		eventLoop.Do(func() {
+			for _, tunnel := range registry.List() {
+				err := handler.checkDrift(tunnel, remediate)
+				if err != nil {
+					reportError(err, tunnel.ContainerID)
+				}
+			}
+		})
+	}
+}
+
+// checkDrift flags the tunnel as drifted if its config file was changed or its config no longer matches
+// the labels of its container. Degraded and observed tunnels are not running, so they are skipped.
+func (h *Handler) checkDrift(tunnel *Tunnel, remediate bool) error {
+	if tunnel.State == TunnelDegraded || tunnel.State == TunnelObserved {
+		return nil
+	}
+
+	desired, err := h.desiredTunnel(tunnel)
+	if err != nil {
+		return err
+	}
+
+	drifted, err := tunnel.hasConfigDrifted()
+	if err != nil {
+		return err
+	}
+
+	if desired != tunnel {
+		drifted = true
+	}
+
+	if !drifted {
+		tunnel.Drifted = false
+		return nil
+	}
+
+	if !tunnel.Drifted {
+		log.Warningf("Tunnel %s has drifted from its desired config", tunnel.Config.Hostname)
+	}
+	tunnel.Drifted = true
+
+	if !remediate {
+		return nil
+	}
+
+	log.Infof("Restarting drifted tunnel %s", tunnel.Config.Hostname)
+
+	return desired.Start()
+}
+
+// desiredTunnel returns a tunnel rebuilt from the labels of the tunnel's container if its config differs,
+// or the tunnel itself if it is up to date. Tunnels without a container and balanced tunnels are not rebuilt.
+func (h *Handler) desiredTunnel(tunnel *Tunnel) (*Tunnel, error) {
+	if tunnel.ContainerID == "" || tunnel.Balancer != nil {
+		return tunnel, nil
+	}
+
+	container, err := h.Client.Inspect(tunnel.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+
+	desired, err := h.rebuildTunnel(container, tunnel.Config.Hostname)
+	if err != nil || desired == nil {
+		return tunnel, err
+	}
+
+	if *desired.Config == *tunnel.Config && desired.Certificate.Name == tunnel.Certificate.Name && desired.OriginID == tunnel.OriginID {
+		return tunnel, nil
+	}
+
+	return desired, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCheckDrift(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	handler := &Handler{}
+	tunnel := newTunnel()
+	tunnel.State = TunnelActive
+
+	err := tunnel.writeConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = handler.checkDrift(tunnel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tunnel.Drifted {
+		t.Error("Expected tunnel not to have drifted")
+	}
+
+	afero.WriteFile(fs, tunnel.Service.ConfigFilePath(), []byte("hostname: other.tld"), 0644)
+
+	err = handler.checkDrift(tunnel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tunnel.Drifted {
+		t.Error("Expected edited config to be flagged as drift")
+	}
+}
+
+func TestCheckDriftSkipsDegraded(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tunnel := newTunnel()
+	tunnel.State = TunnelDegraded
+
+	err := (&Handler{}).checkDrift(tunnel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tunnel.Drifted {
+		t.Error("Expected degraded tunnel to be skipped")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Setting is a resolved tunnel setting and where its value came from
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// EffectiveConfig holds the resolved settings of a tunnel by name, after defaults and labels are applied
+type EffectiveConfig map[string]Setting
+
+// newEffectiveConfig returns the effective config of a tunnel created for the container
+func newEffectiveConfig(container types.ContainerJSON, tunnel *Tunnel) EffectiveConfig {
+	effective := EffectiveConfig{}
+
+	effective.set("hostname", tunnel.Config.Hostname, labelSource(heraHostname, container))
+	effective.setLabelOr(container, "port", tunnel.Config.Port, heraPort, "HERA_DEFAULT_PORT")
+	if tunnel.protocolDetected {
+		effective.set("protocol", tunnel.Config.Protocol, "detected")
+	} else {
+		effective.setLabelOr(container, "protocol", tunnel.Config.Protocol, heraProtocol, "HERA_DEFAULT_PROTOCOL")
+	}
+	effective.set("ip", tunnel.Config.IP, ipSource(container))
+
+	certSource := "certificate directory"
+	if config.CertificateSource != "" {
+		certSource = "HERA_CERT_SOURCE=" + config.CertificateSource
+	}
+	if domain, defaults := domainDefaults.Find(tunnel.Config.Hostname); defaults != nil && defaults.Certificate != "" {
+		certSource = "domain " + domain
+	}
+	effective.set("certificate", tunnel.Certificate.FullPath(), certSource)
+
+	logLevel := tunnel.Config.LogLevel
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	effective.setLabelOr(container, "loglevel", logLevel, heraLogLevel, "cloudflared default")
+
+	logFile := tunnel.Config.LogFile
+	if logFile == "" {
+		logFile = tunnel.Service.LogFilePath()
+	}
+	effective.setLabelOr(container, "logfile", logFile, heraLogFile, "default")
+
+	if !tunnel.ExpiresAt.IsZero() {
+		effective.setLabelOr(container, "expires_at", tunnel.ExpiresAt.Format(time.RFC3339), heraTTL, "HERA_TUNNEL_TTL")
+	}
+
+	for _, label := range []string{heraOrigin, heraArgs, heraRedirect, heraRedirectStatus, heraStaticDir, heraAnnounce, heraGrace, heraSmokePath, heraSmokeStatus, heraKeepAliveConnections, heraKeepAliveTimeout, heraTCPKeepAlive, heraAccessServiceToken, heraWeight, heraSchedule, heraDependsOn, heraReady} {
+		if value := getLabel(label, container); value != "" {
+			effective.set(strings.TrimPrefix(label, "hera."), value, labelSource(label, container))
+		}
+	}
+
+	return effective
+}
+
+// set records the value of a setting and its source
+func (e EffectiveConfig) set(name, value, source string) {
+	e[name] = Setting{Value: value, Source: source}
+}
+
+// setLabelOr records the value of a setting, which came from the label if the container has it
+// and from the fallback otherwise
+func (e EffectiveConfig) setLabelOr(container types.ContainerJSON, name, value, label, fallback string) {
+	source := fallback
+	if getLabel(label, container) != "" {
+		source = labelSource(label, container)
+	}
+
+	e.set(name, value, source)
+}
+
+// String returns the settings as aligned lines sorted by name
+func (e EffectiveConfig) String() string {
+	var names []string
+	width := 0
+
+	for name := range e {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		setting := e[name]
+		lines = append(lines, fmt.Sprintf("%-*s  %s  (%s)", width, name, setting.Value, setting.Source))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// labelSource returns the source of a setting read from a label, or from the environment variable or
+// domain default the label falls back to
+func labelSource(label string, container types.ContainerJSON) string {
+	if _, ok := container.Config.Labels[label]; ok {
+		return "label " + label
+	}
+
+	if _, domain := getDomainLabel(label, container); domain != "" && (!config.EnvLabels || getEnvLabel(label, container) == "") {
+		return "domain " + domain
+	}
+
+	if config.EnvLabels {
+		return "env " + envLabelName(label)
+	}
+
+	return "label " + label
+}
+
+// ipSource returns where the IP of a tunnel for the container is resolved from, in the order of resolveIP
+func ipSource(container types.ContainerJSON) string {
+	var source string
+
+	switch {
+	case getLabel(heraIP, container) != "":
+		source = labelSource(heraIP, container)
+	case getLabel(heraIPFrom, container) != "":
+		source = fmt.Sprintf("network within %s (%s)", getLabel(heraIPFrom, container), labelSource(heraIPFrom, container))
+	default:
+		source = "resolved container hostname"
+	}
+
+	if origin := getLabel(heraOrigin, container); origin != "" {
+		source += " of " + origin
+	}
+
+	return source
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewEffectiveConfig(t *testing.T) {
+	config.DefaultPort = "8080"
+	defer func() { config.DefaultPort = "" }()
+
+	container := newTenantContainer(map[string]string{heraHostname: "site.tld", heraIPFrom: "172.23.0.0/16", heraWeight: "3"})
+
+	tunnel := newTunnel()
+	tunnel.Config.Port = "8080"
+	tunnel.Config.Protocol = "http"
+
+	effective := newEffectiveConfig(container, tunnel)
+
+	expected := map[string]Setting{
+		"hostname": {Value: "site.tld", Source: "label hera.hostname"},
+		"port":     {Value: "8080", Source: "HERA_DEFAULT_PORT"},
+		"ip":       {Value: "172.23.0.4", Source: "network within 172.23.0.0/16 (label hera.ip-from)"},
+		"loglevel": {Value: "info", Source: "cloudflared default"},
+		"weight":   {Value: "3", Source: "label hera.weight"},
+	}
+
+	for name, setting := range expected {
+		if effective[name] != setting {
+			t.Errorf("Unexpected setting for %s, got %+v want %+v", name, effective[name], setting)
+		}
+	}
+
+	if _, ok := effective["expires_at"]; ok {
+		t.Error("Expected no expiry for a tunnel without a TTL")
+	}
+}
+
+func TestEffectiveConfigString(t *testing.T) {
+	effective := EffectiveConfig{}
+	effective.set("port", "80", "label hera.port")
+	effective.set("hostname", "site.tld", "label hera.hostname")
+
+	lines := strings.Split(strings.TrimSpace(effective.String()), "\n")
+	if len(lines) != 2 || lines[0] != "hostname  site.tld  (label hera.hostname)" || lines[1] != "port      80  (label hera.port)" {
+		t.Errorf("Unexpected output, got %q", lines)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	DecryptedCertificatePath = "/var/run/hera/decrypted"
+	encryptedHeader          = "HERA-ENCRYPTED-V1\n"
+	saltSize                 = 16
+)
+
+// Encrypt encrypts the data with a key derived from the passphrase. The result starts with a header
+// so encrypted files can be told apart from plain ones.
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(append(salt, nonce...), gcm.Seal(nil, nonce, data, nil)...)
+
+	return []byte(encryptedHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// Decrypt decrypts data produced by Encrypt with the same passphrase
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("Data is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedHeader):])))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < saltSize {
+		return nil, fmt.Errorf("Encrypted data is too short")
+	}
+
+	gcm, err := newGCM(passphrase, sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[saltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Encrypted data is too short")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt, the passphrase may be wrong")
+	}
+
+	return plain, nil
+}
+
+// IsEncrypted returns whether the data was produced by Encrypt
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedHeader))
+}
+
+// newGCM returns an AES-GCM cipher with a key derived from the passphrase and salt
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("No passphrase configured, set HERA_PASSPHRASE or HERA_PASSPHRASE_FILE")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// loadPassphrase returns the passphrase from the environment, reading it from a file if a path is given
+func loadPassphrase(passphrase string, path string) (string, error) {
+	if path == "" {
+		return passphrase, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read passphrase file: %s", err)
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
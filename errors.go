@@ -0,0 +1,178 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrorKind categorizes the failures Hera can run into
+type ErrorKind string
+
+const (
+	ErrUnknown            ErrorKind = "unknown"
+	ErrNoCertificate      ErrorKind = "no_certificate"
+	ErrUnresolvableOrigin ErrorKind = "unresolvable_origin"
+	ErrCloudflaredStart   ErrorKind = "cloudflared_start"
+	ErrDockerUnavailable  ErrorKind = "docker_unavailable"
+	ErrHostnameNotAllowed ErrorKind = "hostname_not_allowed"
+	ErrTenantNotAllowed   ErrorKind = "tenant_not_allowed"
+
+	ErrCloudflareAuth        ErrorKind = "cloudflare_auth"
+	ErrCloudflareRateLimit   ErrorKind = "cloudflare_rate_limit"
+	ErrCloudflareNotFound    ErrorKind = "cloudflare_not_found"
+	ErrCloudflareUnavailable ErrorKind = "cloudflare_unavailable"
+	ErrCloudflareRequest     ErrorKind = "cloudflare_request"
+)
+
+const (
+	maxRecentErrors = 50
+)
+
+var (
+	errorsTotal  = NewCounterVec("hera_errors_total", "Number of errors by kind.", "kind")
+	recentErrors = &ErrorLog{}
+
+	// errorHints suggest how to fix the errors of a kind
+	errorHints = map[ErrorKind]string{
+		ErrCloudflareAuth:        "Check that HERA_CLOUDFLARE_API_TOKEN is valid and has the permissions the feature needs, and that HERA_CLOUDFLARE_ACCOUNT_ID is the account of the token",
+		ErrCloudflareRateLimit:   "Hera backs off and retries, but other tools sharing the API token may need to send fewer requests",
+		ErrCloudflareNotFound:    "Check that the zone of the hostname is in the account of HERA_CLOUDFLARE_API_TOKEN and that the token may access it",
+		ErrCloudflareUnavailable: "The Cloudflare API could not be reached, check the network and outbound proxy of the Hera container",
+	}
+)
+
+// Error is an error categorized by its kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewError returns the error categorized with the given kind, or nil if err is nil
+func NewError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Keep the kind of an error that has already been categorized
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	return &Error{Kind: kind, Err: err}
+}
+
+// Error returns the message of the underlying error
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of an error, or of the first categorized error it wraps, or ErrUnknown if it
+// has not been categorized
+func KindOf(err error) ErrorKind {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e.Kind
+		}
+
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+
+	return ErrUnknown
+}
+
+// ExitCode returns the exit code Hera exits with when the error is fatal
+func ExitCode(err error) int {
+	switch KindOf(err) {
+	case ErrDockerUnavailable:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// ErrorEntry is a reported error
+type ErrorEntry struct {
+	Time        time.Time `json:"time"`
+	Kind        ErrorKind `json:"kind"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Message     string    `json:"message"`
+	Hint        string    `json:"hint,omitempty"`
+}
+
+// ErrorLog holds the most recently reported errors
+type ErrorLog struct {
+	mu      sync.Mutex
+	entries []*ErrorEntry
+}
+
+// Add records an error, discarding the oldest one once maxRecentErrors are held
+func (l *ErrorLog) Add(entry *ErrorEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > maxRecentErrors {
+		l.entries = l.entries[len(l.entries)-maxRecentErrors:]
+	}
+}
+
+// List returns a snapshot of the recorded errors, oldest first
+func (l *ErrorLog) List() []*ErrorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]*ErrorEntry, len(l.entries))
+	copy(entries, l.entries)
+
+	return entries
+}
+
+// reportError publishes an error for the container on the bus
+func reportError(err error, containerID string) {
+	// The paused requests were already reported when the breaker opened
+	if err == errDockerPaused {
+		log.Debugf("Skipped a request for %s while Docker is failing", shortID(containerID))
+		return
+	}
+
+	kind := EventError
+
+	switch KindOf(err) {
+	case ErrNoCertificate:
+		kind = EventCertMissing
+	case ErrUnresolvableOrigin:
+		kind = EventOriginUnreachable
+	}
+
+	bus.Publish(&BusEvent{Kind: kind, ContainerID: containerID, Message: err.Error(), Err: err})
+}
+
+// recordError logs a reported error along with its kind, counts it, and records it for the API
+func recordError(event *BusEvent) {
+	kind := KindOf(event.Err)
+	hint := errorHints[kind]
+
+	if hint != "" {
+		log.Errorf("%s (%s). %s.", event.Err, kind, hint)
+	} else {
+		log.Errorf("%s (%s)", event.Err, kind)
+	}
+
+	errorsTotal.Inc(string(kind))
+	recentErrors.Add(&ErrorEntry{
+		Time:        event.Time,
+		Kind:        kind,
+		ContainerID: event.ContainerID,
+		Message:     event.Message,
+		Hint:        hint,
+	})
+}
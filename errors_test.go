@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	err := NewError(ErrNoCertificate, errors.New("Unable to find certificate for site.tld"))
+
+	if KindOf(err) != ErrNoCertificate {
+		t.Errorf("Unexpected kind, got %s", KindOf(err))
+	}
+
+	if err.Error() != "Unable to find certificate for site.tld" {
+		t.Errorf("Unexpected message, got %s", err.Error())
+	}
+
+	// An already categorized error keeps its kind
+	if KindOf(NewError(ErrCloudflaredStart, err)) != ErrNoCertificate {
+		t.Error("Expected the original kind to be kept")
+	}
+
+	if KindOf(errors.New("plain")) != ErrUnknown {
+		t.Error("Expected uncategorized errors to be unknown")
+	}
+
+	if NewError(ErrNoCertificate, nil) != nil {
+		t.Error("Expected nil for a nil error")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	codes := map[ErrorKind]int{
+		ErrDockerUnavailable: 3,
+		ErrNoCertificate:     1,
+		ErrCloudflaredStart:  1,
+	}
+
+	for kind, expected := range codes {
+		if code := ExitCode(NewError(kind, errors.New("failed"))); code != expected {
+			t.Errorf("Unexpected exit code for %s, got %d", kind, code)
+		}
+	}
+}
+
+func TestErrorLog(t *testing.T) {
+	errorLog := &ErrorLog{}
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		errorLog.Add(&ErrorEntry{Message: fmt.Sprintf("error %d", i)})
+	}
+
+	entries := errorLog.List()
+	if len(entries) != maxRecentErrors {
+		t.Fatalf("Unexpected entry count, got %d", len(entries))
+	}
+
+	if entries[0].Message != "error 5" {
+		t.Errorf("Expected oldest entries to be discarded, got %s", entries[0].Message)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ExportIngress = "ingress"
+	ExportConfig  = "config"
+)
+
+// Export returns the desired state of the tunnels in the given format, either a single cloudflared
+// ingress config or the config file of each tunnel as a separate YAML document
+func Export(tunnels []*Tunnel, format string) (string, error) {
+	switch format {
+	case "", ExportIngress:
+		return exportIngress(tunnels), nil
+	case ExportConfig:
+		return exportConfigs(tunnels)
+	}
+
+	return "", fmt.Errorf("Unknown export format: %s", format)
+}
+
+// exportIngress returns an ingress config routing each tunnel's hostname directly to its origin
+func exportIngress(tunnels []*Tunnel) string {
+	lines := []string{"ingress:"}
+
+	for _, tunnel := range tunnels {
+		// cloudflared can only respond with the status of a redirect, which is served by Hera
+		if redirect := tunnel.Config.Redirect; redirect.Target != "" {
+			lines = append(lines,
+				fmt.Sprintf("  # %s redirects to %s", tunnel.Config.Hostname, redirect.Target),
+				fmt.Sprintf("  - hostname: %s", tunnel.Config.Hostname),
+				fmt.Sprintf("    service: http_status:%d", redirect.Status),
+			)
+			continue
+		}
+
+		// cloudflared cannot serve files, so static directories are only reachable through Hera
+		if tunnel.Config.StaticDir != "" {
+			lines = append(lines, fmt.Sprintf("  # %s serves %s and is not exported", tunnel.Config.Hostname, tunnel.Config.StaticDir))
+			continue
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("  - hostname: %s", tunnel.Config.Hostname),
+			fmt.Sprintf("    service: %s", tunnel.directURL()),
+			"    originRequest:",
+			"      noTLSVerify: true",
+		)
+
+		for _, line := range tunnel.Config.KeepAlive.ingressLines() {
+			lines = append(lines, "      "+line)
+		}
+	}
+
+	// cloudflared requires the last rule to match all requests
+	lines = append(lines, "  - service: http_status:404")
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// exportConfigs returns the config file of each tunnel, as it is passed to cloudflared
+func exportConfigs(tunnels []*Tunnel) (string, error) {
+	var documents []string
+
+	for _, tunnel := range tunnels {
+		contents, err := tunnel.configFileContents()
+		if err != nil {
+			return "", err
+		}
+
+		documents = append(documents, fmt.Sprintf("# %s\n%s\n", tunnel.Config.Hostname, contents))
+	}
+
+	return strings.Join(documents, "---\n"), nil
+}
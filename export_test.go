@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestExportIngress(t *testing.T) {
+	tunnels := []*Tunnel{newRegistryTunnel("a.tld", "container-a"), newRegistryTunnel("b.tld", "container-b")}
+	tunnels[0].Config.Protocol = "http"
+	tunnels[1].Config.Protocol = "https"
+
+	export, err := Export(tunnels, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `ingress:
+  - hostname: a.tld
+    service: http://172.23.0.4:80
+    originRequest:
+      noTLSVerify: true
+  - hostname: b.tld
+    service: https://172.23.0.4:80
+    originRequest:
+      noTLSVerify: true
+  - service: http_status:404
+`
+	if export != expected {
+		t.Errorf("Unexpected ingress export, got:\n%s", export)
+	}
+}
+
+func TestExportConfig(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tunnels := []*Tunnel{newRegistryTunnel("a.tld", "container-a"), newRegistryTunnel("b.tld", "container-b")}
+
+	export, err := Export(tunnels, ExportConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(export, "---\n") != 1 || !strings.Contains(export, "# b.tld\nhostname: b.tld") {
+		t.Errorf("Unexpected config export, got:\n%s", export)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	_, err := Export(nil, "json")
+	if err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
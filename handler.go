@@ -1,52 +1,120 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/net/publicsuffix"
 
-	"github.com/spf13/afero"
-
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
 )
 
 const (
-	heraHostname = "hera.hostname"
-	heraPort     = "hera.port"
-	heraIP       = "hera.ip"
-	heraProtocol = "hera.protocol"
+	heraHostname  = "hera.hostname"
+	heraPort      = "hera.port"
+	heraIP        = "hera.ip"
+	heraIPFrom    = "hera.ip-from"
+	heraProtocol  = "hera.protocol"
+	heraOrigin    = "hera.origin-container"
+	heraReady     = "hera.readiness-cmd"
+	heraWeight    = "hera.weight"
+	heraLogLevel  = "hera.cloudflared-loglevel"
+	heraLogFile   = "hera.cloudflared-logfile"
+	heraArgs      = "hera.cloudflared-args"
+	heraTTL       = "hera.ttl"
+	heraSchedule  = "hera.schedule"
+	heraDependsOn = "hera.depends-on"
+	heraGrace     = "hera.grace-period"
 )
 
 // A Handler is responsible for responding to container start and die events
 type Handler struct {
-	Client *Client
+	Client   *Client
+	Resolver *net.Resolver
+
+	// Simulate substitutes a placeholder for missing certificates when tunnels are only simulated
+	Simulate bool
 }
 
 // NewHandler returns a new Handler instance
 func NewHandler(client *Client) *Handler {
 	handler := &Handler{
-		Client: client,
+		Client:   client,
+		Resolver: newResolver(config.ResolverAddress),
 	}
 
 	return handler
 }
 
-// HandleEvent dispatches an event to the appropriate handler method depending on its status
+// HandleEvent dispatches an event to the appropriate handler method depending on its type and status
 func (h *Handler) HandleEvent(event events.Message) {
+	if event.Type == events.NetworkEventType {
+		switch action := event.Action; action {
+		case "connect", "disconnect":
+			h.Client.Invalidate(event.Actor.Attributes["container"])
+
+			err := h.handleNetworkEvent(event)
+			if err != nil {
+				reportError(err, event.Actor.Attributes["container"])
+			}
+		}
+
+		return
+	}
+
+	switch event.Status {
+	case "start", "die", "destroy":
+		h.Client.Invalidate(event.ID)
+
+		if !h.acceptEvent(event) {
+			return
+		}
+	}
+
 	switch status := event.Status; status {
 	case "start":
 		err := h.handleStartEvent(event)
 		if err != nil {
-			log.Error(err.Error())
+			reportError(err, event.ID)
 		}
 
+		err = h.handleOriginStartEvent(event)
+		if err != nil {
+			reportError(err, event.ID)
+		}
+
+		h.retryPendingDependencies()
+
 	case "die":
+		pendingCertificates.Remove(event.ID)
+		pendingDependencies.Remove(event.ID)
+
 		err := h.handleDieEvent(event)
 		if err != nil {
-			log.Error(err.Error())
+			reportError(err, event.ID)
+		}
+
+		err = h.handleOriginDieEvent(event)
+		if err != nil {
+			reportError(err, event.ID)
+		}
+
+	case "stop":
+		err := h.handleStopEvent(event)
+		if err != nil {
+			reportError(err, event.ID)
+		}
+
+	case "destroy":
+		err := handleDestroyEvent(event)
+		if err != nil {
+			reportError(err, event.ID)
 		}
 	}
 }
@@ -66,83 +134,828 @@ func (h *Handler) HandleContainer(id string) error {
 	return nil
 }
 
+// Reconcile brings the registered tunnels in line with the running containers after events may have
+// been missed. Tunnels are started for labeled containers without one and stopped for containers that
+// are no longer running.
+func (h *Handler) Reconcile() error {
+	containers, err := h.Client.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]bool)
+	for _, c := range containers {
+		running[c.ID] = true
+
+		// Containers configured through environment variables can only be found by inspecting them
+		if _, err := registry.FindByContainer(c.ID); err == nil || (c.Labels[heraHostname] == "" && !config.EnvLabels) {
+			continue
+		}
+
+		err := h.HandleContainer(c.ID)
+		if err != nil {
+			reportError(err, c.ID)
+		}
+	}
+
+	for _, tunnel := range registry.List() {
+		if tunnel.Balancer != nil {
+			for _, backend := range tunnel.Balancer.Backends() {
+				if !running[backend.ContainerID] {
+					tunnel.Balancer.Remove(backend.ContainerID)
+				}
+			}
+
+			if len(tunnel.Balancer.Backends()) > 0 {
+				continue
+			}
+			balancers.Remove(tunnel.Config.Hostname)
+		} else if tunnel.ContainerID == "" || running[tunnel.ContainerID] {
+			continue
+		}
+
+		_, err := tunnel.Stop()
+		if err != nil {
+			reportError(err, tunnel.ContainerID)
+			continue
+		}
+
+		registry.Remove(tunnel)
+	}
+
+	return nil
+}
+
 // handleStartEvent inspects the container from a start event and creates a tunnel if the container
-// has been appropriately labeled and a certificate exists for its hostname
+// has been appropriately labeled and a certificate exists for its hostname. Containers without a
+// certificate are retried once one is added.
 func (h *Handler) handleStartEvent(event events.Message) error {
+	started := time.Now()
+
 	container, err := h.Client.Inspect(event.ID)
 	if err != nil {
 		return err
 	}
+	inspected := time.Since(started)
 
-	hostname := getLabel(heraHostname, container)
-	port := getLabel(heraPort, container)
-	supplied_ip := getLabel(heraIP, container)
-	protocol := getLabel(heraProtocol, container)
-	if hostname == "" || port == "" {
+	if project := getLabel(composeProject, container); project != "" && registry.IsProjectStopped(project) {
+		log.Infof("Project %s is stopped, not starting a tunnel for %s", project, shortID(container.ID))
 		return nil
 	}
 
+	warnLabels(container)
+
+	tunnels, err := h.newTunnels(container)
+	if KindOf(err) == ErrNoCertificate {
+		log.Infof("Waiting for a certificate for %s", getLabel(heraHostname, container))
+		pendingCertificates.Add(container.ID, getLabel(heraHostname, container))
+	}
+	if err != nil || len(tunnels) == 0 {
+		return err
+	}
+
+	if waitForDependencies(container, h.unmetDependencies(container)) {
+		h.logDependencyCycle(container)
+		return nil
+	}
+
+	// A container restarted by its restart policy keeps its running tunnel, even without a restart window
+	// when its die event was dropped as stale because the container was already running again
+	restarted := restarts.Cancel(container.ID) || (config.RestartKeepAlive > 0 && event.Status == "start")
+	startWaits.Cancel(container.ID)
+
 	log.Infof("Container found, connecting to %s...", container.ID[:12])
 
-	ip, err := h.resolveHostname(container)
+	for _, tunnel := range tunnels {
+		if restarted && isKeptAlive(tunnel) {
+			log.Infof("Container %s restarted, kept tunnel %s alive", shortID(container.ID), tunnel.Config.Hostname)
+			restartsKept.Inc("restarted")
+			continue
+		}
+
+		tunnel.Latency.Set("inspect", inspected)
+
+		err := h.startContainerTunnel(tunnel, container)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startContainerTunnel protects the hostname of a tunnel of the container and starts the tunnel,
+// balancing it between containers if the container has a weight
+func (h *Handler) startContainerTunnel(tunnel *Tunnel, container types.ContainerJSON) error {
+	err := configureAccess(container, tunnel.Config.Hostname)
 	if err != nil {
 		return err
 	}
 
-	// Check if an IP was supplied as label
-	if supplied_ip != "" {
-		ip = supplied_ip
+	if weight := getLabel(heraWeight, container); weight != "" {
+		return h.startWeightedTunnel(tunnel, container, weight)
 	}
 
-	// Check if a protocol was supplied as label
-	if protocol == "" {
-		protocol = "http"
+	balancers.Remove(tunnel.Config.Hostname)
+
+	return h.startTunnel(tunnel, container)
+}
+
+// startWeightedTunnel adds the container to the balancer of its hostname with the weight from its
+// hera.weight label. The tunnel is only started if the hostname is not already being balanced, otherwise
+// the new weight takes effect immediately.
+func (h *Handler) startWeightedTunnel(tunnel *Tunnel, container types.ContainerJSON, value string) error {
+	weight, err := parseWeight(value)
+	if err != nil {
+		return err
 	}
 
-	cert, err := getCertificate(hostname)
+	return h.whenReady(tunnel, container, func() error {
+		return h.routeWeighted(tunnel, container, weight)
+	})
+}
+
+// routeWeighted routes to the ready container with its weight, starting the tunnel of the hostname
+// unless it is already being balanced
+func (h *Handler) routeWeighted(tunnel *Tunnel, container types.ContainerJSON, weight int) error {
+	hostname := tunnel.Config.Hostname
+
+	balancer, err := balancers.Get(hostname)
 	if err != nil {
 		return err
 	}
 
-	config := &TunnelConfig{
-		IP:       ip,
-		Hostname: hostname,
-		Port:     port,
-		Protocol: protocol,
+	err = balancer.Set(container.ID, tunnel.directURL(), weight)
+	if err != nil {
+		return err
 	}
 
-	tunnel := NewTunnel(config, cert)
-	tunnel.Start()
+	log.Infof("Routing to %s for %s with weight %d", container.ID[:12], hostname, weight)
+
+	existing, err := registry.FindByHostname(hostname)
+	if err == nil && existing.Balancer == balancer && existing.State != TunnelDegraded {
+		return nil
+	}
+
+	tunnel.Balancer = balancer
+
+	return tunnel.Start()
+}
+
+// handleNetworkEvent handles a container connecting to or disconnecting from a network. Affected tunnels
+// are restarted if their origin IP changed or degraded if the origin lost all usable networks, while a
+// labeled container without a tunnel is started once it becomes reachable.
+func (h *Handler) handleNetworkEvent(event events.Message) error {
+	id := event.Actor.Attributes["container"]
+	if id == "" {
+		return nil
+	}
+
+	var tunnels []*Tunnel
+	for _, tunnel := range registry.FindAllByContainer(id) {
+		if tunnel.OriginID == "" {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+	tunnels = append(tunnels, registry.FindByOrigin(id)...)
+
+	if len(tunnels) == 0 && event.Action == "connect" {
+		return h.handleReachableContainer(event, id)
+	}
+
+	for _, tunnel := range tunnels {
+		err := h.refreshTunnel(tunnel)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// handleDieEvent inspects the container from a die event and stops the tunnel if one exists.
-// An error is returned if a tunnel cannot be found or if the tunnel fails to stop
+// handleReachableContainer starts the tunnel of a running container that was connected to a network
+func (h *Handler) handleReachableContainer(event events.Message, id string) error {
+	container, err := h.Client.Inspect(id)
+	if err != nil {
+		return err
+	}
+
+	if container.State == nil || !container.State.Running || isStartupConnect(event, container) {
+		return nil
+	}
+
+	if getLabel(heraHostname, container) == "" {
+		return nil
+	}
+
+	log.Infof("Container %s is now reachable", container.ID[:12])
+
+	// The container goes through the same checks as when it starts, such as for stopped projects,
+	// dependencies, and weights
+	return h.handleStartEvent(events.Message{ID: container.ID})
+}
+
+// refreshTunnel rebuilds the tunnel from its container and restarts it with the new config if the
+// origin IP has changed or the tunnel was degraded. The tunnel is degraded if its origin has no usable network.
+func (h *Handler) refreshTunnel(tunnel *Tunnel) error {
+	if tunnel.Config.isLocal() {
+		return nil
+	}
+
+	container, err := h.Client.Inspect(tunnel.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	origin := container
+	if tunnel.OriginID != "" {
+		origin, err = h.Client.Inspect(tunnel.OriginID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if getLabel(heraIP, container) == "" && !hasUsableNetwork(origin, getLabel(heraIPFrom, container)) {
+		if tunnel.State == TunnelDegraded {
+			return nil
+		}
+
+		log.Warningf("Origin %s of %s has no usable network", origin.ID[:12], tunnel.Config.Hostname)
+
+		return tunnel.Degrade()
+	}
+
+	updated, err := h.rebuildTunnel(container, tunnel.Config.Hostname)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	if updated.Config.IP == tunnel.Config.IP && tunnel.State != TunnelDegraded {
+		return nil
+	}
+
+	// Balanced tunnels keep proxying to the balancer, so only the backend needs to be updated
+	if tunnel.Balancer != nil && tunnel.State != TunnelDegraded {
+		weight, _ := parseWeight(getLabel(heraWeight, container))
+		log.Infof("Origin IP of %s changed from %s to %s", tunnel.Config.Hostname, tunnel.Config.IP, updated.Config.IP)
+		tunnel.Config.IP = updated.Config.IP
+
+		return tunnel.Balancer.Set(container.ID, updated.directURL(), weight)
+	}
+
+	updated.Balancer = tunnel.Balancer
+
+	if tunnel.State == TunnelDegraded {
+		log.Infof("Origin of %s is reachable again", tunnel.Config.Hostname)
+	} else {
+		log.Infof("Origin IP of %s changed from %s to %s", tunnel.Config.Hostname, tunnel.Config.IP, updated.Config.IP)
+	}
+
+	return updated.Start()
+}
+
+// newTunnels returns a tunnel for each port the container publishes, or none if the container has not
+// been labeled, is an ephemeral compose container, its tunnel has expired, or it is outside of its schedule.
+// An error is returned if its ports are invalid, the origin cannot be resolved, or a certificate cannot be found.
+func (h *Handler) newTunnels(container types.ContainerJSON) ([]*Tunnel, error) {
+	if getLabel(heraHostname, container) == "" || h.isEphemeral(container) {
+		return nil, nil
+	}
+
+	routes, err := containerRoutes(container)
+	if err != nil {
+		return nil, err
+	}
+
+	var tunnels []*Tunnel
+	for _, route := range routes {
+		tunnel, err := h.newTunnel(container, route)
+		if err != nil {
+			return nil, err
+		}
+
+		if tunnel != nil {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	return tunnels, nil
+}
+
+// rebuildTunnel returns the tunnel of the container for the hostname, or nil if the container no longer
+// publishes a port on it
+func (h *Handler) rebuildTunnel(container types.ContainerJSON, hostname string) (*Tunnel, error) {
+	tunnels, err := h.newTunnels(container)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tunnel := range tunnels {
+		if tunnel.Config.Hostname == hostname {
+			return tunnel, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// newTunnel returns the tunnel publishing a port of the container on its hostname, or nil if the
+// container has not been labeled, its tunnel has expired, or it is outside of its schedule.
+// An error is returned if the origin cannot be resolved or a certificate cannot be found.
+func (h *Handler) newTunnel(container types.ContainerJSON, route PortRoute) (*Tunnel, error) {
+	latency := NewStartLatency()
+	hostname := route.Hostname
+	port := route.Port
+	supplied_ip := getLabel(heraIP, container)
+	ipFrom := getLabel(heraIPFrom, container)
+	protocol := getLabel(heraProtocol, container)
+	originName := getLabel(heraOrigin, container)
+	detect := protocol == "" && config.DetectProtocol && !h.Simulate
+
+	// Fall back to the configured default for a missing label, the default port is applied by containerRoutes
+	if protocol == "" {
+		protocol = config.DefaultProtocol
+	}
+
+	redirect, err := parseRedirect(container)
+	if err != nil {
+		return nil, err
+	}
+
+	staticDir, err := parseStaticDir(container)
+	if err != nil {
+		return nil, err
+	}
+
+	announce, err := parseAnnounce(container)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redirects and static directories are served by Hera, so they don't need a port
+	local := redirect.Target != "" || staticDir != ""
+	if hostname == "" || (port == "" && !local) {
+		return nil, nil
+	}
+
+	err = checkHostname(hostname, config.DenyHostnames, config.AllowDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired tunnels are not started again while their container keeps running
+	expiresAt, err := getExpiry(container, config.TunnelTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if isExpired(expiresAt, time.Now()) {
+		log.Debugf("Tunnel %s has expired, ignoring %s", hostname, container.ID[:12])
+		return nil, nil
+	}
+
+	// Scheduled tunnels are started once their window begins
+	if value := getLabel(heraSchedule, container); value != "" {
+		schedule, err := ParseSchedule(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if !schedule.IsActive(time.Now()) {
+			log.Infof("Tunnel %s is outside of its schedule, waiting to start %s", hostname, container.ID[:12])
+			return nil, nil
+		}
+	}
+
+	// Check if the tunnel should point at a different container
+	origin := container
+	if originName != "" {
+		origin, err = h.inspectOrigin(originName)
+		if err != nil {
+			return nil, NewError(ErrUnresolvableOrigin, err)
+		}
+	}
+
+	// Tunnels served by Hera have no origin to resolve
+	ip := ""
+	if !local {
+		ip, err = h.resolveIP(origin, supplied_ip, ipFrom)
+		if err != nil {
+			return nil, NewError(ErrUnresolvableOrigin, err)
+		}
+	}
+	latency.Mark("resolve")
+
+	protocolDetected := false
+	if detect && !local {
+		protocol, protocolDetected = detectProtocol(hostname, ip, port)
+	}
+
+	cert, err := getCertificate(hostname)
+	if err != nil && h.Simulate {
+		log.Warningf("%s, using a placeholder certificate", err)
+		cert, err = NewCertificate(hostname+".pem", fs), nil
+	}
+	if err != nil {
+		return nil, NewError(ErrNoCertificate, err)
+	}
+	latency.Mark("cert")
+
+	err = checkTenant(container, hostname, cert, config.Tenants, config.TenantNetworks)
+	if err != nil {
+		return nil, err
+	}
+
+	logLevel, err := parseLogLevel(getLabel(heraLogLevel, container))
+	if err != nil {
+		return nil, err
+	}
+
+	logFile, err := parseLogFile(getLabel(heraLogFile, container))
+	if err != nil {
+		return nil, err
+	}
+
+	args, argsGracePeriod, err := parseCloudflaredArgs(getLabel(heraArgs, container))
+	if err != nil {
+		return nil, err
+	}
+
+	keepAlive, err := parseKeepAlive(container)
+	if err != nil {
+		return nil, err
+	}
+
+	gracePeriod, err := parseGracePeriod(getLabel(heraGrace, container))
+	if err != nil {
+		return nil, err
+	}
+
+	if argsGracePeriod > 0 {
+		if gracePeriod > 0 {
+			return nil, fmt.Errorf("Invalid arguments for %s: --grace-period cannot be combined with %s", heraArgs, heraGrace)
+		}
+		gracePeriod = argsGracePeriod
+	}
+
+	smokeTest, err := parseSmokeTest(container)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnelConfig := &TunnelConfig{
+		IP:          ip,
+		Hostname:    hostname,
+		Port:        port,
+		Protocol:    protocol,
+		LogLevel:    logLevel,
+		LogFile:     logFile,
+		Args:        args,
+		KeepAlive:   keepAlive,
+		GracePeriod: gracePeriod,
+		Redirect:    redirect,
+		StaticDir:   staticDir,
+	}
+
+	tunnel := NewTunnel(tunnelConfig, cert)
+	tunnel.Latency = latency
+	tunnel.ExpiresAt = expiresAt
+	tunnel.ContainerID = container.ID
+	tunnel.Project = getLabel(composeProject, container)
+	tunnel.protocolDetected = protocolDetected
+	tunnel.SmokeTest = smokeTest
+	tunnel.Tags = parseTags(container)
+	tunnel.Announce = announce
+	if originName != "" {
+		tunnel.OriginID = origin.ID
+	}
+	tunnel.Effective = newEffectiveConfig(container, tunnel)
+
+	return tunnel, nil
+}
+
+// handleDieEvent inspects the container from a die event and stops the tunnel if one exists and
+// still belongs to the container. An error is returned if a tunnel cannot be found or if the tunnel fails to stop
 func (h *Handler) handleDieEvent(event events.Message) error {
 	container, err := h.Client.Inspect(event.ID)
 	if err != nil {
 		return err
 	}
 
-	hostname := getLabel("hera.hostname", container)
-	if hostname == "" {
+	if getLabel(heraHostname, container) == "" {
+		return nil
+	}
+
+	startWaits.Cancel(container.ID)
+
+	if h.keepAlive(container) {
 		return nil
 	}
 
-	tunnel, err := GetTunnelForHost(hostname)
+	return releaseContainer(container)
+}
+
+// releaseContainer releases the tunnel of each route of the exited container. Every route is released
+// even if others fail, and the errors are returned together.
+func releaseContainer(container types.ContainerJSON) error {
+	routes, err := containerRoutes(container)
 	if err != nil {
 		return err
 	}
 
-	err = tunnel.Stop()
+	var errs []error
+	for _, route := range routes {
+		tunnel, err := registry.FindByHostname(route.Hostname)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = releaseTunnel(tunnel, container.ID)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// combineErrors returns nil for no errors, the error itself for a single error, and an error listing
+// the messages of several errors otherwise
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// releaseTunnel stops routing the tunnel to the container with the given ID, and stops the tunnel and
+// removes it from the registry unless other weighted containers remain
+func releaseTunnel(tunnel *Tunnel, id string) error {
+	hostname := tunnel.Config.Hostname
+
+	// Keep the tunnel running while other weighted containers remain
+	if tunnel.Balancer != nil && tunnel.Balancer.Has(id) {
+		if tunnel.Balancer.Remove(id) > 0 {
+			log.Infof("Stopped routing to %s for %s", shortID(id), hostname)
+
+			if tunnel.ContainerID == id {
+				registry.Remove(tunnel)
+				tunnel.ContainerID = tunnel.Balancer.Backends()[0].ContainerID
+				registry.Add(tunnel)
+			}
+
+			return nil
+		}
+
+		balancers.Remove(hostname)
+	} else if !tunnel.IsOwnedBy(id) {
+		// The hostname may have been claimed by a newer container in the meantime
+		log.Infof("Tunnel %s belongs to %s, ignoring stop of %s", hostname, shortID(tunnel.ContainerID), shortID(id))
+		return nil
+	}
+
+	stopped, err := tunnel.Stop()
 	if err != nil {
 		return err
 	}
 
+	if !stopped {
+		log.Debugf("Tunnel %s was already stopped", hostname)
+	}
+
+	registry.Remove(tunnel)
+
+	return nil
+}
+
+// handleDestroyEvent forgets a removed container. Containers removed while stopped have no die event
+// to follow, so they are dropped from the pending containers and any tunnel still routing to them is
+// stopped and removed from the registry.
+func handleDestroyEvent(event events.Message) error {
+	restarts.Cancel(event.ID)
+	startWaits.Cancel(event.ID)
+	pendingCertificates.Remove(event.ID)
+	pendingDependencies.Remove(event.ID)
+
+	for _, tunnel := range registry.List() {
+		if tunnel.ContainerID != event.ID && (tunnel.Balancer == nil || !tunnel.Balancer.Has(event.ID)) {
+			continue
+		}
+
+		log.Infof("Container %s of tunnel %s was removed", shortID(event.ID), tunnel.Config.Hostname)
+
+		err := releaseTunnel(tunnel, event.ID)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// handleOriginStartEvent starts the tunnels of running containers that reference the started
+// container with the hera.origin-container label
+func (h *Handler) handleOriginStartEvent(event events.Message) error {
+	containers, err := h.Client.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	var dependents []types.Container
+	for _, c := range containers {
+		if c.ID != event.ID && c.Labels[heraOrigin] != "" {
+			dependents = append(dependents, c)
+		}
+	}
+
+	if len(dependents) == 0 {
+		return nil
+	}
+
+	container, err := h.Client.Inspect(event.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range dependents {
+		if !isOriginReference(c.Labels[heraOrigin], container) {
+			continue
+		}
+
+		log.Infof("Origin %s started, reconnecting %s", container.ID[:12], c.ID[:12])
+
+		err := h.HandleContainer(c.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleOriginDieEvent stops the tunnels pointing at a container referenced with the
+// hera.origin-container label
+func (h *Handler) handleOriginDieEvent(event events.Message) error {
+	tunnels := registry.FindByOrigin(event.ID)
+	if len(tunnels) == 0 {
+		return nil
+	}
+
+	log.Infof("Origin %s stopped", event.ID[:12])
+
+	for _, tunnel := range tunnels {
+		_, err := tunnel.Stop()
+		if err != nil {
+			return err
+		}
+
+		registry.Remove(tunnel)
+	}
+
+	return nil
+}
+
+// inspectOrigin returns the running container referenced by name or ID with the hera.origin-container label.
+// An error is returned if the container cannot be found or is not running.
+func (h *Handler) inspectOrigin(name string) (types.ContainerJSON, error) {
+	origin, err := h.Client.Inspect(name)
+	if err != nil {
+		return origin, fmt.Errorf("Unable to find origin container %s: %s", name, err)
+	}
+
+	if origin.State == nil || !origin.State.Running {
+		return origin, fmt.Errorf("Origin container %s is not running", name)
+	}
+
+	return origin, nil
+}
+
+// startTunnel starts the tunnel once the container is ready
+func (h *Handler) startTunnel(tunnel *Tunnel, container types.ContainerJSON) error {
+	return h.whenReady(tunnel, container, tunnel.Start)
+}
+
+// whenReady calls start once the hera.readiness-cmd command of the container succeeds and, in low memory
+// mode, the origin of the tunnel is reachable. The waits run in the background so a slow container does
+// not hold up the events of others, and start is handed back to the event loop unless the container died,
+// was removed, or was started again meanwhile.
+func (h *Handler) whenReady(tunnel *Tunnel, container types.ContainerJSON, start func() error) error {
+	if getLabel(heraReady, container) == "" && (!config.LowMemory || tunnel.Config.isLocal()) {
+		tunnel.Latency.Mark("readiness")
+
+		return start()
+	}
+
+	log.Infof("Waiting for %s to be ready before starting %s", shortID(container.ID), tunnel.Config.Hostname)
+	generation := startWaits.Begin(container.ID)
+
+	go func() {
+		err := h.waitUntilReady(container)
+		if err == nil {
+			err = waitUntilReachable(tunnel)
+		}
+
+		eventLoop.Do(func() {
+			if !startWaits.Finish(container.ID, generation) {
+				log.Debugf("Container %s changed while waiting for it to be ready, not starting %s", shortID(container.ID), tunnel.Config.Hostname)
+				return
+			}
+
+			if err == nil {
+				tunnel.Latency.Mark("readiness")
+				err = start()
+			}
+
+			if err != nil {
+				reportError(err, container.ID)
+			}
+		})
+	}()
+
+	return nil
+}
+
+// waitUntilReady runs the hera.readiness-cmd command inside the container until it succeeds.
+// An error is returned if the command has not succeeded after thirty attempts.
+func (h *Handler) waitUntilReady(container types.ContainerJSON) error {
+	cmd := getLabel(heraReady, container)
+	if cmd == "" {
+		return nil
+	}
+
+	attempts := 0
+	maxAttempts := 30
+
+	for attempts < maxAttempts {
+		attempts++
+
+		code, err := h.Client.Exec(container.ID, []string{"sh", "-c", cmd})
+		if err == nil && code == 0 {
+			return nil
+		}
+
+		log.Infof("Waiting for %s to be ready... (%d/%d)", container.ID[:12], attempts, maxAttempts)
+		time.Sleep(2 * time.Second)
+	}
+
+	return fmt.Errorf("Container %s did not become ready", container.ID[:12])
+}
+
+// waitUntilReachable delays starting cloudflared in low memory mode until the origin of the tunnel
+// accepts connections. An error is returned if the origin is not reachable after thirty attempts.
+func waitUntilReachable(tunnel *Tunnel) error {
+	if !config.LowMemory || tunnel.Config.isLocal() {
+		return nil
+	}
+
+	address := net.JoinHostPort(tunnel.Config.IP, tunnel.Config.Port)
+	attempts := 0
+	maxAttempts := 30
+
+	for attempts < maxAttempts {
+		attempts++
+
+		conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		log.Infof("Waiting for %s to be reachable... (%d/%d)", address, attempts, maxAttempts)
+		time.Sleep(2 * time.Second)
+	}
+
+	return NewError(ErrUnresolvableOrigin, fmt.Errorf("Origin %s of %s is not reachable", address, tunnel.Config.Hostname))
+}
+
+// resolveIP returns the IP address the tunnel should connect to. A supplied IP takes precedence,
+// followed by the container network IP within the ipFrom CIDR, and finally the resolved hostname.
+func (h *Handler) resolveIP(container types.ContainerJSON, suppliedIP string, ipFrom string) (string, error) {
+	if suppliedIP != "" {
+		if net.ParseIP(suppliedIP) == nil {
+			return "", fmt.Errorf("Invalid IP address for %s: %s", heraIP, suppliedIP)
+		}
+
+		return suppliedIP, nil
+	}
+
+	if ipFrom != "" {
+		return getNetworkIP(ipFrom, container)
+	}
+
+	return h.resolveHostname(container)
+}
+
 // resolveHostname returns the IP address of a container from its hostname.
 // An error is returned if the hostname cannot be resolved after five attempts.
 func (h *Handler) resolveHostname(container types.ContainerJSON) (string, error) {
@@ -154,7 +967,9 @@ func (h *Handler) resolveHostname(container types.ContainerJSON) (string, error)
 
 	for attempts < maxAttempts {
 		attempts++
-		resolved, err = net.LookupHost(container.Config.Hostname)
+		ctx, cancel := context.WithTimeout(context.Background(), config.ResolverTimeout)
+		resolved, err = h.Resolver.LookupHost(ctx, container.Config.Hostname)
+		cancel()
 
 		if err != nil {
 			time.Sleep(2 * time.Second)
@@ -169,25 +984,180 @@ func (h *Handler) resolveHostname(container types.ContainerJSON) (string, error)
 	return "", fmt.Errorf("Unable to connect to %s", container.ID[:12])
 }
 
-// getLabel returns the label value from a given label name and container JSON.
+// newResolver returns a resolver that sends all queries to the DNS server at the given address,
+// or the system resolver if no address is given
+func newResolver(address string) *net.Resolver {
+	if address == "" {
+		return net.DefaultResolver
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+
+	return resolver
+}
+
+// getLabel returns the label value from a given label name and container JSON. A missing label falls back
+// to the environment of the container with HERA_ENV_LABELS, then to the defaults of its domain.
 func getLabel(name string, container types.ContainerJSON) string {
 	value, ok := container.Config.Labels[name]
-	if !ok {
-		return ""
+	if ok {
+		return value
 	}
 
+	if config.EnvLabels {
+		if value := getEnvLabel(name, container); value != "" {
+			return value
+		}
+	}
+
+	value, _ = getDomainLabel(name, container)
+
 	return value
 }
 
-// getCertificate returns a Certificate for a given hostname.
+// isStartupConnect returns true if the network event was emitted while the container was being started,
+// in which case the start event that follows will create the tunnel
+func isStartupConnect(event events.Message, container types.ContainerJSON) bool {
+	started, err := time.Parse(time.RFC3339Nano, container.State.StartedAt)
+	if err != nil || event.TimeNano == 0 {
+		return false
+	}
+
+	return event.TimeNano <= started.UnixNano()
+}
+
+// hasUsableNetwork returns true if the container has a network IP, within the ipFrom CIDR when given
+func hasUsableNetwork(container types.ContainerJSON, ipFrom string) bool {
+	if ipFrom != "" {
+		_, err := getNetworkIP(ipFrom, container)
+		return err == nil
+	}
+
+	if container.NetworkSettings == nil {
+		return false
+	}
+
+	for _, endpoint := range container.NetworkSettings.Networks {
+		if endpoint != nil && endpoint.IPAddress != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isOriginReference returns true if the given hera.origin-container label value refers to the container
+func isOriginReference(reference string, container types.ContainerJSON) bool {
+	if reference == "" {
+		return false
+	}
+
+	name := strings.TrimPrefix(container.Name, "/")
+
+	return reference == name || strings.HasPrefix(container.ID, reference)
+}
+
+// getNetworkIP returns the IP address of the first container network that falls within the given CIDR.
+// An error is returned if the CIDR cannot be parsed or if no network IP matches.
+func getNetworkIP(cidr string, container types.ContainerJSON) (string, error) {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("Invalid CIDR for %s: %s", heraIPFrom, cidr)
+	}
+
+	if container.NetworkSettings != nil {
+		var names []string
+		for name := range container.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			endpoint := container.NetworkSettings.Networks[name]
+			if endpoint == nil {
+				continue
+			}
+
+			ip := net.ParseIP(endpoint.IPAddress)
+			if ip != nil && subnet.Contains(ip) {
+				return endpoint.IPAddress, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("No network IP for %s within %s", container.ID[:12], cidr)
+}
+
+// parseLogLevel returns the cloudflared log level from a hera.cloudflared-loglevel label value.
+// An error is returned if the level is not supported by cloudflared.
+func parseLogLevel(level string) (string, error) {
+	switch level {
+	case "", "debug", "info", "warn", "error", "fatal":
+		return level, nil
+	}
+
+	return "", fmt.Errorf("Invalid log level for %s: %s", heraLogLevel, level)
+}
+
+// parseGracePeriod returns the duration from a hera.grace-period label value
+func parseGracePeriod(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil || gracePeriod < 0 {
+		return 0, fmt.Errorf("Invalid grace period for %s: %s", heraGrace, value)
+	}
+
+	return gracePeriod, nil
+}
+
+// parseLogFile returns the full path of the log file from a hera.cloudflared-logfile label value.
+// The path is relative to the log directory, and an error is returned if it points outside of it.
+func parseLogFile(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	path := filepath.Join(LogDir, strings.TrimPrefix(name, LogDir))
+	if !strings.HasPrefix(path, LogDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("Invalid log file for %s: %s must be within %s", heraLogFile, name, LogDir)
+	}
+
+	return path, nil
+}
+
+// getCertificate returns a Certificate for a given hostname, preferring the certificate set by the defaults
+// of its domain, then a certificate for the exact hostname over the certificate for its root domain.
 // An error is returned if the root hostname cannot be parsed or if the certificate cannot be found.
 func getCertificate(hostname string) (*Certificate, error) {
+	cert, err := getDomainCertificate(hostname)
+	if err != nil || cert != nil {
+		return cert, err
+	}
+
+	cert, err = FindCertificateForHost(hostname, fs)
+	if err == nil {
+		return cert, nil
+	}
+
 	rootHostname, err := getRootDomain(hostname)
 	if err != nil {
 		return nil, err
 	}
 
-	cert, err := FindCertificateForHost(rootHostname, afero.NewOsFs())
+	cert, err = FindCertificateForHost(rootHostname, fs)
 	if err != nil {
 		return nil, err
 	}
@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/spf13/afero"
 )
 
 func TestGetRootDomain(t *testing.T) {
@@ -22,4 +30,345 @@ func TestGetRootDomain(t *testing.T) {
 			t.Errorf("Unexpected domain, got %s", actual)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func newContainerWithNetworks(networks map[string]string) types.ContainerJSON {
+	endpoints := make(map[string]*network.EndpointSettings)
+	for name, ip := range networks {
+		endpoints[name] = &network.EndpointSettings{IPAddress: ip}
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "5aa5a300dd0e5aa5a300dd0e"},
+		NetworkSettings:   &types.NetworkSettings{Networks: endpoints},
+	}
+}
+
+func TestGetNetworkIP(t *testing.T) {
+	container := newContainerWithNetworks(map[string]string{
+		"bridge": "172.17.0.2",
+		"hera":   "172.20.0.5",
+	})
+
+	ip, err := getNetworkIP("172.20.0.0/16", container)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ip != "172.20.0.5" {
+		t.Errorf("Unexpected network IP, got %s", ip)
+	}
+
+	_, err = getNetworkIP("10.0.0.0/8", container)
+	if err == nil {
+		t.Error("Expected error for unmatched CIDR")
+	}
+
+	_, err = getNetworkIP("not-a-cidr", container)
+	if err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestResolveSuppliedIP(t *testing.T) {
+	handler := NewHandler(nil)
+	container := newContainerWithNetworks(map[string]string{})
+
+	ip, err := handler.resolveIP(container, "192.168.1.10", "")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ip != "192.168.1.10" {
+		t.Errorf("Unexpected IP, got %s", ip)
+	}
+
+	_, err = handler.resolveIP(container, "192.168.1", "")
+	if err == nil {
+		t.Error("Expected error for invalid IP")
+	}
+}
+
+func TestIsOriginReference(t *testing.T) {
+	container := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   "5aa5a300dd0e5aa5a300dd0e",
+			Name: "/backend",
+		},
+	}
+
+	references := map[string]bool{
+		"backend":      true,
+		"5aa5a300dd0e": true,
+		"frontend":     false,
+		"":             false,
+	}
+
+	for reference, expected := range references {
+		if isOriginReference(reference, container) != expected {
+			t.Errorf("Unexpected origin reference result for %q", reference)
+		}
+	}
+}
+
+func TestHasUsableNetwork(t *testing.T) {
+	container := newContainerWithNetworks(map[string]string{"hera": "172.20.0.5"})
+
+	if !hasUsableNetwork(container, "") {
+		t.Error("Expected container to have a usable network")
+	}
+
+	if hasUsableNetwork(container, "10.0.0.0/8") {
+		t.Error("Expected no usable network within CIDR")
+	}
+
+	container = newContainerWithNetworks(map[string]string{})
+	if hasUsableNetwork(container, "") {
+		t.Error("Expected container without networks to be unusable")
+	}
+}
+
+func TestIsStartupConnect(t *testing.T) {
+	started := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	container := newContainerWithNetworks(map[string]string{})
+	container.State = &types.ContainerState{StartedAt: started.Format(time.RFC3339Nano)}
+
+	event := events.Message{TimeNano: started.Add(-time.Millisecond).UnixNano()}
+	if !isStartupConnect(event, container) {
+		t.Error("Expected connect before start to be a startup connect")
+	}
+
+	event = events.Message{TimeNano: started.Add(time.Minute).UnixNano()}
+	if isStartupConnect(event, container) {
+		t.Error("Expected connect after start to not be a startup connect")
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if newResolver("") != net.DefaultResolver {
+		t.Error("Expected the system resolver without an address")
+	}
+
+	addresses := map[string]string{
+		"127.0.0.1:5353": "127.0.0.1:5353",
+		"127.0.0.1":      "127.0.0.1:53",
+	}
+
+	for address, expected := range addresses {
+		resolver := newResolver(address)
+
+		// Dialing UDP does not send anything, so no DNS server is needed
+		conn, err := resolver.Dial(context.Background(), "udp", "8.8.8.8:53")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if conn.RemoteAddr().String() != expected {
+			t.Errorf("Unexpected resolver address, got %s", conn.RemoteAddr())
+		}
+		conn.Close()
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	levels := map[string]bool{"": true, "debug": true, "fatal": true, "verbose": false}
+
+	for level, valid := range levels {
+		_, err := parseLogLevel(level)
+		if (err == nil) != valid {
+			t.Errorf("Unexpected result for log level %q", level)
+		}
+	}
+}
+
+func TestParseGracePeriod(t *testing.T) {
+	periods := map[string]time.Duration{"": 0, "30s": 30 * time.Second, "2m": 2 * time.Minute}
+
+	for value, expected := range periods {
+		gracePeriod, err := parseGracePeriod(value)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if gracePeriod != expected {
+			t.Errorf("Unexpected grace period for %q, got %s", value, gracePeriod)
+		}
+	}
+
+	for _, value := range []string{"30", "-5s", "soon"} {
+		if _, err := parseGracePeriod(value); err == nil {
+			t.Errorf("Expected error for grace period %q", value)
+		}
+	}
+}
+
+func TestParseLogFile(t *testing.T) {
+	files := map[string]string{
+		"":                            "",
+		"debug.log":                   "/var/log/hera/debug.log",
+		"app/debug.log":               "/var/log/hera/app/debug.log",
+		"/var/log/hera/app/debug.log": "/var/log/hera/app/debug.log",
+	}
+
+	for name, expected := range files {
+		path, err := parseLogFile(name)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if path != expected {
+			t.Errorf("Unexpected log file for %q, got %s", name, path)
+		}
+	}
+
+	for _, name := range []string{"../../etc/passwd", "/var/log/hera"} {
+		_, err := parseLogFile(name)
+		if err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte{}, 0644)
+	afero.WriteFile(fs, "/certs/app.example.com.pem", []byte{}, 0644)
+
+	hostnames := map[string]string{
+		"app.example.com":  "app.example.com.pem",
+		"blog.example.com": "example.com.pem",
+		"example.com":      "example.com.pem",
+	}
+
+	for hostname, expected := range hostnames {
+		cert, err := getCertificate(hostname)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cert.Name != expected {
+			t.Errorf("Unexpected certificate for %s, got %s", hostname, cert.Name)
+		}
+	}
+
+	_, err := getCertificate("example.org")
+	if err == nil {
+		t.Error("Expected error for hostname without certificate")
+	}
+}
+
+func TestParseCloudflaredArgs(t *testing.T) {
+	args, gracePeriod, err := parseCloudflaredArgs(`--grace-period 45s --retries 10 --tag "env=my app's"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `'--grace-period' '45s' '--retries' '10' '--tag' 'env=my app'\''s'`
+	if args != expected {
+		t.Errorf("Unexpected args, got %s want %s", args, expected)
+	}
+
+	if gracePeriod != 45*time.Second {
+		t.Errorf("Expected grace period from the args, got %s", gracePeriod)
+	}
+
+	invalid := []string{"grace-period 45s", "--url http://evil", "--grace-period=soon", "--origincert=/tmp/cert.pem", `--tag "unterminated`}
+	for _, value := range invalid {
+		if _, _, err := parseCloudflaredArgs(value); err == nil {
+			t.Errorf("Expected error for %s", value)
+		}
+	}
+}
+
+func TestHandleDestroyEvent(t *testing.T) {
+	registry = NewRegistry()
+	pendingCertificates = NewPendingContainers()
+	pendingDependencies = NewPendingContainers()
+
+	stopped := false
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			stopped = true
+			return []byte(""), nil
+		},
+	}
+	registry.Add(tunnel)
+	registry.Add(newRegistryTunnel("other.tld", "container-b"))
+
+	pendingCertificates.Add("container-a", "site.tld")
+	pendingDependencies.Add("container-a", "site.tld")
+
+	err := handleDestroyEvent(events.Message{ID: "container-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stopped {
+		t.Error("Expected the tunnel of the removed container to be stopped")
+	}
+
+	if _, err := registry.FindByHostname("site.tld"); err == nil {
+		t.Error("Expected the tunnel of the removed container to be unregistered")
+	}
+
+	if _, err := registry.FindByHostname("other.tld"); err != nil {
+		t.Error("Expected the tunnels of other containers to remain")
+	}
+
+	if pendingCertificates.Has("container-a") || pendingDependencies.Has("container-a") {
+		t.Error("Expected the removed container to no longer be pending")
+	}
+}
+
+func TestHandleDestroyEventWeighted(t *testing.T) {
+	registry = NewRegistry()
+
+	balancer, err := NewBalancer("site.tld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	balancer.Set("container-a", "http://172.23.0.4:80", 1)
+	balancer.Set("container-b", "http://172.23.0.5:80", 1)
+
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Balancer = balancer
+	registry.Add(tunnel)
+
+	err = handleDestroyEvent(events.Message{ID: "container-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := registry.FindByHostname("site.tld")
+	if err != nil {
+		t.Fatal("Expected the tunnel to remain while other weighted containers remain")
+	}
+
+	if found.ContainerID != "container-b" || balancer.Has("container-a") {
+		t.Errorf("Expected the tunnel to route to the remaining container, got %s", found.ContainerID)
+	}
+}
+
+func TestReleaseContainerReleasesEveryRoute(t *testing.T) {
+	registry = NewRegistry()
+
+	container := newTenantContainer(map[string]string{heraHostname: "{{.Port}}.example.com", heraPort: "8080,9090"})
+
+	tunnel := newRegistryTunnel("9090.example.com", container.ID)
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(""), nil
+		},
+	}
+	registry.Add(tunnel)
+
+	err := releaseContainer(container)
+	if err == nil {
+		t.Error("Expected an error for the route without a tunnel")
+	}
+
+	if _, err := registry.FindByHostname("9090.example.com"); err == nil {
+		t.Error("Expected the remaining route to be released")
+	}
+}
@@ -0,0 +1,102 @@
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Cloudflared is a stub of a cloudflared process. It serves the metrics endpoint Hera scrapes with
+// connected tunnel connections, without connecting to Cloudflare.
+type Cloudflared struct {
+	// Config holds the settings of the config file, such as hostname, url, and metrics
+	Config map[string]string
+
+	// Connections is the number of edge connections reported in the metrics
+	Connections int
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewCloudflared returns a stub for the contents of a cloudflared config file
+func NewCloudflared(contents []byte) *Cloudflared {
+	cloudflared := &Cloudflared{
+		Config:      ParseConfig(contents),
+		Connections: 4,
+	}
+
+	return cloudflared
+}
+
+// ParseConfig returns the top-level settings of a cloudflared config file
+func ParseConfig(contents []byte) map[string]string {
+	settings := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			settings[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return settings
+}
+
+// Start serves the metrics endpoint on the metrics address of the config
+func (c *Cloudflared) Start() error {
+	address := c.Config["metrics"]
+	if address == "" {
+		return fmt.Errorf("No metrics address in the cloudflared config")
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.listener = listener
+	c.mu.Unlock()
+
+	go http.Serve(listener, http.HandlerFunc(c.serveMetrics))
+
+	return nil
+}
+
+// Stop stops serving the metrics endpoint, as if the process exited
+func (c *Cloudflared) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.listener != nil {
+		c.listener.Close()
+		c.listener = nil
+	}
+}
+
+// serveMetrics writes the metrics of a connected tunnel that has served no requests
+func (c *Cloudflared) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.mu.Lock()
+	connections := c.Connections
+	c.mu.Unlock()
+
+	fmt.Fprintf(w, "cloudflared_tunnel_ha_connections %d\n", connections)
+	fmt.Fprintln(w, "cloudflared_tunnel_total_requests 0")
+	fmt.Fprintln(w, "cloudflared_tunnel_concurrent_requests_per_tunnel 0")
+}
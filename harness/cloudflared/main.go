@@ -0,0 +1,55 @@
+// Command cloudflared is a stub of cloudflared for end-to-end tests of a Hera container. Install it in
+// place of /usr/bin/cloudflared and it serves the metrics of a connected tunnel on the address of its
+// config file, or of its --metrics flag, until it is stopped.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"hera/harness"
+)
+
+func main() {
+	var contents []byte
+
+	args := os.Args[1:]
+	for i, arg := range args {
+		switch {
+		case arg == "--config" && i+1 < len(args):
+			config, err := ioutil.ReadFile(args[i+1])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			contents = append(contents, config...)
+			contents = append(contents, '\n')
+
+		case arg == "--metrics" && i+1 < len(args):
+			contents = append(contents, []byte("metrics: "+args[i+1]+"\n")...)
+
+		case strings.HasPrefix(arg, "--metrics="):
+			contents = append(contents, []byte("metrics: "+strings.TrimPrefix(arg, "--metrics=")+"\n")...)
+		}
+	}
+
+	cloudflared := harness.NewCloudflared(contents)
+
+	err := cloudflared.Start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Registered tunnel connection for %s\n", cloudflared.Config["hostname"])
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	cloudflared.Stop()
+}
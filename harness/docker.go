@@ -0,0 +1,341 @@
+// Package harness provides fakes for writing end-to-end tests of Hera's label scenarios without a Docker
+// daemon or a Cloudflare account: a scriptable Docker Engine API with an event stream, a supervisor
+// standing in for s6, and a stub cloudflared that reports connected tunnels.
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+)
+
+// apiVersion is stripped from request paths, since the fake answers every API version the same way
+var apiVersion = regexp.MustCompile(`^/v[0-9.]+`)
+
+// Docker is a fake Docker Engine API. Containers are scripted with Run and Stop, which emit the same
+// events as the daemon to every subscriber of the event stream. Point a Docker client at Host, or set
+// DOCKER_HOST to it when running the Hera binary.
+type Docker struct {
+	Server *httptest.Server
+
+	// ExecExitCode returns the exit code of a command run in a container, such as a hera.readiness-cmd.
+	// Commands exit with 0 if it is nil.
+	ExecExitCode func(id string, cmd []string) int
+
+	mu          sync.Mutex
+	containers  map[string]types.ContainerJSON
+	order       []string
+	execs       map[string]*types.ContainerExecInspect
+	subscribers map[chan events.Message]bool
+}
+
+// NewDocker starts a fake Docker Engine API with no containers
+func NewDocker() *Docker {
+	docker := &Docker{
+		containers:  make(map[string]types.ContainerJSON),
+		execs:       make(map[string]*types.ContainerExecInspect),
+		subscribers: make(map[chan events.Message]bool),
+	}
+	docker.Server = httptest.NewServer(http.HandlerFunc(docker.serve))
+
+	return docker
+}
+
+// Host returns the address of the fake for a Docker client or DOCKER_HOST
+func (d *Docker) Host() string {
+	return "tcp://" + strings.TrimPrefix(d.Server.URL, "http://")
+}
+
+// Close ends the event streams and stops the fake
+func (d *Docker) Close() {
+	d.mu.Lock()
+	for subscriber := range d.subscribers {
+		close(subscriber)
+		delete(d.subscribers, subscriber)
+	}
+	d.mu.Unlock()
+
+	d.Server.Close()
+}
+
+// NewContainer returns a running container with the ID, labels, and an IP on the bridge network. The
+// hostname of the container is its IP, so Hera resolves it without the embedded DNS server of Docker.
+func NewContainer(id string, labels map[string]string, ip string) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    id,
+			Name:  "/" + id[:12],
+			State: &types.ContainerState{Running: true, Status: "running", StartedAt: time.Now().UTC().Format(time.RFC3339Nano)},
+		},
+		Config: &container.Config{Hostname: ip, Labels: labels},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {NetworkID: "bridge", IPAddress: ip},
+			},
+		},
+	}
+}
+
+// Add adds a container without emitting an event, such as one running before Hera starts
+func (d *Docker) Add(c types.ContainerJSON) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.containers[c.ID]; !ok {
+		d.order = append(d.order, c.ID)
+	}
+	d.containers[c.ID] = c
+}
+
+// Run adds a running container and emits its start event
+func (d *Docker) Run(c types.ContainerJSON) {
+	c.State.Running = true
+	c.State.Status = "running"
+	d.Add(c)
+
+	d.Emit(containerEvent(c, "start"))
+}
+
+// Stop marks the container as exited and emits its die event. An error is returned if the container
+// does not exist.
+func (d *Docker) Stop(id string) error {
+	d.mu.Lock()
+	c, ok := d.containers[id]
+	if ok {
+		state := *c.State
+		state.Running = false
+		state.Status = "exited"
+		c.State = &state
+		d.containers[id] = c
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("No such container: %s", id)
+	}
+
+	d.Emit(containerEvent(c, "die"))
+
+	return nil
+}
+
+// Remove removes the container and emits its destroy event
+func (d *Docker) Remove(id string) {
+	d.mu.Lock()
+	c, ok := d.containers[id]
+	delete(d.containers, id)
+	for i, existing := range d.order {
+		if existing == id {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+	d.mu.Unlock()
+
+	if ok {
+		d.Emit(containerEvent(c, "destroy"))
+	}
+}
+
+// Emit sends an event to every subscriber of the event stream
+func (d *Docker) Emit(event events.Message) {
+	if event.TimeNano == 0 {
+		now := time.Now()
+		event.Time = now.Unix()
+		event.TimeNano = now.UnixNano()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for subscriber := range d.subscribers {
+		subscriber <- event
+	}
+}
+
+// containerEvent returns the event the daemon emits for the action of a container
+func containerEvent(c types.ContainerJSON, action string) events.Message {
+	attributes := map[string]string{"name": strings.TrimPrefix(c.Name, "/")}
+	for name, value := range c.Config.Labels {
+		attributes[name] = value
+	}
+
+	return events.Message{
+		ID:     c.ID,
+		Status: action,
+		From:   c.Config.Image,
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor:  events.Actor{ID: c.ID, Attributes: attributes},
+	}
+}
+
+// serve answers the requests of the Docker client Hera uses
+func (d *Docker) serve(w http.ResponseWriter, r *http.Request) {
+	path := apiVersion.ReplaceAllString(r.URL.Path, "")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+
+	case path == "/version":
+		writeJSON(w, types.Version{Version: "harness", APIVersion: "1.22", Os: "linux", Arch: "amd64"})
+
+	case path == "/events":
+		d.serveEvents(w, r)
+
+	case path == "/containers/json":
+		writeJSON(w, d.list())
+
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "json":
+		d.mu.Lock()
+		c, ok := d.containers[parts[1]]
+		d.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "No such container: "+parts[1])
+			return
+		}
+		writeJSON(w, c)
+
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "exec" && r.Method == "POST":
+		d.createExec(w, r, parts[1])
+
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "start" && r.Method == "POST":
+		w.WriteHeader(http.StatusOK)
+
+	case len(parts) == 3 && parts[0] == "exec" && parts[2] == "json":
+		d.mu.Lock()
+		inspect, ok := d.execs[parts[1]]
+		d.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "No such exec instance: "+parts[1])
+			return
+		}
+		writeJSON(w, inspect)
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("page not found: %s %s", r.Method, path))
+	}
+}
+
+// list returns the running containers in the order they were added
+func (d *Docker) list() []types.Container {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	containers := []types.Container{}
+	for _, id := range d.order {
+		c := d.containers[id]
+		if !c.State.Running {
+			continue
+		}
+
+		containers = append(containers, types.Container{
+			ID:     c.ID,
+			Names:  []string{c.Name},
+			Labels: c.Config.Labels,
+			State:  c.State.Status,
+		})
+	}
+
+	return containers
+}
+
+// createExec runs a command in a container, which exits immediately with the code from ExecExitCode
+func (d *Docker) createExec(w http.ResponseWriter, r *http.Request, id string) {
+	var config types.ExecConfig
+	json.NewDecoder(r.Body).Decode(&config)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.containers[id]; !ok {
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return
+	}
+
+	code := 0
+	if d.ExecExitCode != nil {
+		code = d.ExecExitCode(id, config.Cmd)
+	}
+
+	execID := fmt.Sprintf("exec%d", len(d.execs))
+	d.execs[execID] = &types.ContainerExecInspect{ExecID: execID, ContainerID: id, ExitCode: code}
+
+	writeJSON(w, types.IDResponse{ID: execID})
+}
+
+// serveEvents streams events to the client until it disconnects or the fake is closed
+func (d *Docker) serveEvents(w http.ResponseWriter, r *http.Request) {
+	subscriber := make(chan events.Message, 64)
+
+	d.mu.Lock()
+	d.subscribers[subscriber] = true
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		if d.subscribers[subscriber] {
+			delete(d.subscribers, subscriber)
+			close(subscriber)
+		}
+		d.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	encoder := json.NewEncoder(w)
+	notify := r.Context().Done()
+
+	for {
+		select {
+		case event, ok := <-subscriber:
+			if !ok {
+				return
+			}
+
+			if encoder.Encode(event) != nil {
+				return
+			}
+			flush(w)
+
+		case <-notify:
+			return
+		}
+	}
+}
+
+// writeJSON writes a value as a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error response the way the daemon does
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// flush sends buffered output to the client
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
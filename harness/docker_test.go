@@ -0,0 +1,67 @@
+package harness
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+func TestDocker(t *testing.T) {
+	docker := NewDocker()
+	defer docker.Close()
+
+	cli, err := client.NewClient(docker.Host(), "v1.22", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, _ := cli.Events(context.Background(), types.EventsOptions{})
+
+	id := "5aa5a300dd0e5aa5a300dd0e"
+	docker.Run(NewContainer(id, map[string]string{"hera.hostname": "app.example.com"}, "172.17.0.2"))
+
+	select {
+	case event := <-messages:
+		if event.Action != "start" || event.ID != id || event.Actor.Attributes["hera.hostname"] != "app.example.com" {
+			t.Errorf("Unexpected event, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the start event")
+	}
+
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
+	if err != nil || len(containers) != 1 || containers[0].ID != id {
+		t.Errorf("Unexpected containers, got %v, %v", containers, err)
+	}
+
+	docker.Stop(id)
+
+	container, err := cli.ContainerInspect(context.Background(), id)
+	if err != nil || container.State.Running {
+		t.Errorf("Expected the container to be stopped, got %v", err)
+	}
+
+	containers, _ = cli.ContainerList(context.Background(), types.ContainerListOptions{})
+	if len(containers) != 0 {
+		t.Errorf("Expected no running containers, got %d", len(containers))
+	}
+
+	_, err = cli.ContainerInspect(context.Background(), "missing")
+	if err == nil {
+		t.Error("Expected an error for a missing container")
+	}
+
+	docker.ExecExitCode = func(id string, cmd []string) int { return 3 }
+	exec, err := cli.ContainerExecCreate(context.Background(), id, types.ExecConfig{Cmd: []string{"true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inspect, err := cli.ContainerExecInspect(context.Background(), exec.ID)
+	if err != nil || inspect.ExitCode != 3 {
+		t.Errorf("Unexpected exec result, got %v, %v", inspect, err)
+	}
+}
@@ -0,0 +1,186 @@
+package harness
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// metricsFlag finds the metrics address of a cloudflared started without a config file
+var metricsFlag = regexp.MustCompile(`--metrics[ =](\S+)`)
+
+// Supervisor stands in for s6 by answering the s6 commands Hera runs. It implements Hera's Commander
+// interface, and starts a stub Cloudflared for each service from the config file or run file Hera
+// wrote to Fs.
+type Supervisor struct {
+	Fs afero.Fs
+
+	mu      sync.Mutex
+	running map[string]*Cloudflared
+	starts  map[string]int
+	pids    int
+}
+
+// NewSupervisor returns a Supervisor for the services Hera writes to fs
+func NewSupervisor(fs afero.Fs) *Supervisor {
+	supervisor := &Supervisor{
+		Fs:      fs,
+		running: make(map[string]*Cloudflared),
+		starts:  make(map[string]int),
+		pids:    100,
+	}
+
+	return supervisor
+}
+
+// Run answers an s6 command for a service directory
+func (s *Supervisor) Run(name string, arg ...string) ([]byte, error) {
+	if len(arg) == 0 {
+		return nil, fmt.Errorf("%s: missing arguments", name)
+	}
+	path := arg[len(arg)-1]
+
+	switch {
+	case name == "s6-svscanctl":
+		return nil, s.scan(path)
+
+	case name == "s6-svc" && arg[0] == "-u":
+		return nil, s.start(path)
+
+	case name == "s6-svc" && (arg[0] == "-d" || arg[0] == "-k"):
+		s.stop(path)
+		return nil, nil
+
+	case name == "s6-svwait":
+		return nil, nil
+
+	case name == "s6-svstat" && arg[0] == "-u":
+		return []byte(strconv.FormatBool(s.Running(filepath.Base(path)) != nil) + "\n"), nil
+
+	case name == "s6-svstat" && arg[0] == "-o":
+		if s.Running(filepath.Base(path)) == nil {
+			return []byte("-1\n"), nil
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.pids++
+
+		return []byte(strconv.Itoa(s.pids) + "\n"), nil
+	}
+
+	return nil, fmt.Errorf("%s %v is not supported by the harness", name, arg)
+}
+
+// Running returns the stub of the running service with the name, such as the hostname of a tunnel,
+// or nil if the service is down
+func (s *Supervisor) Running(name string) *Cloudflared {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running[name]
+}
+
+// Starts returns how often the service with the name was started
+func (s *Supervisor) Starts(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.starts[name]
+}
+
+// scan supervises and starts the services of the directory that are not supervised yet
+func (s *Supervisor) scan(dir string) error {
+	infos, err := afero.ReadDir(s.Fs, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		path := filepath.Join(dir, info.Name())
+		supervise := filepath.Join(path, "supervise")
+
+		exists, _ := afero.DirExists(s.Fs, supervise)
+		if !info.IsDir() || exists {
+			continue
+		}
+
+		err := s.Fs.MkdirAll(supervise, os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		err = s.start(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// start starts a stub for the service unless it is running
+func (s *Supervisor) start(path string) error {
+	name := filepath.Base(path)
+	if s.Running(name) != nil {
+		return nil
+	}
+
+	contents, err := afero.ReadFile(s.Fs, filepath.Join(path, "config.yml"))
+	if err != nil {
+		run, err := afero.ReadFile(s.Fs, filepath.Join(path, "run"))
+		if err != nil {
+			return err
+		}
+
+		match := metricsFlag.FindSubmatch(run)
+		if match == nil {
+			return fmt.Errorf("No metrics address for service %s", name)
+		}
+		contents = []byte("metrics: " + string(match[1]))
+	}
+
+	cloudflared := NewCloudflared(contents)
+
+	err = cloudflared.Start()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running[name] = cloudflared
+	s.starts[name]++
+
+	return nil
+}
+
+// stop stops the stub of the service if it is running
+func (s *Supervisor) stop(path string) {
+	name := filepath.Base(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cloudflared, ok := s.running[name]; ok {
+		cloudflared.Stop()
+		delete(s.running, name)
+	}
+}
+
+// Close stops every running service
+func (s *Supervisor) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, cloudflared := range s.running {
+		cloudflared.Stop()
+		delete(s.running, name)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	hostsInterval = 5 * time.Second
+)
+
+// hostsFileContents returns a hosts file mapping the hostname of each running tunnel to the address
+// of its origin, so clients on the local network can reach the origin without the Cloudflare edge.
+// Origins on ports other than 80 and 443 are left out, since clients would connect to the default port.
+func hostsFileContents(tunnels []*Tunnel) string {
+	var lines []string
+
+	for _, tunnel := range tunnels {
+		if tunnel.State == TunnelDegraded || tunnel.Config.IP == "" {
+			continue
+		}
+
+		if tunnel.Config.Port != "80" && tunnel.Config.Port != "443" {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s %s", tunnel.Config.IP, tunnel.Config.Hostname))
+	}
+	sort.Strings(lines)
+
+	header := "# Generated by Hera from its running tunnels, changes will be overwritten\n"
+
+	return header + strings.Join(lines, "\n") + "\n"
+}
+
+// writeHostsFile replaces the hosts file at the path, writing to a temporary file first so readers
+// never see a partial file
+func writeHostsFile(fs afero.Fs, path string, contents string) error {
+	err := fs.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	err = afero.WriteFile(fs, tmp, []byte(contents), 0644)
+	if err != nil {
+		return err
+	}
+
+	return fs.Rename(tmp, path)
+}
+
+// WatchHosts periodically publishes the hostnames of the running tunnels to the hosts file at the
+// path, rewriting it only when the tunnels change
+func WatchHosts(fs afero.Fs, path string, interval time.Duration) {
+	written := ""
+
+	for {
+		contents := hostsFileContents(registry.List())
+
+		if contents != written {
+			err := writeHostsFile(fs, path, contents)
+			if err != nil {
+				reportError(fmt.Errorf("Unable to write hosts file %s: %s", path, err), "")
+			} else {
+				written = contents
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
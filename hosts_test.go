@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestHostsFileContents(t *testing.T) {
+	b := newRegistryTunnel("b.site.tld", "container-b")
+	b.Config.IP = "172.23.0.5"
+
+	a := newRegistryTunnel("a.site.tld", "container-a")
+
+	degraded := newRegistryTunnel("c.site.tld", "container-c")
+	degraded.State = TunnelDegraded
+
+	unresolved := newRegistryTunnel("d.site.tld", "")
+	unresolved.Config.IP = ""
+
+	otherPort := newRegistryTunnel("e.site.tld", "container-e")
+	otherPort.Config.IP = "172.23.0.6"
+	otherPort.Config.Port = "8080"
+
+	contents := hostsFileContents([]*Tunnel{b, a, degraded, unresolved, otherPort})
+
+	expected := "# Generated by Hera from its running tunnels, changes will be overwritten\n" +
+		"172.23.0.4 a.site.tld\n" +
+		"172.23.0.5 b.site.tld\n"
+
+	if contents != expected {
+		t.Errorf("Unexpected hosts file, got %q", contents)
+	}
+}
+
+func TestWriteHostsFile(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	err := writeHostsFile(fs, "/etc/hera/hosts", "172.23.0.4 a.site.tld\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _ := afero.ReadFile(fs, "/etc/hera/hosts")
+	if string(contents) != "172.23.0.4 a.site.tld\n" {
+		t.Errorf("Unexpected hosts file, got %q", contents)
+	}
+
+	if exists, _ := afero.Exists(fs, "/etc/hera/hosts.tmp"); exists {
+		t.Error("Expected temporary file to be renamed")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+var inspectCacheHits = NewCounterVec("hera_docker_inspect_cache_hits_total", "Number of container inspections answered from the cache.")
+
+// InspectCache holds the results of inspecting containers for a short time and shares a single request
+// between concurrent inspections of the same container, so bursts of events don't each hit the Docker API
+type InspectCache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*inspectEntry
+}
+
+// inspectEntry is the result of inspecting a container, which is ready once done is closed
+type inspectEntry struct {
+	done      chan struct{}
+	container types.ContainerJSON
+	err       error
+	fetched   time.Time
+}
+
+// NewInspectCache returns an InspectCache that holds results for the given duration
+func NewInspectCache(ttl time.Duration) *InspectCache {
+	cache := &InspectCache{
+		TTL:     ttl,
+		entries: make(map[string]*inspectEntry),
+	}
+
+	return cache
+}
+
+// Get returns the cached result for the container with the given ID, waits for an inspection of it
+// that is in flight, or inspects it with fetch. Failed inspections are not cached.
+func (c *InspectCache) Get(id string, fetch func(string) (types.ContainerJSON, error)) (types.ContainerJSON, error) {
+	c.mu.Lock()
+
+	if entry, ok := c.entries[id]; ok {
+		select {
+		case <-entry.done:
+			if time.Since(entry.fetched) < c.TTL {
+				c.mu.Unlock()
+				inspectCacheHits.Inc()
+				return entry.container, nil
+			}
+
+		default:
+			c.mu.Unlock()
+			<-entry.done
+			inspectCacheHits.Inc()
+			return entry.container, entry.err
+		}
+	}
+
+	c.prune()
+
+	entry := &inspectEntry{done: make(chan struct{})}
+	c.entries[id] = entry
+	c.mu.Unlock()
+
+	entry.container, entry.err = fetch(id)
+	entry.fetched = time.Now()
+	close(entry.done)
+
+	if entry.err != nil {
+		c.mu.Lock()
+		if c.entries[id] == entry {
+			delete(c.entries, id)
+		}
+		c.mu.Unlock()
+	}
+
+	return entry.container, entry.err
+}
+
+// Invalidate discards the cached result for the container with the given ID
+func (c *InspectCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, id)
+}
+
+// prune discards expired results. The caller must hold the lock.
+func (c *InspectCache) prune() {
+	for id, entry := range c.entries {
+		select {
+		case <-entry.done:
+			if time.Since(entry.fetched) >= c.TTL {
+				delete(c.entries, id)
+			}
+
+		default:
+		}
+	}
+}
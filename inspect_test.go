@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+type countingInspector struct {
+	mu      sync.Mutex
+	calls   int
+	release chan struct{}
+	err     error
+}
+
+func (c *countingInspector) inspect(id string) (types.ContainerJSON, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+
+	if c.release != nil {
+		<-c.release
+	}
+
+	container := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: id}}
+
+	return container, c.err
+}
+
+func TestInspectCache(t *testing.T) {
+	cache := NewInspectCache(time.Minute)
+	inspector := &countingInspector{}
+
+	for i := 0; i < 3; i++ {
+		container, err := cache.Get("5aa5a300dd0e", inspector.inspect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if container.ID != "5aa5a300dd0e" {
+			t.Errorf("Unexpected container, got %s", container.ID)
+		}
+	}
+
+	if inspector.calls != 1 {
+		t.Errorf("Expected a single inspection, got %d", inspector.calls)
+	}
+
+	cache.Invalidate("5aa5a300dd0e")
+	cache.Get("5aa5a300dd0e", inspector.inspect)
+
+	if inspector.calls != 2 {
+		t.Errorf("Expected an inspection after invalidating, got %d", inspector.calls)
+	}
+}
+
+func TestInspectCacheExpiry(t *testing.T) {
+	cache := NewInspectCache(0)
+	inspector := &countingInspector{}
+
+	cache.Get("5aa5a300dd0e", inspector.inspect)
+	cache.Get("5aa5a300dd0e", inspector.inspect)
+
+	if inspector.calls != 2 {
+		t.Errorf("Expected expired results to be inspected again, got %d", inspector.calls)
+	}
+
+	if len(cache.entries) != 1 {
+		t.Errorf("Expected expired results to be pruned, got %d", len(cache.entries))
+	}
+}
+
+func TestInspectCacheErrors(t *testing.T) {
+	cache := NewInspectCache(time.Minute)
+	inspector := &countingInspector{err: fmt.Errorf("No such container")}
+
+	_, err := cache.Get("5aa5a300dd0e", inspector.inspect)
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	inspector.err = nil
+
+	_, err = cache.Get("5aa5a300dd0e", inspector.inspect)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if inspector.calls != 2 {
+		t.Errorf("Expected failed inspections not to be cached, got %d", inspector.calls)
+	}
+}
+
+func TestInspectCacheConcurrent(t *testing.T) {
+	cache := NewInspectCache(time.Minute)
+	inspector := &countingInspector{release: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Get("5aa5a300dd0e", inspector.inspect)
+		}()
+	}
+
+	// Let the inspections queue up behind the first before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(inspector.release)
+	wg.Wait()
+
+	if inspector.calls != 1 {
+		t.Errorf("Expected concurrent inspections to be shared, got %d", inspector.calls)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	heraKeepAliveConnections = "hera.keep-alive-connections"
+	heraKeepAliveTimeout     = "hera.keep-alive-timeout"
+	heraTCPKeepAlive         = "hera.tcp-keep-alive"
+)
+
+// KeepAlive holds the settings of the connection pool cloudflared keeps to the origin.
+// Empty settings use the cloudflared defaults.
+type KeepAlive struct {
+	Connections string
+	Timeout     string
+	TCP         string
+}
+
+// parseKeepAlive returns the keepalive settings from the hera.keep-alive-connections,
+// hera.keep-alive-timeout, and hera.tcp-keep-alive labels of the container.
+// An error is returned if the number of connections or either duration is invalid.
+func parseKeepAlive(container types.ContainerJSON) (KeepAlive, error) {
+	keepAlive := KeepAlive{}
+
+	if value := getLabel(heraKeepAliveConnections, container); value != "" {
+		connections, err := strconv.Atoi(value)
+		if err != nil || connections < 1 {
+			return keepAlive, fmt.Errorf("Invalid number of connections for %s: %s", heraKeepAliveConnections, value)
+		}
+
+		keepAlive.Connections = strconv.Itoa(connections)
+	}
+
+	timeout, err := parseKeepAliveDuration(heraKeepAliveTimeout, getLabel(heraKeepAliveTimeout, container))
+	if err != nil {
+		return keepAlive, err
+	}
+	keepAlive.Timeout = timeout
+
+	tcp, err := parseKeepAliveDuration(heraTCPKeepAlive, getLabel(heraTCPKeepAlive, container))
+	if err != nil {
+		return keepAlive, err
+	}
+	keepAlive.TCP = tcp
+
+	return keepAlive, nil
+}
+
+// parseKeepAliveDuration returns the duration of a keepalive label value in the format cloudflared expects
+func parseKeepAliveDuration(label string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return "", fmt.Errorf("Invalid duration for %s: %s", label, value)
+	}
+
+	return duration.String(), nil
+}
+
+// configLines returns the lines of a cloudflared config file for the keepalive settings that are set
+func (k KeepAlive) configLines() []string {
+	return k.lines("proxy-keepalive-connections", "proxy-keepalive-timeout", "proxy-tcp-keepalive")
+}
+
+// ingressLines returns the originRequest settings of a cloudflared ingress rule for the keepalive
+// settings that are set
+func (k KeepAlive) ingressLines() []string {
+	return k.lines("keepAliveConnections", "keepAliveTimeout", "tcpKeepAlive")
+}
+
+// lines returns a key and value line for each setting that is set, using the given keys
+func (k KeepAlive) lines(connectionsKey, timeoutKey, tcpKey string) []string {
+	var lines []string
+
+	for _, setting := range []struct{ key, value string }{
+		{connectionsKey, k.Connections},
+		{timeoutKey, k.Timeout},
+		{tcpKey, k.TCP},
+	} {
+		if setting.value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", setting.key, setting.value))
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseKeepAlive(t *testing.T) {
+	container := newTenantContainer(map[string]string{
+		heraKeepAliveConnections: "200",
+		heraKeepAliveTimeout:     "90s",
+		heraTCPKeepAlive:         "1m",
+	})
+
+	keepAlive, err := parseKeepAlive(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := KeepAlive{Connections: "200", Timeout: "1m30s", TCP: "1m0s"}
+	if keepAlive != expected {
+		t.Errorf("Unexpected keepalive settings, got %+v", keepAlive)
+	}
+
+	invalid := []map[string]string{
+		{heraKeepAliveConnections: "0"},
+		{heraKeepAliveConnections: "many"},
+		{heraKeepAliveTimeout: "90"},
+		{heraTCPKeepAlive: "-1s"},
+	}
+
+	for _, labels := range invalid {
+		if _, err := parseKeepAlive(newTenantContainer(labels)); err == nil {
+			t.Errorf("Expected error for %v", labels)
+		}
+	}
+}
+
+func TestKeepAliveLines(t *testing.T) {
+	keepAlive := KeepAlive{Connections: "200", TCP: "30s"}
+
+	expected := []string{"proxy-keepalive-connections: 200", "proxy-tcp-keepalive: 30s"}
+	if lines := keepAlive.configLines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected config lines, got %v", lines)
+	}
+
+	expected = []string{"keepAliveConnections: 200", "tcpKeepAlive: 30s"}
+	if lines := keepAlive.ingressLines(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected ingress lines, got %v", lines)
+	}
+}
+
+func TestConfigFileWithKeepAlive(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tunnel := newTunnel()
+	tunnel.Config.KeepAlive = KeepAlive{Timeout: "1m30s"}
+
+	contents, err := tunnel.configFileContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(contents, "\nproxy-keepalive-timeout: 1m30s") {
+		t.Errorf("Expected keepalive timeout in config, got %s", contents)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+var (
+	labelWarnings = NewCounterVec("hera_label_warnings_total", "Number of containers with missing or unknown Hera labels.", "reason")
+
+	// knownLabels are the labels in the catalog, which unknown labels are checked against
+	knownLabels = labelNames(labelCatalog())
+)
+
+// LabelWarnings holds the problems with the Hera labels of a container
+type LabelWarnings struct {
+	// Missing are the required labels that are not set
+	Missing []string
+
+	// Unknown are the labels that look like Hera labels but are ignored, such as misspelled labels
+	Unknown []string
+}
+
+// checkLabels returns the missing and unknown Hera labels of a container. Containers without any Hera
+// labels are not meant to have a tunnel and have no warnings.
+func checkLabels(container types.ContainerJSON) *LabelWarnings {
+	warnings := &LabelWarnings{}
+
+	if container.Config == nil || !(hasHeraLabels(container.Config.Labels) || hasEnvLabels(container)) {
+		return warnings
+	}
+
+	if getLabel(heraHostname, container) == "" {
+		warnings.Missing = append(warnings.Missing, heraHostname)
+	}
+
+	if getLabel(heraPort, container) == "" && config.DefaultPort == "" {
+		warnings.Missing = append(warnings.Missing, heraPort)
+	}
+
+	for name := range container.Config.Labels {
+		if isHeraLabel(name) && !isKnownLabel(name) {
+			warnings.Unknown = append(warnings.Unknown, name)
+		}
+	}
+	sort.Strings(warnings.Unknown)
+
+	return warnings
+}
+
+// warnLabels logs a warning for the missing and unknown Hera labels of a container and counts them
+func warnLabels(container types.ContainerJSON) {
+	warnings := checkLabels(container)
+
+	if len(warnings.Missing) > 0 {
+		log.Warningf("Container %s has Hera labels but is missing %s, no tunnel will be created", shortID(container.ID), strings.Join(warnings.Missing, ", "))
+		labelWarnings.Inc("missing")
+	}
+
+	for _, name := range warnings.Unknown {
+		log.Warningf("Container %s has an unknown label %s that is ignored%s", shortID(container.ID), name, suggestionHint(name))
+		labelWarnings.Inc("unknown")
+	}
+}
+
+// hasHeraLabels returns whether any of the labels is meant for Hera
+func hasHeraLabels(labels map[string]string) bool {
+	for name := range labels {
+		if isHeraLabel(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHeraLabel returns whether the label is meant for Hera, either with the hera. prefix or because it
+// closely resembles a known label, such as hera_hostname
+func isHeraLabel(name string) bool {
+	if strings.HasPrefix(name, "hera.") {
+		return true
+	}
+
+	return strings.HasPrefix(strings.ToLower(name), "hera") && suggestLabel(name) != ""
+}
+
+// suggestLabel returns the known label closest to the name, or an empty string if none is close enough
+// to be a typo
+func suggestLabel(name string) string {
+	const maxDistance = 3
+
+	suggestion := ""
+	best := maxDistance + 1
+
+	for _, known := range knownLabels {
+		distance := levenshtein(strings.ToLower(name), known)
+		if distance < best {
+			suggestion = known
+			best = distance
+		}
+	}
+
+	return suggestion
+}
+
+// suggestionHint returns a hint naming the known label closest to the name, if there is one
+func suggestionHint(name string) string {
+	suggestion := suggestLabel(name)
+	if suggestion == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %s?", suggestion)
+}
+
+// levenshtein returns the number of single character insertions, deletions, and substitutions
+// needed to turn a into b
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// minInt returns the smallest of the values
+func minInt(values ...int) int {
+	smallest := values[0]
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+
+	return smallest
+}
+
+// isKnownLabel returns whether the label is one Hera reads
+func isKnownLabel(name string) bool {
+	if strings.HasPrefix(name, heraTagPrefix) && name != heraTagPrefix {
+		return true
+	}
+
+	for _, known := range knownLabels {
+		if name == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// envLabelName returns the name of the environment variable a Hera label can be read from when
+// HERA_ENV_LABELS is enabled, such as HERA_ORIGIN_CONTAINER for hera.origin-container
+func envLabelName(label string) string {
+	if !strings.HasPrefix(label, "hera.") {
+		return ""
+	}
+
+	return "HERA_" + strings.ToUpper(strings.Replace(strings.TrimPrefix(label, "hera."), "-", "_", -1))
+}
+
+// hasEnvLabels returns whether the container sets any Hera label through its environment variables
+// when HERA_ENV_LABELS is enabled
+func hasEnvLabels(container types.ContainerJSON) bool {
+	if !config.EnvLabels {
+		return false
+	}
+
+	for _, label := range knownLabels {
+		if getEnvLabel(label, container) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getEnvLabel returns the value of a Hera label from the environment variables of the container
+func getEnvLabel(label string, container types.ContainerJSON) string {
+	name := envLabelName(label)
+	if name == "" || container.Config == nil {
+		return ""
+	}
+
+	for _, env := range container.Config.Env {
+		if strings.HasPrefix(env, name+"=") {
+			return strings.TrimPrefix(env, name+"=")
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckLabels(t *testing.T) {
+	container := newTenantContainer(map[string]string{heraHostname: "site.tld", "hera.hostnme": "site.tld", "traefik.enable": "true"})
+
+	warnings := checkLabels(container)
+	if !reflect.DeepEqual(warnings.Missing, []string{heraPort}) {
+		t.Errorf("Unexpected missing labels, got %v", warnings.Missing)
+	}
+
+	if !reflect.DeepEqual(warnings.Unknown, []string{"hera.hostnme"}) {
+		t.Errorf("Unexpected unknown labels, got %v", warnings.Unknown)
+	}
+}
+
+func TestCheckLabelsDefaultPort(t *testing.T) {
+	config.DefaultPort = "8080"
+	defer func() { config.DefaultPort = "" }()
+
+	warnings := checkLabels(newTenantContainer(map[string]string{heraHostname: "site.tld"}))
+	if len(warnings.Missing) != 0 || len(warnings.Unknown) != 0 {
+		t.Errorf("Expected no warnings with a default port, got %v", warnings)
+	}
+}
+
+func TestCheckLabelsWithoutHeraLabels(t *testing.T) {
+	warnings := checkLabels(newTenantContainer(map[string]string{"traefik.enable": "true"}))
+	if len(warnings.Missing) != 0 || len(warnings.Unknown) != 0 {
+		t.Errorf("Expected no warnings for other containers, got %v", warnings)
+	}
+}
+
+func TestWarnLabelsCountsWarnings(t *testing.T) {
+	before := labelWarnings.Value("missing")
+
+	warnLabels(newTenantContainer(map[string]string{heraPort: "80"}))
+
+	if labelWarnings.Value("missing") != before+1 {
+		t.Error("Expected missing labels to be counted")
+	}
+}
+
+func TestSuggestLabel(t *testing.T) {
+	tests := map[string]string{
+		"hera.hostnme":    heraHostname,
+		"hera_hostname":   heraHostname,
+		"HERA.PORT":       heraPort,
+		"hera.prot":       heraPort,
+		"heracles.enable": "",
+		"hera.something":  "",
+	}
+
+	for name, expected := range tests {
+		if suggestion := suggestLabel(name); suggestion != expected {
+			t.Errorf("Unexpected suggestion for %s, got %q want %q", name, suggestion, expected)
+		}
+	}
+}
+
+func TestCheckLabelsDetectsTypos(t *testing.T) {
+	container := newTenantContainer(map[string]string{"hera_hostname": "site.tld", heraPort: "80", "heracles.enable": "true"})
+
+	warnings := checkLabels(container)
+	if !reflect.DeepEqual(warnings.Missing, []string{heraHostname}) {
+		t.Errorf("Unexpected missing labels, got %v", warnings.Missing)
+	}
+
+	if !reflect.DeepEqual(warnings.Unknown, []string{"hera_hostname"}) {
+		t.Errorf("Unexpected unknown labels, got %v", warnings.Unknown)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	if distance := levenshtein("hera.hostnme", "hera.hostname"); distance != 1 {
+		t.Errorf("Unexpected distance, got %d", distance)
+	}
+
+	if distance := levenshtein("", "abc"); distance != 3 {
+		t.Errorf("Unexpected distance, got %d", distance)
+	}
+}
+
+func TestGetLabelFromEnv(t *testing.T) {
+	container := newTenantContainer(map[string]string{heraPort: "80"})
+	container.Config.Env = []string{"PATH=/usr/bin", "HERA_HOSTNAME=site.tld", "HERA_PORT=8080", "HERA_ORIGIN_CONTAINER=app"}
+
+	if value := getLabel(heraHostname, container); value != "" {
+		t.Errorf("Expected environment variables to be ignored by default, got %s", value)
+	}
+
+	config.EnvLabels = true
+	defer func() { config.EnvLabels = false }()
+
+	if value := getLabel(heraHostname, container); value != "site.tld" {
+		t.Errorf("Unexpected hostname, got %s", value)
+	}
+
+	if value := getLabel(heraPort, container); value != "80" {
+		t.Errorf("Expected label to take precedence, got %s", value)
+	}
+
+	if value := getLabel(heraOrigin, container); value != "app" {
+		t.Errorf("Unexpected origin container, got %s", value)
+	}
+
+	if source := labelSource(heraHostname, container); source != "env HERA_HOSTNAME" {
+		t.Errorf("Unexpected source, got %s", source)
+	}
+
+	if value := getLabel(composeProject, container); value != "" {
+		t.Errorf("Expected only Hera labels to fall back, got %s", value)
+	}
+}
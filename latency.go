@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	edgeRegisterTimeout  = time.Minute
+	edgeRegisterInterval = time.Second
+)
+
+var (
+	tunnelStartDuration = NewHistogramVec("hera_tunnel_start_duration_seconds", "Duration of each phase of starting a tunnel, from the start event to the tunnel registering with the Cloudflare edge.", "hostname", "phase")
+)
+
+// StartLatency records how long each phase of starting a tunnel took: inspecting the container,
+// resolving its origin, finding its certificate, spawning cloudflared, and registering with the edge
+type StartLatency struct {
+	mu       sync.Mutex
+	last     time.Time
+	phases   map[string]time.Duration
+	observed bool
+}
+
+// NewStartLatency returns a StartLatency that measures the first phase from now
+func NewStartLatency() *StartLatency {
+	latency := &StartLatency{
+		last:   time.Now(),
+		phases: make(map[string]time.Duration),
+	}
+
+	return latency
+}
+
+// Mark records the time since the previous mark as the duration of the phase
+func (s *StartLatency) Mark(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.phases[phase] = now.Sub(s.last)
+	s.last = now
+}
+
+// Set records the duration of a phase that was measured separately
+func (s *StartLatency) Set(phase string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phases[phase] = duration
+}
+
+// Phases returns the duration of each recorded phase in seconds
+func (s *StartLatency) Phases() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	phases := make(map[string]float64)
+	for phase, duration := range s.phases {
+		phases[phase] = duration.Seconds()
+	}
+
+	return phases
+}
+
+// Observe records the phases in the tunnel start duration histogram. Phases are only observed once.
+func (s *StartLatency) Observe(hostname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.observed {
+		return
+	}
+	s.observed = true
+
+	for phase, duration := range s.phases {
+		tunnelStartDuration.Observe(duration.Seconds(), hostname, phase)
+	}
+}
+
+// isObserved returns whether the phases have been recorded in the histogram
+func (s *StartLatency) isObserved() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.observed
+}
+
+// waitForEdge polls the metrics endpoint of the tunnel until cloudflared reports a connection to the
+// Cloudflare edge, then records the start latency of the tunnel
+func (t *Tunnel) waitForEdge(latency *StartLatency, address string) {
+	deadline := time.Now().Add(edgeRegisterTimeout)
+
+	for time.Now().Before(deadline) {
+		stats, err := ScrapeStats(address)
+		if err == nil && stats.ActiveConnections > 0 {
+			latency.Mark("edge_register")
+			latency.Observe(t.Config.Hostname)
+
+			if config.DNSCheck != "" {
+				t.verifyDNS(net.DefaultResolver, config.DNSCheck)
+			}
+
+			if config.SmokeTest {
+				t.runSmokeTest("https://"+t.Config.Hostname, smokeAttempts, smokeInterval)
+			}
+
+			return
+		}
+
+		time.Sleep(edgeRegisterInterval)
+	}
+
+	log.Warningf("Tunnel %s did not register with the Cloudflare edge within %s", t.Config.Hostname, edgeRegisterTimeout)
+	latency.Observe(t.Config.Hostname)
+}
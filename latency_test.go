@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartLatency(t *testing.T) {
+	latency := NewStartLatency()
+	latency.Set("inspect", 2*time.Second)
+	latency.Mark("resolve")
+
+	phases := latency.Phases()
+	if len(phases) != 2 || phases["inspect"] != 2 {
+		t.Errorf("Unexpected phases, got %v", phases)
+	}
+
+	latency.Observe("latency.tld")
+	latency.Observe("latency.tld")
+
+	if tunnelStartDuration.Count("latency.tld", "inspect") != 1 {
+		t.Errorf("Expected phases to be observed once, got %d", tunnelStartDuration.Count("latency.tld", "inspect"))
+	}
+
+	if !latency.isObserved() {
+		t.Error("Expected latency to be observed")
+	}
+}
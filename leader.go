@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var (
+	elector *Elector
+)
+
+// Lease is the contents of the leader lock file
+type Lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Elector elects a leader between Hera instances sharing a lock file on a volume. The leader renews
+// its lease before it expires, and a standby takes over once the lease of a leader that died expires.
+type Elector struct {
+	Path string
+	ID   string
+	TTL  time.Duration
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// NewElector returns a new Elector for the lock file at the given path
+func NewElector(path string, id string, ttl time.Duration) *Elector {
+	elector := &Elector{
+		Path: path,
+		ID:   id,
+		TTL:  ttl,
+	}
+
+	return elector
+}
+
+// IsLeader returns whether this instance holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader
+}
+
+// setLeader records whether this instance holds the lease
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leader = leader
+}
+
+// Acquire takes or renews the lease if it is free, expired, or already held by this instance,
+// and returns whether this instance holds it
+func (e *Elector) Acquire(now time.Time) (bool, error) {
+	lease, err := e.read()
+	if err != nil {
+		return false, err
+	}
+
+	if lease != nil && lease.Holder != e.ID && now.Before(lease.ExpiresAt) {
+		return false, nil
+	}
+
+	err = e.write(&Lease{Holder: e.ID, ExpiresAt: now.Add(e.TTL)})
+	if err != nil {
+		return false, err
+	}
+
+	// Another instance may have taken the lease at the same time, and the last write wins
+	lease, err = e.read()
+	if err != nil {
+		return false, err
+	}
+
+	return lease != nil && lease.Holder == e.ID, nil
+}
+
+// read returns the current lease, or nil if there is none
+func (e *Elector) read() (*Lease, error) {
+	contents, err := afero.ReadFile(fs, e.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read leader lock %s: %s", e.Path, err)
+	}
+
+	// A lock that cannot be parsed, such as one that was partially written, is free
+	lease := &Lease{}
+	if err := json.Unmarshal(contents, lease); err != nil {
+		return nil, nil
+	}
+
+	return lease, nil
+}
+
+// write replaces the lease through a temporary file so other instances never read a partial lease
+func (e *Elector) write(lease *Lease) error {
+	contents, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	temp := fmt.Sprintf("%s.%s", e.Path, e.ID)
+
+	err = afero.WriteFile(fs, temp, contents, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to write leader lock %s: %s", e.Path, err)
+	}
+
+	return fs.Rename(temp, e.Path)
+}
+
+// WatchLeadership renews the lease every third of its TTL, starting the tunnels when this instance
+// becomes the leader and stopping them when it loses the lease. Transitions run on the event loop, since
+// they change the registered tunnels.
+func WatchLeadership(e *Elector) {
+	for {
+		time.Sleep(e.TTL / 3)
+
+		leader, err := e.Acquire(time.Now())
+		if err != nil {
+			reportError(err, "")
+			leader = false
+		}
+
+		eventLoop.Do(func() {
+			e.transition(leader)
+		})
+	}
+}
+
+// transition starts or stops the registered tunnels when the leadership of this instance changes. It
+// must be called from the event loop.
+func (e *Elector) transition(leader bool) {
+	if leader == e.IsLeader() {
+		return
+	}
+
+	if leader {
+		log.Infof("Became the leader, starting tunnels")
+		e.setLeader(true)
+
+		if pool != nil {
+			go pool.refill()
+		}
+
+		for _, tunnel := range registry.List() {
+			if tunnel.State != TunnelObserved {
+				continue
+			}
+
+			err := tunnel.Start()
+			if err != nil {
+				reportError(err, tunnel.ContainerID)
+			}
+		}
+
+		return
+	}
+
+	// Tunnels are stopped while still leading, since stopping is skipped for observing instances
+	log.Infof("Lost the leader lock, stopping tunnels")
+
+	for _, tunnel := range registry.List() {
+		_, err := tunnel.Stop()
+		if err != nil {
+			reportError(err, tunnel.ContainerID)
+		}
+	}
+
+	e.setLeader(false)
+
+	for _, tunnel := range registry.List() {
+		tunnel.observe()
+	}
+}
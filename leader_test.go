@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestElectorAcquire(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	now := time.Now()
+
+	primary := NewElector("/var/lib/hera/leader", "primary", 15*time.Second)
+	standby := NewElector("/var/lib/hera/leader", "standby", 15*time.Second)
+
+	if leader, err := primary.Acquire(now); err != nil || !leader {
+		t.Fatalf("Expected primary to acquire the free lock, got %t %v", leader, err)
+	}
+
+	if leader, _ := standby.Acquire(now.Add(5 * time.Second)); leader {
+		t.Error("Expected standby to not acquire a held lock")
+	}
+
+	if leader, _ := primary.Acquire(now.Add(10 * time.Second)); !leader {
+		t.Error("Expected primary to renew its lock")
+	}
+
+	if leader, _ := standby.Acquire(now.Add(20 * time.Second)); leader {
+		t.Error("Expected standby to not acquire a renewed lock")
+	}
+
+	if leader, _ := standby.Acquire(now.Add(30 * time.Second)); !leader {
+		t.Error("Expected standby to acquire the expired lock")
+	}
+}
+
+func TestElectorTransition(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	registry = NewRegistry()
+	defer func(previous *Elector) { elector = previous }(elector)
+
+	elector = NewElector("/var/lib/hera/leader", "standby", 15*time.Second)
+
+	calls := 0
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			calls++
+			return []byte(""), nil
+		},
+	}
+
+	err := tunnel.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tunnel.State != TunnelObserved || calls != 0 {
+		t.Fatalf("Expected standby to observe the tunnel, got %s with %d commands", tunnel.State, calls)
+	}
+
+	elector.transition(true)
+
+	if tunnel.State != TunnelActive || calls == 0 {
+		t.Errorf("Expected leader to start the tunnel, got %s with %d commands", tunnel.State, calls)
+	}
+
+	started := calls
+	elector.transition(false)
+
+	if tunnel.State != TunnelObserved || calls == started {
+		t.Errorf("Expected former leader to stop the tunnel, got %s with %d commands", tunnel.State, calls-started)
+	}
+}
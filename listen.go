@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// splitAddress returns the network and address of a listener address. Addresses prefixed with unix:
+// or starting with / are unix sockets, and all other addresses are TCP addresses.
+func splitAddress(address string) (string, string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", strings.TrimPrefix(address, "unix:")
+	}
+
+	if strings.HasPrefix(address, "/") {
+		return "unix", address
+	}
+
+	return "tcp", strings.TrimPrefix(address, "tcp:")
+}
+
+// listenAddress listens on a TCP address or unix socket. A socket left behind by a previous run is removed.
+func listenAddress(address string) (net.Listener, error) {
+	network, address := splitAddress(address)
+
+	if network == "unix" {
+		err := os.Remove(address)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return net.Listen(network, address)
+}
+
+// dialAddress connects to a TCP address or unix socket
+func dialAddress(address string) (net.Conn, error) {
+	network, address := splitAddress(address)
+
+	return net.Dial(network, address)
+}
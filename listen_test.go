@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitAddress(t *testing.T) {
+	addresses := map[string][2]string{
+		":8080":                  {"tcp", ":8080"},
+		"tcp:127.0.0.1:8080":     {"tcp", "127.0.0.1:8080"},
+		"/var/run/hera.sock":     {"unix", "/var/run/hera.sock"},
+		"unix:/var/run/api.sock": {"unix", "/var/run/api.sock"},
+	}
+
+	for address, expected := range addresses {
+		network, addr := splitAddress(address)
+		if network != expected[0] || addr != expected[1] {
+			t.Errorf("Unexpected address for %s, got %s %s", address, network, addr)
+		}
+	}
+}
+
+func TestListenAddressUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hera")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "metrics.sock")
+
+	// A socket left behind by a previous run is replaced
+	ioutil.WriteFile(path, nil, 0644)
+
+	listener, err := listenAddress("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	conn, err := dialAddress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -1,15 +1,31 @@
 package main
 
 import (
-    "io"
+	"io"
+	"time"
 
-    "github.com/spf13/afero"
+	"github.com/docker/docker/api/types/events"
+	"github.com/spf13/afero"
+)
+
+const (
+	OverflowBlock  = "block"
+	OverflowDrop   = "drop"
+	reconnectDelay = 2 * time.Second
+)
+
+var (
+	eventsReceived = NewCounterVec("hera_events_received_total", "Number of Docker events received.")
+	eventsDropped  = NewCounterVec("hera_events_dropped_total", "Number of Docker events dropped because the event queue was full.")
 )
 
 // Listener holds config for an event listener and is used to listen for container events
 type Listener struct {
 	Client *Client
 	Fs     afero.Fs
+
+	// reconcile is signalled when events may have been missed and the tunnels need to be reconciled
+	reconcile chan struct{}
 }
 
 // NewListener returns a new Listener
@@ -21,8 +37,9 @@ func NewListener() (*Listener, error) {
 	}
 
 	listener := &Listener{
-		Client: client,
-		Fs:     afero.NewOsFs(),
+		Client:    client,
+		Fs:        afero.NewOsFs(),
+		reconcile: make(chan struct{}, 1),
 	}
 
 	return listener, nil
@@ -43,25 +60,113 @@ func (l *Listener) Revive() error {
 		}
 	}
 
+	handler.retryPendingDependencies()
+
 	return nil
 }
 
-// Listen listens for container events to be handled
+// Listen listens for container events to be handled. Events are read into a queue of
+// config.EventBuffer events so bursts don't stall the event stream, and tunnels are reconciled
+// with the running containers once the queue is empty if any events were missed. Work handed over
+// by background goroutines through the eventLoop is run between events, and containers waiting for
+// dependencies are retried once a tunnel has started.
 func (l *Listener) Listen() {
 	log.Info("Hera is listening")
 
 	handler := NewHandler(l.Client)
-	messages, errs := l.Client.Events()
+	queue := make(chan events.Message, config.EventBuffer)
+
+	go l.receive(queue)
 
 	for {
+		// Work through the queued events before reconciling
+		select {
+		case event := <-queue:
+			handler.HandleEvent(event)
+			continue
+		default:
+		}
+
 		select {
-		case event := <-messages:
+		case event := <-queue:
 			handler.HandleEvent(event)
 
-		case err := <-errs:
-			if err != nil && err != io.EOF {
-				log.Error(err.Error())
+		case task := <-eventLoop.Tasks():
+			task()
+
+		case <-dependencyRetries:
+			handler.retryPendingDependencies()
+
+		case <-l.reconcile:
+			log.Info("Reconciling tunnels after missed events")
+
+			err := handler.Reconcile()
+			if err != nil {
+				reportError(err, "")
 			}
 		}
 	}
 }
+
+// requestReconcile asks the event loop to reconcile the tunnels once the queue is empty. Requests made
+// before the reconciliation runs are merged into one.
+func (l *Listener) requestReconcile() {
+	select {
+	case l.reconcile <- struct{}{}:
+	default:
+	}
+}
+
+// receive subscribes to the event stream and forwards its events to the queue,
+// resubscribing whenever the stream fails
+func (l *Listener) receive(queue chan<- events.Message) {
+	for {
+		// Probe the daemon instead of resubscribing while requests are paused
+		if dockerBreaker.IsOpen() {
+			if !dockerBreaker.Allow(time.Now()) || l.Client.Ping() != nil {
+				time.Sleep(reconnectDelay)
+				continue
+			}
+		}
+
+		messages, errs := l.Client.Events()
+		readiness.Set(CheckEvents, true)
+
+	stream:
+		for {
+			select {
+			case event := <-messages:
+				l.enqueue(queue, event)
+
+			case err := <-errs:
+				if err != nil && err != io.EOF && !dockerBreaker.IsOpen() {
+					reportError(NewError(ErrDockerUnavailable, err), "")
+				}
+				break stream
+			}
+		}
+
+		// Events may have been emitted while the stream was down
+		readiness.Set(CheckEvents, false)
+		l.requestReconcile()
+		time.Sleep(reconnectDelay)
+	}
+}
+
+// enqueue adds an event to the queue. With the drop overflow policy an event that does not fit
+// is dropped and a reconciliation is requested, otherwise enqueue blocks until there is room.
+func (l *Listener) enqueue(queue chan<- events.Message, event events.Message) {
+	eventsReceived.Inc()
+
+	if config.EventOverflow != OverflowDrop {
+		queue <- event
+		return
+	}
+
+	select {
+	case queue <- event:
+	default:
+		eventsDropped.Inc()
+		l.requestReconcile()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestEnqueueDropsWhenFull(t *testing.T) {
+	config.EventOverflow = OverflowDrop
+	defer func() { config.EventOverflow = OverflowBlock }()
+
+	listener := &Listener{reconcile: make(chan struct{}, 1)}
+	queue := make(chan events.Message, 2)
+	dropped := eventsDropped.Value()
+
+	for i := 0; i < 5; i++ {
+		listener.enqueue(queue, events.Message{Status: "start"})
+	}
+
+	if len(queue) != 2 {
+		t.Errorf("Unexpected queue length, got %d", len(queue))
+	}
+
+	if eventsDropped.Value()-dropped != 3 {
+		t.Errorf("Unexpected dropped count, got %v", eventsDropped.Value()-dropped)
+	}
+
+	if len(listener.reconcile) != 1 {
+		t.Error("Expected a reconciliation to be requested")
+	}
+}
+
+func TestEnqueueBlocksWhenFull(t *testing.T) {
+	listener := &Listener{reconcile: make(chan struct{}, 1)}
+	queue := make(chan events.Message, 1)
+	listener.enqueue(queue, events.Message{Status: "start"})
+
+	done := make(chan bool)
+	go func() {
+		listener.enqueue(queue, events.Message{Status: "die"})
+		done <- true
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Expected enqueue to block while the queue is full")
+	default:
+	}
+
+	<-queue
+	<-done
+
+	if len(listener.reconcile) != 0 {
+		t.Error("Expected no reconciliation when blocking")
+	}
+}
+
+func TestRequestReconcileMerges(t *testing.T) {
+	listener := &Listener{reconcile: make(chan struct{}, 1)}
+
+	listener.requestReconcile()
+	listener.requestReconcile()
+
+	if len(listener.reconcile) != 1 {
+		t.Errorf("Expected requests to be merged, got %d", len(listener.reconcile))
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	logging "github.com/op/go-logging"
 )
@@ -11,13 +14,19 @@ const (
 	LogDir = "/var/log/hera"
 )
 
+// Formats of the console log set by HERA_LOG_FORMAT
+const (
+	LogFormatAuto    = "auto"
+	LogFormatConsole = "console"
+	LogFormatPlain   = "plain"
+	LogFormatJSON    = "json"
+)
+
 func InitLogger(name string) {
 	log := logging.MustGetLogger(name)
 	logPath := filepath.Join(LogDir, name)
 
-	stderrBackend := logging.NewLogBackend(os.Stderr, "", 0)
-	strderrBackendFormat := logging.MustStringFormatter(`[%{level}] %{message}`)
-	strderrBackendFormatter := logging.NewBackendFormatter(stderrBackend, strderrBackendFormat)
+	stderrBackend := newConsoleBackend(os.Stderr, consoleFormat(config.LogFormat, os.Stderr))
 
 	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
@@ -28,5 +37,70 @@ func InitLogger(name string) {
 	logFileBackendFormat := logging.MustStringFormatter(`%{time:15:04:00.000} [%{level}] %{message}`)
 	logFileBackendFormatter := logging.NewBackendFormatter(logFileBackend, logFileBackendFormat)
 
-	logging.SetBackend(strderrBackendFormatter, logFileBackendFormatter)
+	logging.SetBackend(stderrBackend, logFileBackendFormatter)
+}
+
+// consoleFormat returns the format of the console log. The auto format is the colored console format
+// when the file is a terminal, and the plain format otherwise, such as when the logs are collected by Docker.
+func consoleFormat(format string, file *os.File) string {
+	if format != LogFormatAuto {
+		return format
+	}
+
+	if isTerminal(file) {
+		return LogFormatConsole
+	}
+
+	return LogFormatPlain
+}
+
+// isTerminal returns whether the file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// newConsoleBackend returns the log backend writing to w in the given format
+func newConsoleBackend(w io.Writer, format string) logging.Backend {
+	switch format {
+	case LogFormatJSON:
+		return &JSONBackend{Writer: w}
+	case LogFormatConsole:
+		return logging.NewBackendFormatter(logging.NewLogBackend(w, "", 0),
+			logging.MustStringFormatter(`%{color}%{time:15:04:05} %{level:.4s}%{color:reset} %{message}`))
+	}
+
+	return logging.NewBackendFormatter(logging.NewLogBackend(w, "", 0), logging.MustStringFormatter(`[%{level}] %{message}`))
+}
+
+// JSONBackend writes each log record as a line of JSON, for log collectors that parse structured logs
+type JSONBackend struct {
+	Writer io.Writer
+}
+
+// jsonRecord is the JSON representation of a log record
+type jsonRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// Log writes the record as a line of JSON
+func (b *JSONBackend) Log(level logging.Level, calldepth int, record *logging.Record) error {
+	line, err := json.Marshal(&jsonRecord{
+		Time:    record.Time.UTC(),
+		Level:   level.String(),
+		Message: record.Message(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.Writer.Write(append(line, '\n'))
+
+	return err
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	logging "github.com/op/go-logging"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if format := consoleFormat(LogFormatJSON, w); format != LogFormatJSON {
+		t.Errorf("Expected the configured format, got %s", format)
+	}
+
+	if format := consoleFormat(LogFormatAuto, w); format != LogFormatPlain {
+		t.Errorf("Expected the plain format when not attached to a terminal, got %s", format)
+	}
+}
+
+func TestJSONBackend(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := logging.MustGetLogger("json-test")
+	logger.SetBackend(logging.AddModuleLevel(newConsoleBackend(&buf, LogFormatJSON)))
+	logger.Warningf("Tunnel %s is degraded", "site.example.com")
+
+	var record map[string]string
+	err := json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record["level"] != "WARNING" || record["message"] != "Tunnel site.example.com is degraded" || record["time"] == "" {
+		t.Errorf("Unexpected record, got %v", record)
+	}
+
+	if !strings.HasSuffix(buf.String(), "}\n") {
+		t.Error("Expected one record per line")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// loginCertificatePath returns where cloudflared tunnel login saves the certificate
+func loginCertificatePath() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = "/root"
+	}
+
+	return filepath.Join(home, ".cloudflared", "cert.pem")
+}
+
+// login runs cloudflared tunnel login and moves the resulting certificate into the certificate directory
+// under the name Hera expects for the domain. The certificate is encrypted if a passphrase is configured.
+func login(domain string, commander Commander, fs afero.Fs) error {
+	if _, err := getRootDomain(domain); err != nil {
+		return fmt.Errorf("Invalid domain %s: %s", domain, err)
+	}
+
+	target := filepath.Join(CertificatePath, domain+".pem")
+	source := loginCertificatePath()
+
+	for _, path := range []string{target, source} {
+		if exists, _ := afero.Exists(fs, path); exists {
+			return fmt.Errorf("A certificate already exists at %s, move it before logging in", path)
+		}
+	}
+
+	_, err := commander.Run("cloudflared", "tunnel", "login")
+	if err != nil {
+		return fmt.Errorf("cloudflared login failed: %s", err)
+	}
+
+	contents, err := afero.ReadFile(fs, source)
+	if err != nil {
+		return fmt.Errorf("Unable to find the certificate from cloudflared: %s", err)
+	}
+
+	err = verifyLoginCertificate(contents)
+	if err != nil {
+		return err
+	}
+
+	if config.Passphrase != "" {
+		contents, err = Encrypt(contents, config.Passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = afero.WriteFile(fs, target, contents, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = fs.Remove(source)
+	if err != nil {
+		return err
+	}
+
+	_, err = FindCertificateForHost(domain, fs)
+
+	return err
+}
+
+// verifyLoginCertificate returns an error if the certificate is missing a part cloudflared needs to run tunnels
+func verifyLoginCertificate(contents []byte) error {
+	for _, block := range []string{"PRIVATE KEY", "CERTIFICATE", "ARGO TUNNEL TOKEN"} {
+		if !strings.Contains(string(contents), "-----BEGIN "+block+"-----") {
+			return fmt.Errorf("The certificate from cloudflared is missing its %s", strings.ToLower(block))
+		}
+	}
+
+	return nil
+}
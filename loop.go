@@ -0,0 +1,120 @@
+package main
+
+import "sync"
+
+var (
+	// eventLoop runs the work of background goroutines on the goroutine handling Docker events
+	eventLoop = NewEventLoop()
+
+	// startWaits tracks the tunnels waiting for their container to become ready
+	startWaits = NewStartWaits()
+)
+
+// EventLoop hands work from other goroutines to the goroutine handling Docker events, since tunnels and
+// the registry are changed there without further locking
+type EventLoop struct {
+	tasks chan func()
+}
+
+// NewEventLoop returns a new EventLoop
+func NewEventLoop() *EventLoop {
+	loop := &EventLoop{
+		tasks: make(chan func()),
+	}
+
+	return loop
+}
+
+// Do runs f on the event loop and waits for it to return. It must not be called from the event loop.
+func (e *EventLoop) Do(f func()) {
+	done := make(chan struct{})
+
+	e.tasks <- func() {
+		defer close(done)
+		f()
+	}
+
+	<-done
+}
+
+// Tasks returns the work waiting to be run by the event loop
+func (e *EventLoop) Tasks() <-chan func() {
+	return e.tasks
+}
+
+// StartWaits tracks the tunnels whose container is waited on in the background before they are started,
+// so waits are dropped once their container dies, is removed, or is started again. It is safe for
+// concurrent use.
+type StartWaits struct {
+	mu          sync.Mutex
+	generations map[string]int
+	waiting     map[string]int
+}
+
+// NewStartWaits returns a new, empty StartWaits
+func NewStartWaits() *StartWaits {
+	waits := &StartWaits{
+		generations: make(map[string]int),
+		waiting:     make(map[string]int),
+	}
+
+	return waits
+}
+
+// Begin records a wait for the container and returns the generation to pass to Finish
+func (w *StartWaits) Begin(id string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.waiting[id]++
+
+	return w.generations[id]
+}
+
+// Finish ends a wait and returns whether the tunnel should still be started, which it should not be if
+// the waits of the container were cancelled since it began
+func (w *StartWaits) Finish(id string, generation int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := w.generations[id] == generation
+
+	w.waiting[id]--
+	if w.waiting[id] <= 0 {
+		delete(w.waiting, id)
+		delete(w.generations, id)
+	}
+
+	return current
+}
+
+// Cancel drops the waits of the container that are in progress
+func (w *StartWaits) Cancel(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.waiting[id] > 0 {
+		w.generations[id]++
+	}
+}
+
+// Has returns whether a tunnel of the container is being waited on
+func (w *StartWaits) Has(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.waiting[id] > 0
+}
+
+// Count returns the number of tunnels being waited on
+func (w *StartWaits) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	count := 0
+	for _, n := range w.waiting {
+		count += n
+	}
+
+	return count
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// runTask runs the next piece of work handed to the event loop
+func runTask(t *testing.T) {
+	select {
+	case task := <-eventLoop.Tasks():
+		task()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for work on the event loop")
+	}
+}
+
+// serveEventLoop runs the work handed to the event loop in the background until the returned function
+// is called, for tests of code that is not run on the event loop
+func serveEventLoop() func() {
+	stop := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case task := <-eventLoop.Tasks():
+				task()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+func TestEventLoopDo(t *testing.T) {
+	done := make(chan bool)
+	ran := false
+
+	go func() {
+		eventLoop.Do(func() { ran = true })
+		done <- true
+	}()
+
+	runTask(t)
+	<-done
+
+	if !ran {
+		t.Error("Expected the work to run on the event loop")
+	}
+}
+
+func TestStartWaits(t *testing.T) {
+	waits := NewStartWaits()
+
+	first := waits.Begin("5aa5a300dd0e")
+	waits.Cancel("5aa5a300dd0e")
+	second := waits.Begin("5aa5a300dd0e")
+
+	if waits.Count() != 2 {
+		t.Errorf("Unexpected wait count, got %d", waits.Count())
+	}
+
+	if !waits.Finish("5aa5a300dd0e", second) {
+		t.Error("Expected the current wait to start its tunnel")
+	}
+
+	if waits.Finish("5aa5a300dd0e", first) {
+		t.Error("Expected the cancelled wait to be dropped")
+	}
+
+	if waits.Count() != 0 {
+		t.Errorf("Expected no waits, got %d", waits.Count())
+	}
+}
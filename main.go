@@ -1,30 +1,220 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/op/go-logging"
 )
 
 var log = logging.MustGetLogger("hera")
 
 func main() {
+	config = LoadConfig()
+
+	passphrase, err := loadPassphrase(config.Passphrase, config.PassphraseFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	config.Passphrase = passphrase
+
+	if len(os.Args) > 1 {
+		os.Exit(RunCommand(os.Args[1:]))
+	}
+
 	InitLogger("hera")
 
+	if config.Mode != ModeManage && config.Mode != ModeObserve {
+		log.Errorf("Unable to start: HERA_MODE must be %s or %s, got %s", ModeManage, ModeObserve, config.Mode)
+		os.Exit(1)
+	}
+
+	if config.EventOverflow != OverflowBlock && config.EventOverflow != OverflowDrop {
+		log.Errorf("Unable to start: HERA_EVENT_OVERFLOW must be %s or %s, got %s", OverflowBlock, OverflowDrop, config.EventOverflow)
+		os.Exit(1)
+	}
+
+	if len(config.Tenants) > 0 && len(config.TenantNetworks) == 0 {
+		log.Errorf("Unable to start: HERA_TENANTS requires HERA_TENANT_NETWORKS to assign containers to tenants")
+		os.Exit(1)
+	}
+
+	if config.LeaderLock != "" {
+		id, _ := os.Hostname()
+		elector = NewElector(config.LeaderLock, id, config.LeaderTTL)
+
+		leader, err := elector.Acquire(time.Now())
+		if err != nil {
+			log.Errorf("Unable to start: %s", err)
+			os.Exit(1)
+		}
+		elector.setLeader(leader)
+
+		if !leader {
+			log.Info("Another instance holds the leader lock, waiting as standby")
+		}
+	}
+
+	if config.IsObserving() {
+		log.Info("Observing containers without starting cloudflared")
+	}
+
+	source, err := newCertificateSource(config)
+	if err != nil {
+		log.Errorf("Unable to start: %s", err)
+		os.Exit(1)
+	}
+	certificateSource = source
+	cloudflare = newCloudflareClient(config)
+
+	if config.DomainDefaults != "" {
+		domainDefaults, err = LoadDomainDefaults(config.DomainDefaults)
+		if err != nil {
+			log.Errorf("Unable to start: %s", err)
+			os.Exit(1)
+		}
+
+		log.Infof("Loaded defaults for %s", strings.Join(domainDefaults.Domains(), ", "))
+	}
+
+	if config.Mode != ModeObserve {
+		pool, err = newPool(config, cloudflare)
+		if err != nil {
+			log.Errorf("Unable to start: %s", err)
+			os.Exit(1)
+		}
+	}
+
+	if config.DNSCheck == DNSCheckFix && cloudflare == nil {
+		log.Warning("HERA_DNS_CHECK=fix requires HERA_CLOUDFLARE_API_TOKEN, DNS records will only be checked")
+	}
+
+	notify, err := newNotifiers(config)
+	if err != nil {
+		log.Errorf("Unable to start: %s", err)
+		os.Exit(1)
+	}
+	notifiers = notify
+	if names := notifiers.names(); len(names) > 0 {
+		log.Infof("Sending notifications to %s", strings.Join(names, ", "))
+	}
+
 	listener, err := NewListener()
 	if err != nil {
 		log.Errorf("Unable to start: %s", err)
+		os.Exit(ExitCode(err))
 	}
 
-	log.Infof("Hera v%s has started", CurrentVersion)
+	readiness.Set(CheckDocker, true)
+
+	bus.Subscribe(NewAnnouncer(listener.Client).Handle, EventTunnelStarted, EventTunnelDegraded)
+
+	about := DetectAbout(listener.Client, Command{}, listener.Fs)
+	about.Log()
 
 	err = VerifyCertificates(listener.Fs)
 	if err != nil {
 		log.Error(err.Error())
 	}
+	readiness.Set(CheckCertificates, err == nil)
+
+	go WatchCertificates(NewHandler(listener.Client), listener.Fs, config.CertWatchInterval, config.CertRotationStagger)
+
+	if consoleFormat(config.LogFormat, os.Stderr) == LogFormatConsole && config.LogSummaryInterval > 0 {
+		go WatchSummary(registry, config.LogSummaryInterval)
+	}
+
+	api := NewAPI(registry)
+	api.About = about
+	api.Handler = NewHandler(listener.Client)
+
+	if config.APIAddress != "" {
+		go func() {
+			err := api.ListenAndServe(config.APIAddress)
+			if err != nil {
+				log.Errorf("Unable to start API: %s", err)
+			}
+		}()
+	}
+
+	if config.MetricsAddress != "" {
+		go func() {
+			err := api.ListenAndServeMetrics(config.MetricsAddress)
+			if err != nil {
+				log.Errorf("Unable to start metrics: %s", err)
+			}
+		}()
+	}
+
+	if config.DebugAddress != "" {
+		debug := NewDebugServer(registry)
+
+		go func() {
+			err := debug.ListenAndServe(config.DebugAddress)
+			if err != nil {
+				log.Errorf("Unable to start debug endpoints: %s", err)
+			}
+		}()
+	}
+
+	if config.ControlSocket != "" {
+		control := NewControlServer(NewHandler(listener.Client), registry)
+
+		go func() {
+			err := control.ListenAndServe(config.ControlSocket)
+			if err != nil {
+				log.Errorf("Unable to start control socket: %s", err)
+			}
+		}()
+	}
+
+	if config.ProxyDNS && config.Mode != ModeObserve {
+		proxy := NewProxyDNS(config.ProxyDNSAddress, config.ProxyDNSPort, config.ProxyDNSUpstreams)
+
+		err := proxy.Start()
+		if err != nil {
+			log.Errorf("Unable to start proxy-dns: %s", err)
+		}
+	}
+
+	if elector != nil {
+		go WatchLeadership(elector)
+	}
+
+	if pool != nil && !config.IsObserving() {
+		go pool.refill()
+	}
+
+	go WatchExpiry(expiryInterval)
+	go WatchProcesses(processInterval)
+	go WatchSchedules(NewHandler(listener.Client), scheduleInterval)
+
+	if config.DriftInterval > 0 {
+		go WatchDrift(NewHandler(listener.Client), config.DriftInterval, config.DriftRemediate)
+	}
+
+	if config.HostsFile != "" {
+		go WatchHosts(listener.Fs, config.HostsFile, hostsInterval)
+	}
 
 	err = listener.Revive()
 	if err != nil {
-		log.Error(err.Error())
+		reportError(err, "")
+	}
+	if config.CloudflaredConfig != "" {
+		handler := NewHandler(listener.Client)
+
+		err := StartStaticTunnels(handler, config.CloudflaredConfig)
+		if err != nil {
+			reportError(err, "")
+		}
+
+		go WatchOrigins(handler, config.OriginResolveInterval)
 	}
+	readiness.Set(CheckReconciled, true)
 
 	listener.Listen()
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+)
+
+const (
+	defaultMaintenanceBody = "This site is undergoing maintenance and will be back shortly.\n"
+)
+
+var (
+	maintenance = &MaintenanceServer{}
+)
+
+// MaintenanceServer serves the maintenance response for paused tunnels. It is started on a local
+// address the first time a tunnel is paused.
+type MaintenanceServer struct {
+	mu      sync.Mutex
+	address string
+}
+
+// URL returns the URL of the maintenance server, starting it if it is not running yet
+func (m *MaintenanceServer) URL() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.address == "" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", fmt.Errorf("Unable to start maintenance server: %s", err)
+		}
+
+		go http.Serve(listener, http.HandlerFunc(m.serveMaintenance))
+		m.address = listener.Addr().String()
+	}
+
+	return fmt.Sprintf("http://%s", m.address), nil
+}
+
+// serveMaintenance responds with the configured maintenance page and status code
+func (m *MaintenanceServer) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	body := []byte(defaultMaintenanceBody)
+
+	if config.MaintenancePage != "" {
+		page, err := ioutil.ReadFile(config.MaintenancePage)
+		if err != nil {
+			log.Errorf("Unable to read maintenance page: %s", err)
+		} else {
+			body = page
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "120")
+	w.WriteHeader(config.MaintenanceStatus)
+	w.Write(body)
+}
+
+// SetMaintenance pauses or resumes the tunnel for the hostname. A paused tunnel stays registered but
+// serves the maintenance response instead of proxying to its origin. It must be called from the event loop.
+func SetMaintenance(r *Registry, hostname string, paused bool) (*Tunnel, error) {
+	tunnel, err := r.FindByHostname(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	r.SetPaused(hostname, paused)
+
+	if paused {
+		log.Infof("Pausing tunnel %s", hostname)
+	} else {
+		log.Infof("Resuming tunnel %s", hostname)
+	}
+
+	return tunnel, tunnel.SetPaused(paused)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestSetMaintenance(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	r := NewRegistry()
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.Config.Protocol = "http"
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(""), nil
+		},
+	}
+	r.Add(tunnel)
+
+	_, err := SetMaintenance(r, "site.tld", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.IsPaused("site.tld") || tunnel.State != TunnelPaused {
+		t.Error("Expected tunnel to be paused")
+	}
+
+	contents, _ := afero.ReadFile(fs, tunnel.Service.ConfigFilePath())
+	if strings.Contains(string(contents), "172.23.0.4") {
+		t.Error("Expected paused tunnel to not point at its origin")
+	}
+
+	_, err = SetMaintenance(r, "site.tld", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.IsPaused("site.tld") || tunnel.State != TunnelActive {
+		t.Error("Expected tunnel to be resumed")
+	}
+
+	contents, _ = afero.ReadFile(fs, tunnel.Service.ConfigFilePath())
+	if !strings.Contains(string(contents), "url: http://172.23.0.4:80") {
+		t.Error("Expected resumed tunnel to point at its origin")
+	}
+
+	_, err = SetMaintenance(r, "other.tld", true)
+	if err == nil {
+		t.Error("Expected error for unknown hostname")
+	}
+}
+
+func TestServeMaintenance(t *testing.T) {
+	rec := httptest.NewRecorder()
+	maintenance.serveMaintenance(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status, got %d", rec.Code)
+	}
+
+	if rec.Body.String() != defaultMaintenanceBody {
+		t.Errorf("Unexpected body, got %s", rec.Body.String())
+	}
+}
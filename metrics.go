@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetricsWriter collects metrics and writes them in the Prometheus text exposition format
+type MetricsWriter struct {
+	w        io.Writer
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+// metricFamily holds the samples written for a single metric name
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []string
+}
+
+// NewMetricsWriter returns a new MetricsWriter
+func NewMetricsWriter(w io.Writer) *MetricsWriter {
+	writer := &MetricsWriter{
+		w:     w,
+		index: make(map[string]*metricFamily),
+	}
+
+	return writer
+}
+
+// Write adds a single sample to the metric with the given name
+func (m *MetricsWriter) Write(name string, kind string, help string, labels map[string]string, value float64) {
+	m.writeSample(name, kind, help, name, labels, value)
+}
+
+// writeSample adds a sample to the metric family with the given name. The sample name differs from the
+// family name for the bucket, sum, and count samples of a histogram.
+func (m *MetricsWriter) writeSample(name string, kind string, help string, sample string, labels map[string]string, value float64) {
+	family, ok := m.index[name]
+	if !ok {
+		family = &metricFamily{name: name, kind: kind, help: help}
+		m.index[name] = family
+		m.families = append(m.families, family)
+	}
+
+	family.samples = append(family.samples, fmt.Sprintf("%s%s %v", sample, formatLabels(labels), value))
+}
+
+// Flush writes all collected metrics grouped by name, in the order they were first written
+func (m *MetricsWriter) Flush() error {
+	for _, family := range m.families {
+		_, err := fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n%s\n", family.name, family.help, family.name, family.kind, strings.Join(family.samples, "\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatLabels returns the labels formatted as a sorted Prometheus label set
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var pairs []string
+	for name, value := range labels {
+		value = strings.Replace(value, `\`, `\\`, -1)
+		value = strings.Replace(value, `"`, `\"`, -1)
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	sort.Strings(pairs)
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	collectors []Collector
+	collectMu  sync.Mutex
+
+	defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// A Collector writes its metrics to a MetricsWriter
+type Collector interface {
+	Collect(m *MetricsWriter)
+}
+
+// registerCollector adds a collector to the metrics served by the API
+func registerCollector(c Collector) {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
+	collectors = append(collectors, c)
+}
+
+// collectAll writes the metrics of all registered collectors
+func collectAll(m *MetricsWriter) {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
+	for _, c := range collectors {
+		c.Collect(m)
+	}
+}
+
+// CounterVec is a counter partitioned by a set of label names
+type CounterVec struct {
+	Name   string
+	Help   string
+	Labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec returns a new CounterVec registered to be served by the API
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{
+		Name:   name,
+		Help:   help,
+		Labels: labels,
+		values: make(map[string]float64),
+	}
+	registerCollector(counter)
+
+	return counter
+}
+
+// Inc increments the counter for the given label values by one
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter for the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[labelKey(values)] += delta
+}
+
+// Value returns the counter for the given label values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[labelKey(values)]
+}
+
+// Collect writes the counter values
+func (c *CounterVec) Collect(m *MetricsWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		m.Write(c.Name, "counter", c.Help, labelMap(c.Labels, key), c.values[key])
+	}
+}
+
+// HistogramVec is a histogram partitioned by a set of label names
+type HistogramVec struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogram
+}
+
+// histogram holds the observations of a single HistogramVec partition
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec returns a new HistogramVec with the default buckets registered to be served by the API
+func NewHistogramVec(name string, help string, labels ...string) *HistogramVec {
+	hist := &HistogramVec{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Buckets: defaultBuckets,
+		values:  make(map[string]*histogram),
+	}
+	registerCollector(hist)
+
+	return hist
+}
+
+// Observe adds an observation for the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labelKey(values)
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.Buckets))}
+		h.values[key] = hist
+	}
+
+	for i, bound := range h.Buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// Count returns the number of observations for the given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if hist, ok := h.values[labelKey(values)]; ok {
+		return hist.count
+	}
+
+	return 0
+}
+
+// Collect writes the cumulative buckets, sum, and count of each partition
+func (h *HistogramVec) Collect(m *MetricsWriter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hist := h.values[key]
+		labels := labelMap(h.Labels, key)
+
+		for i, bound := range h.Buckets {
+			bucketLabels := labelMap(h.Labels, key)
+			bucketLabels["le"] = fmt.Sprintf("%v", bound)
+			m.writeSample(h.Name, "histogram", h.Help, h.Name+"_bucket", bucketLabels, float64(hist.counts[i]))
+		}
+
+		infLabels := labelMap(h.Labels, key)
+		infLabels["le"] = "+Inf"
+		m.writeSample(h.Name, "histogram", h.Help, h.Name+"_bucket", infLabels, float64(hist.count))
+		m.writeSample(h.Name, "histogram", h.Help, h.Name+"_sum", labels, hist.sum)
+		m.writeSample(h.Name, "histogram", h.Help, h.Name+"_count", labels, float64(hist.count))
+	}
+}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelMap pairs label names with the values joined in a label key
+func labelMap(names []string, key string) map[string]string {
+	labels := make(map[string]string)
+	if len(names) == 0 {
+		return labels
+	}
+
+	for i, value := range strings.Split(key, "\xff") {
+		if i < len(names) {
+			labels[names[i]] = value
+		}
+	}
+
+	return labels
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWriterGroupsSamples(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMetricsWriter(&buf)
+
+	m.Write("a_total", "counter", "A.", map[string]string{"hostname": "a.tld"}, 1)
+	m.Write("b_total", "counter", "B.", map[string]string{"hostname": "a.tld"}, 2)
+	m.Write("a_total", "counter", "A.", map[string]string{"hostname": "b.tld"}, 3)
+	m.Flush()
+
+	expected := `# HELP a_total A.
+# TYPE a_total counter
+a_total{hostname="a.tld"} 1
+a_total{hostname="b.tld"} 3
+# HELP b_total B.
+# TYPE b_total counter
+b_total{hostname="a.tld"} 2
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected metrics output:\n%s", buf.String())
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	counter := &CounterVec{Name: "test_total", Help: "Test.", Labels: []string{"operation"}, values: make(map[string]float64)}
+	counter.Inc("inspect")
+	counter.Inc("inspect")
+	counter.Add(3, "list")
+
+	if counter.Value("inspect") != 2 {
+		t.Errorf("Unexpected counter value, got %v", counter.Value("inspect"))
+	}
+
+	var buf bytes.Buffer
+	m := NewMetricsWriter(&buf)
+	counter.Collect(m)
+	m.Flush()
+
+	if !strings.Contains(buf.String(), `test_total{operation="list"} 3`) {
+		t.Errorf("Unexpected metrics output:\n%s", buf.String())
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	hist := &HistogramVec{Name: "test_seconds", Help: "Test.", Labels: []string{"operation"}, Buckets: []float64{0.1, 1}, values: make(map[string]*histogram)}
+	hist.Observe(0.05, "inspect")
+	hist.Observe(0.5, "inspect")
+	hist.Observe(5, "inspect")
+
+	if hist.Count("inspect") != 3 {
+		t.Errorf("Unexpected observation count, got %d", hist.Count("inspect"))
+	}
+
+	var buf bytes.Buffer
+	m := NewMetricsWriter(&buf)
+	hist.Collect(m)
+	m.Flush()
+
+	expected := []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.1",operation="inspect"} 1`,
+		`test_seconds_bucket{le="1",operation="inspect"} 2`,
+		`test_seconds_bucket{le="+Inf",operation="inspect"} 3`,
+		`test_seconds_sum{operation="inspect"} 5.55`,
+		`test_seconds_count{operation="inspect"} 3`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected metrics to contain %s", line)
+		}
+	}
+}
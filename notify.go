@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	NotifyUp       = "up"
+	NotifyDown     = "down"
+	NotifyDegraded = "degraded"
+	NotifyCrash    = "crash"
+
+	notifyTimeout = 10 * time.Second
+)
+
+var (
+	notifiers = NewNotifiers(nil, 0)
+
+	notifyEvents = []string{NotifyUp, NotifyDown, NotifyDegraded, NotifyCrash}
+
+	busNotifyEvents = map[EventKind]string{
+		EventTunnelStarted:  NotifyUp,
+		EventTunnelStopped:  NotifyDown,
+		EventTunnelDegraded: NotifyDegraded,
+		EventTunnelFailed:   NotifyCrash,
+		EventDNSMismatch:    NotifyDegraded,
+	}
+
+	defaultNotifyTemplates = map[string]string{
+		NotifyUp:       "Tunnel {{.Hostname}} is up",
+		NotifyDown:     "Tunnel {{.Hostname}} is down",
+		NotifyDegraded: "Tunnel {{.Hostname}} is degraded: {{.Message}}",
+		NotifyCrash:    "Tunnel {{.Hostname}} failed: {{.Message}}",
+	}
+)
+
+// Notification describes a change of a tunnel that notifiers are told about
+type Notification struct {
+	Event       string
+	Hostname    string
+	ContainerID string
+	Tags        map[string]string
+	Message     string
+	Time        time.Time
+}
+
+// A Notifier delivers notification messages to a chat or mail service
+type Notifier interface {
+	Name() string
+	Send(text string) error
+}
+
+// NotifyRoute sends the notifications of the given events to a notifier
+type NotifyRoute struct {
+	Notifier Notifier
+	Events   map[string]bool
+}
+
+// Notifiers routes notifications to the configured notifiers, suppressing repeated notifications of
+// the same event for a hostname within the rate limit
+type Notifiers struct {
+	Routes    []*NotifyRoute
+	Templates map[string]*template.Template
+	RateLimit time.Duration
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// NewNotifiers returns Notifiers for the routes with the default templates
+func NewNotifiers(routes []*NotifyRoute, rateLimit time.Duration) *Notifiers {
+	n := &Notifiers{
+		Routes:    routes,
+		Templates: make(map[string]*template.Template),
+		RateLimit: rateLimit,
+		sent:      make(map[string]time.Time),
+	}
+
+	for event, text := range defaultNotifyTemplates {
+		n.Templates[event] = template.Must(template.New(event).Parse(text))
+	}
+
+	return n
+}
+
+// NewNotifyRoute returns a route for the events of the comma separated list, or for all events if it is empty
+func NewNotifyRoute(notifier Notifier, events []string) (*NotifyRoute, error) {
+	route := &NotifyRoute{
+		Notifier: notifier,
+		Events:   make(map[string]bool),
+	}
+
+	if len(events) == 0 {
+		events = notifyEvents
+	}
+
+	for _, event := range events {
+		if _, ok := defaultNotifyTemplates[event]; !ok {
+			return nil, fmt.Errorf("Unknown notification event for %s: %s", notifier.Name(), event)
+		}
+
+		route.Events[event] = true
+	}
+
+	return route, nil
+}
+
+// SetTemplate replaces the message template of an event
+func (n *Notifiers) SetTemplate(event string, text string) error {
+	if _, ok := defaultNotifyTemplates[event]; !ok {
+		return fmt.Errorf("Unknown notification event: %s", event)
+	}
+
+	tmpl, err := template.New(event).Parse(text)
+	if err != nil {
+		return fmt.Errorf("Invalid notification template for %s: %s", event, err)
+	}
+
+	n.Templates[event] = tmpl
+
+	return nil
+}
+
+// Handle sends the notification of a tunnel event published on the bus
+func (n *Notifiers) Handle(event *BusEvent) {
+	notifyEvent, ok := busNotifyEvents[event.Kind]
+	if !ok {
+		return
+	}
+
+	n.Notify(notifyEvent, event.Hostname, event.ContainerID, event.Tags, event.Message)
+}
+
+// Notify sends the notification of an event to the notifiers routed for it in the background
+func (n *Notifiers) Notify(event string, hostname string, containerID string, tags map[string]string, message string) {
+	if len(n.Routes) == 0 || !n.allow(event, hostname, time.Now()) {
+		return
+	}
+
+	notification := &Notification{
+		Event:       event,
+		Hostname:    hostname,
+		ContainerID: shortID(containerID),
+		Tags:        tags,
+		Message:     message,
+		Time:        time.Now(),
+	}
+
+	text, err := n.render(notification)
+	if err != nil {
+		log.Errorf("Unable to render notification: %s", err)
+		return
+	}
+
+	for _, route := range n.Routes {
+		if !route.Events[event] {
+			continue
+		}
+
+		go func(notifier Notifier) {
+			err := notifier.Send(text)
+			if err != nil {
+				log.Errorf("Unable to send notification to %s: %s", notifier.Name(), err)
+			}
+		}(route.Notifier)
+	}
+}
+
+// allow returns whether a notification of the event for the hostname may be sent, and records it
+func (n *Notifiers) allow(event string, hostname string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	key := event + " " + hostname
+	if last, ok := n.sent[key]; ok && now.Sub(last) < n.RateLimit {
+		log.Debugf("Suppressing repeated %s notification for %s", event, hostname)
+		return false
+	}
+
+	n.sent[key] = now
+
+	return true
+}
+
+// render returns the message of a notification from the template of its event
+func (n *Notifiers) render(notification *Notification) (string, error) {
+	var text bytes.Buffer
+
+	err := n.Templates[notification.Event].Execute(&text, notification)
+	if err != nil {
+		return "", err
+	}
+
+	return text.String(), nil
+}
+
+// SlackNotifier posts messages to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+// Name returns the name of the notifier
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Send posts the message to the webhook
+func (s *SlackNotifier) Send(text string) error {
+	return postJSON(s.WebhookURL, map[string]string{"text": text})
+}
+
+// DiscordNotifier posts messages to a Discord webhook
+type DiscordNotifier struct {
+	WebhookURL string
+}
+
+// Name returns the name of the notifier
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+// Send posts the message to the webhook
+func (d *DiscordNotifier) Send(text string) error {
+	return postJSON(d.WebhookURL, map[string]string{"content": text})
+}
+
+// TelegramNotifier sends messages to a Telegram chat through a bot
+type TelegramNotifier struct {
+	BaseURL string
+	Token   string
+	ChatID  string
+}
+
+// Name returns the name of the notifier
+func (t *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+// Send sends the message to the chat
+func (t *TelegramNotifier) Send(text string) error {
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.telegram.org"
+	}
+
+	return postJSON(fmt.Sprintf("%s/bot%s/sendMessage", baseURL, t.Token), map[string]string{"chat_id": t.ChatID, "text": text})
+}
+
+// EmailNotifier sends messages by mail through an SMTP server
+type EmailNotifier struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Name returns the name of the notifier
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Send mails the message with its first line as the subject
+func (e *EmailNotifier) Send(text string) error {
+	subject := strings.SplitN(text, "\n", 2)[0]
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [Hera] %s\r\n\r\n%s\r\n", e.From, strings.Join(e.To, ", "), subject, text)
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	return smtp.SendMail(e.Address, auth, e.From, e.To, []byte(message))
+}
+
+// postJSON posts the body as JSON to the URL and returns an error for unsuccessful responses
+func postJSON(url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// newNotifiers returns the notifiers configured by the config
+func newNotifiers(c *Config) (*Notifiers, error) {
+	var routes []*NotifyRoute
+
+	add := func(notifier Notifier, events []string) error {
+		route, err := NewNotifyRoute(notifier, events)
+		if err != nil {
+			return err
+		}
+
+		routes = append(routes, route)
+
+		return nil
+	}
+
+	if c.NotifySlackWebhook != "" {
+		err := add(&SlackNotifier{WebhookURL: c.NotifySlackWebhook}, c.NotifySlackEvents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.NotifyDiscordWebhook != "" {
+		err := add(&DiscordNotifier{WebhookURL: c.NotifyDiscordWebhook}, c.NotifyDiscordEvents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.NotifyTelegramToken != "" {
+		if c.NotifyTelegramChatID == "" {
+			return nil, fmt.Errorf("HERA_NOTIFY_TELEGRAM_CHAT_ID is required for Telegram notifications")
+		}
+
+		err := add(&TelegramNotifier{Token: c.NotifyTelegramToken, ChatID: c.NotifyTelegramChatID}, c.NotifyTelegramEvents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.NotifySMTPAddress != "" {
+		if c.NotifyEmailFrom == "" || len(c.NotifyEmailTo) == 0 {
+			return nil, fmt.Errorf("HERA_NOTIFY_EMAIL_FROM and HERA_NOTIFY_EMAIL_TO are required for email notifications")
+		}
+
+		notifier := &EmailNotifier{
+			Address:  c.NotifySMTPAddress,
+			Username: c.NotifySMTPUsername,
+			Password: c.NotifySMTPPassword,
+			From:     c.NotifyEmailFrom,
+			To:       c.NotifyEmailTo,
+		}
+
+		err := add(notifier, c.NotifyEmailEvents)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n := NewNotifiers(routes, c.NotifyRateLimit)
+
+	for event, text := range c.NotifyTemplates {
+		err := n.SetTemplate(event, text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// names returns the names of the configured notifiers
+func (n *Notifiers) names() []string {
+	var names []string
+	for _, route := range n.Routes {
+		names = append(names, route.Notifier.Name())
+	}
+
+	return names
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	sent chan string
+}
+
+func (r *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (r *recordingNotifier) Send(text string) error {
+	r.sent <- text
+	return nil
+}
+
+func newRecordingNotifiers(t *testing.T, events []string, rateLimit time.Duration) (*Notifiers, *recordingNotifier) {
+	notifier := &recordingNotifier{sent: make(chan string, 10)}
+
+	route, err := NewNotifyRoute(notifier, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewNotifiers([]*NotifyRoute{route}, rateLimit), notifier
+}
+
+func receive(t *testing.T, notifier *recordingNotifier) string {
+	select {
+	case text := <-notifier.sent:
+		return text
+	case <-time.After(time.Second):
+		t.Fatal("Expected a notification")
+		return ""
+	}
+}
+
+func TestNotify(t *testing.T) {
+	n, notifier := newRecordingNotifiers(t, nil, 0)
+
+	n.Notify(NotifyCrash, "site.tld", "5aa5a300dd0e5aa5a300dd0e", nil, "no certificate")
+
+	text := receive(t, notifier)
+	if text != "Tunnel site.tld failed: no certificate" {
+		t.Errorf("Unexpected notification, got %s", text)
+	}
+}
+
+func TestNotifyTemplate(t *testing.T) {
+	n, notifier := newRecordingNotifiers(t, nil, 0)
+
+	err := n.SetTemplate(NotifyUp, "{{.Hostname}} ({{.ContainerID}}) of {{.Tags.team}} is {{.Event}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(NotifyUp, "site.tld", "5aa5a300dd0e5aa5a300dd0e", map[string]string{"team": "payments"}, "")
+
+	text := receive(t, notifier)
+	if text != "site.tld (5aa5a300dd0e) of payments is up" {
+		t.Errorf("Unexpected notification, got %s", text)
+	}
+
+	err = n.SetTemplate("restarted", "{{.Hostname}}")
+	if err == nil {
+		t.Error("Expected error for an unknown event")
+	}
+
+	err = n.SetTemplate(NotifyUp, "{{.Hostname")
+	if err == nil {
+		t.Error("Expected error for an invalid template")
+	}
+}
+
+func TestNotifyRouting(t *testing.T) {
+	n, notifier := newRecordingNotifiers(t, []string{NotifyDown}, 0)
+
+	n.Notify(NotifyUp, "site.tld", "", nil, "")
+	n.Notify(NotifyDown, "site.tld", "", nil, "")
+
+	text := receive(t, notifier)
+	if text != "Tunnel site.tld is down" {
+		t.Errorf("Unexpected notification, got %s", text)
+	}
+
+	_, err := NewNotifyRoute(notifier, []string{"restarted"})
+	if err == nil {
+		t.Error("Expected error for an unknown event")
+	}
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	n, _ := newRecordingNotifiers(t, nil, time.Minute)
+	now := time.Now()
+
+	if !n.allow(NotifyDown, "site.tld", now) {
+		t.Error("Expected the first notification to be sent")
+	}
+
+	if n.allow(NotifyDown, "site.tld", now.Add(30*time.Second)) {
+		t.Error("Expected a repeated notification to be suppressed")
+	}
+
+	if !n.allow(NotifyDown, "other.tld", now.Add(30*time.Second)) {
+		t.Error("Expected a notification for another hostname to be sent")
+	}
+
+	if !n.allow(NotifyUp, "site.tld", now.Add(30*time.Second)) {
+		t.Error("Expected a notification for another event to be sent")
+	}
+
+	if !n.allow(NotifyDown, "site.tld", now.Add(2*time.Minute)) {
+		t.Error("Expected a notification after the rate limit to be sent")
+	}
+}
+
+func TestWebhookNotifiers(t *testing.T) {
+	var bodies []map[string]string
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	backends := []Notifier{
+		&SlackNotifier{WebhookURL: server.URL + "/slack"},
+		&DiscordNotifier{WebhookURL: server.URL + "/discord"},
+		&TelegramNotifier{BaseURL: server.URL, Token: "123:abc", ChatID: "42"},
+	}
+
+	for _, notifier := range backends {
+		err := notifier.Send("Tunnel site.tld is up")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if bodies[0]["text"] != "Tunnel site.tld is up" {
+		t.Errorf("Unexpected Slack message, got %v", bodies[0])
+	}
+
+	if bodies[1]["content"] != "Tunnel site.tld is up" {
+		t.Errorf("Unexpected Discord message, got %v", bodies[1])
+	}
+
+	if paths[2] != "/bot123:abc/sendMessage" || bodies[2]["chat_id"] != "42" || bodies[2]["text"] != "Tunnel site.tld is up" {
+		t.Errorf("Unexpected Telegram message to %s, got %v", paths[2], bodies[2])
+	}
+}
+
+func TestWebhookNotifierFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	notifier := &SlackNotifier{WebhookURL: server.URL}
+
+	err := notifier.Send("Tunnel site.tld is up")
+	if err == nil {
+		t.Error("Expected error for an unsuccessful response")
+	}
+}
+
+func TestNewNotifiers(t *testing.T) {
+	c := NewConfig()
+
+	n, err := newNotifiers(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(n.Routes) != 0 {
+		t.Errorf("Expected no notifiers, got %v", n.names())
+	}
+
+	c.NotifySlackWebhook = "https://hooks.slack.com/services/T/B/X"
+	c.NotifyTelegramToken = "123:abc"
+
+	_, err = newNotifiers(c)
+	if err == nil {
+		t.Error("Expected error for Telegram without a chat")
+	}
+
+	c.NotifyTelegramChatID = "42"
+	c.NotifyTelegramEvents = []string{NotifyCrash}
+	c.NotifyTemplates[NotifyCrash] = "{{.Hostname}} crashed"
+
+	n, err = newNotifiers(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := n.names()
+	if len(names) != 2 || names[0] != "slack" || names[1] != "telegram" {
+		t.Errorf("Unexpected notifiers, got %v", names)
+	}
+
+	if n.Routes[1].Events[NotifyUp] || !n.Routes[1].Events[NotifyCrash] {
+		t.Errorf("Unexpected Telegram events, got %v", n.Routes[1].Events)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+var (
+	eventOrder = NewEventOrder()
+
+	eventsStale = NewCounterVec("hera_events_stale_total", "Number of Docker events ignored because they were delivered out of order or the container changed state since.", "action")
+)
+
+// EventOrder remembers the time of the most recent lifecycle event handled for each container, so events
+// delivered out of order, such as when the event stream is replayed after reconnecting, are not acted on.
+// It is safe for concurrent use.
+type EventOrder struct {
+	mu     sync.Mutex
+	latest map[string]int64
+}
+
+// NewEventOrder returns a new, empty EventOrder
+func NewEventOrder() *EventOrder {
+	order := &EventOrder{
+		latest: make(map[string]int64),
+	}
+
+	return order
+}
+
+// Accept records the event and returns true, or returns false if a later event of its container has
+// already been handled. Events without a timestamp, such as those made up for running containers, are
+// always accepted.
+func (o *EventOrder) Accept(event events.Message) bool {
+	if event.TimeNano == 0 {
+		return true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if event.TimeNano < o.latest[event.ID] {
+		return false
+	}
+	o.latest[event.ID] = event.TimeNano
+
+	return true
+}
+
+// Forget drops the container, such as once it has been removed
+func (o *EventOrder) Forget(id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.latest, id)
+}
+
+// isCurrent returns whether a start or die event still matches the state of its container. The
+// container is inspected since its current state is the source of truth: a start event is stale once
+// the container has stopped again, and a die event is stale once the container is running again.
+func (h *Handler) isCurrent(event events.Message) bool {
+	container, err := h.Client.Inspect(event.ID)
+
+	switch event.Status {
+	case "start":
+		return err == nil && container.State != nil && container.State.Running
+
+	case "die":
+		return err != nil || container.State == nil || !container.State.Running
+	}
+
+	return true
+}
+
+// acceptEvent returns whether a lifecycle event of a container should be acted on, logging why it is
+// ignored if it should not
+func (h *Handler) acceptEvent(event events.Message) bool {
+	if !eventOrder.Accept(event) {
+		log.Infof("Ignoring %s event of %s delivered after a later event", event.Status, shortID(event.ID))
+		eventsStale.Inc(event.Status)
+		return false
+	}
+
+	if event.Status == "destroy" {
+		eventOrder.Forget(event.ID)
+		return true
+	}
+
+	if !h.isCurrent(event) {
+		change := "stopped"
+		if event.Status == "die" {
+			change = "started again"
+		}
+
+		log.Infof("Ignoring %s event of %s, the container has %s since", event.Status, shortID(event.ID), change)
+		eventsStale.Inc(event.Status)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"hera/harness"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestEventOrder(t *testing.T) {
+	order := NewEventOrder()
+
+	if !order.Accept(events.Message{ID: "a", Status: "start", TimeNano: 20}) {
+		t.Error("Expected the first event to be accepted")
+	}
+
+	if order.Accept(events.Message{ID: "a", Status: "die", TimeNano: 10}) {
+		t.Error("Expected an earlier event to be rejected")
+	}
+
+	if !order.Accept(events.Message{ID: "b", Status: "die", TimeNano: 10}) {
+		t.Error("Expected events of other containers to be accepted")
+	}
+
+	if !order.Accept(events.Message{ID: "a", Status: "start"}) {
+		t.Error("Expected an event without a timestamp to be accepted")
+	}
+
+	order.Forget("a")
+
+	if !order.Accept(events.Message{ID: "a", Status: "die", TimeNano: 10}) {
+		t.Error("Expected a forgotten container to accept any event")
+	}
+}
+
+func TestStaleEvents(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+	eventOrder = NewEventOrder()
+
+	id := "5aa5a300dd0e5aa5a300dd0e"
+	container := harness.NewContainer(id, map[string]string{"hera.hostname": "app.example.com", "hera.port": "8080"}, "172.17.0.2")
+
+	// The container restarts, and the stream delivers its die event after the second start event
+	docker.Run(container)
+	docker.Stop(id)
+	docker.Run(container)
+
+	start, die, restart := <-messages, <-messages, <-messages
+
+	handler.HandleEvent(start)
+	handler.HandleEvent(restart)
+	handler.HandleEvent(die)
+
+	if _, err := registry.FindByHostname("app.example.com"); err != nil || s6.Running("app.example.com") == nil {
+		t.Error("Expected the stale die event to leave the tunnel running")
+	}
+
+	// A die event delivered in order is still ignored once the container is running again
+	docker.Stop(id)
+	docker.Run(container)
+	handler.HandleEvent(<-messages)
+
+	if s6.Running("app.example.com") == nil {
+		t.Error("Expected the die event of a restarted container to be ignored")
+	}
+
+	// A start event is ignored once the container has stopped again
+	handler.HandleEvent(<-messages)
+	docker.Stop(id)
+	handler.HandleEvent(<-messages)
+	handler.HandleEvent(events.Message{ID: id, Status: "start", Type: events.ContainerEventType})
+
+	if s6.Running("app.example.com") != nil {
+		t.Error("Expected the start event of a stopped container to be ignored")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var (
+	pendingCertificates = NewPendingContainers()
+)
+
+// PendingContainers holds the containers whose tunnels are waiting, such as for a certificate to be added
+type PendingContainers struct {
+	mu         sync.Mutex
+	containers map[string]string
+}
+
+// NewPendingContainers returns a new, empty PendingContainers
+func NewPendingContainers() *PendingContainers {
+	pending := &PendingContainers{
+		containers: make(map[string]string),
+	}
+
+	return pending
+}
+
+// Add marks the container of the hostname as waiting
+func (p *PendingContainers) Add(containerID, hostname string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.containers[containerID] = hostname
+}
+
+// Remove stops waiting for the container
+func (p *PendingContainers) Remove(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.containers, containerID)
+}
+
+// Has returns whether the container is waiting
+func (p *PendingContainers) Has(containerID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, ok := p.containers[containerID]
+
+	return ok
+}
+
+// List returns the IDs of the waiting containers, sorted
+func (p *PendingContainers) List() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []string
+	for id := range p.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// WatchCertificates scans the certificate directory for changes every interval, retries the tunnels
+// of pending containers whenever certificates are added, and restarts the tunnels of replaced certificates
+func WatchCertificates(handler *Handler, fs afero.Fs, interval, stagger time.Duration) {
+	known := certificateFingerprints(fs)
+
+	for {
+		time.Sleep(interval)
+
+		current := certificateFingerprints(fs)
+		added := hasNewCertificate(known, current)
+		changed := changedCertificates(known, current)
+		known = current
+
+		if len(changed) > 0 {
+			rotateCertificates(changed, stagger)
+		}
+
+		if added {
+			readiness.Set(CheckCertificates, len(current) > 0)
+
+			// Pending containers are handled on the event loop so they don't race with their events
+			eventLoop.Do(func() {
+				retryPendingCertificates(handler)
+			})
+		}
+	}
+}
+
+// retryPendingCertificates handles each pending container again, removing it from the pending
+// containers unless a certificate is still missing
+func retryPendingCertificates(handler *Handler) {
+	for _, id := range pendingCertificates.List() {
+		log.Infof("Retrying tunnel for %s after certificates changed", shortID(id))
+
+		pendingCertificates.Remove(id)
+
+		err := handler.HandleContainer(id)
+		if err != nil {
+			reportError(err, id)
+		}
+	}
+}
+
+// hasNewCertificate returns whether current contains a certificate that is not in known
+func hasNewCertificate(known, current map[string]string) bool {
+	for name := range current {
+		if _, ok := known[name]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
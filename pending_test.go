@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPendingContainers(t *testing.T) {
+	pending := NewPendingContainers()
+	pending.Add("b", "b.example.com")
+	pending.Add("a", "a.example.com")
+
+	if !pending.Has("a") {
+		t.Error("Expected container to be pending")
+	}
+
+	ids := pending.List()
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("Unexpected pending containers, got %v", ids)
+	}
+
+	pending.Remove("a")
+	if pending.Has("a") {
+		t.Error("Expected container to no longer be pending")
+	}
+}
+
+func TestHasNewCertificate(t *testing.T) {
+	known := map[string]string{"example.com.pem": "a"}
+
+	if hasNewCertificate(known, map[string]string{}) {
+		t.Error("Expected removed certificates to be ignored")
+	}
+
+	if hasNewCertificate(known, map[string]string{"example.com.pem": "b"}) {
+		t.Error("Expected replaced certificates to be ignored")
+	}
+
+	if !hasNewCertificate(known, map[string]string{"example.com.pem": "a", "example.org.pem": "c"}) {
+		t.Error("Expected added certificate to be detected")
+	}
+}
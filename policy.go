@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkHostname returns an error if the hostname is denied or does not belong to an allowed domain.
+// Denied hostnames match exactly, or match any subdomain when given as *.domain.tld. When no domains
+// are allowed explicitly, every domain is allowed.
+func checkHostname(hostname string, deny []string, allowDomains []string) error {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	for _, denied := range deny {
+		denied = strings.ToLower(denied)
+
+		if strings.HasPrefix(denied, "*.") {
+			if strings.HasSuffix(hostname, denied[1:]) {
+				return NewError(ErrHostnameNotAllowed, fmt.Errorf("Hostname %s is denied by %s", hostname, denied))
+			}
+			continue
+		}
+
+		if hostname == denied {
+			return NewError(ErrHostnameNotAllowed, fmt.Errorf("Hostname %s is denied", hostname))
+		}
+	}
+
+	if len(allowDomains) == 0 {
+		return nil
+	}
+
+	for _, domain := range allowDomains {
+		domain = strings.ToLower(domain)
+
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return nil
+		}
+	}
+
+	return NewError(ErrHostnameNotAllowed, fmt.Errorf("Hostname %s is not within an allowed domain", hostname))
+}
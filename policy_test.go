@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckHostnameDeny(t *testing.T) {
+	deny := []string{"admin.example.com", "*.internal.example.com"}
+
+	hostnames := map[string]bool{
+		"admin.example.com":       false,
+		"ADMIN.example.com":       false,
+		"db.internal.example.com": false,
+		"internal.example.com":    true,
+		"blog.example.com":        true,
+		"notadmin.example.com":    true,
+	}
+
+	for hostname, allowed := range hostnames {
+		err := checkHostname(hostname, deny, nil)
+		if (err == nil) != allowed {
+			t.Errorf("Unexpected result for %s: %v", hostname, err)
+		}
+
+		if err != nil && KindOf(err) != ErrHostnameNotAllowed {
+			t.Errorf("Unexpected error kind, got %s", KindOf(err))
+		}
+	}
+}
+
+func TestCheckHostnameAllowDomains(t *testing.T) {
+	allow := []string{"example.com"}
+
+	hostnames := map[string]bool{
+		"example.com":      true,
+		"blog.example.com": true,
+		"badexample.com":   false,
+		"example.net":      false,
+	}
+
+	for hostname, allowed := range hostnames {
+		err := checkHostname(hostname, nil, allow)
+		if (err == nil) != allowed {
+			t.Errorf("Unexpected result for %s: %v", hostname, err)
+		}
+	}
+}
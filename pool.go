@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+var (
+	// pool holds the warm-standby connectors, or nil if HERA_POOL_SIZE is not set
+	pool *Pool
+
+	errPoolEmpty = errors.New("No idle connector in the pool")
+)
+
+// CloudflareTunnel is a named tunnel of a Cloudflare account
+type CloudflareTunnel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// IngressRoute is a rule of the remotely managed config of a named tunnel
+type IngressRoute struct {
+	Hostname      string                 `json:"hostname,omitempty"`
+	Service       string                 `json:"service"`
+	OriginRequest map[string]interface{} `json:"originRequest,omitempty"`
+}
+
+// PoolMember is a connector of the pool, running cloudflared for a named tunnel that serves
+// at most one hostname at a time
+type PoolMember struct {
+	Tunnel         *CloudflareTunnel
+	Service        *Service
+	MetricsAddress string
+
+	// Hostname is the hostname the connector serves, or empty while it is idle
+	Hostname string
+
+	zone   *Zone
+	record *DNSRecord
+}
+
+// Pool keeps a number of named tunnels connected to the Cloudflare edge before they are needed. A starting
+// tunnel is handed to an idle connector by updating its config through the API, which takes effect within
+// a second instead of the seconds cloudflared takes to start and connect.
+type Pool struct {
+	Size   int
+	Name   string
+	Client *CloudflareClient
+
+	// Commander runs the s6 commands of the connectors
+	Commander Commander
+
+	// Credentials provides the tunnel tokens used instead of those from the API, or is nil
+	Credentials TunnelCredentialSource
+
+	mu      sync.Mutex
+	members []*PoolMember
+	filling bool
+}
+
+// NewPool returns a new Pool keeping size idle connectors, named after name
+func NewPool(client *CloudflareClient, size int, name string) *Pool {
+	pool := &Pool{
+		Size:      size,
+		Name:      name,
+		Client:    client,
+		Commander: supervisor,
+	}
+
+	return pool
+}
+
+// newPool returns the pool selected by the config, or nil if it is disabled
+func newPool(c *Config, client *CloudflareClient) (*Pool, error) {
+	if c.PoolSize == 0 {
+		return nil, nil
+	}
+
+	if client == nil || client.AccountID == "" {
+		return nil, fmt.Errorf("HERA_POOL_SIZE requires HERA_CLOUDFLARE_API_TOKEN and HERA_CLOUDFLARE_ACCOUNT_ID")
+	}
+
+	p := NewPool(client, c.PoolSize, c.PoolName)
+	if credentials, ok := certificateSource.(TunnelCredentialSource); ok {
+		p.Credentials = credentials
+	}
+
+	return p, nil
+}
+
+// Fill starts connectors until the pool has Size idle ones. Only one fill runs at a time.
+func (p *Pool) Fill() error {
+	p.mu.Lock()
+	if p.filling {
+		p.mu.Unlock()
+		return nil
+	}
+	p.filling = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+
+	for p.Idle() < p.Size {
+		p.mu.Lock()
+		index := len(p.members)
+		p.mu.Unlock()
+
+		member, err := p.spawn(index)
+		if err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		p.members = append(p.members, member)
+		p.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Idle returns the number of idle connectors
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle := 0
+	for _, member := range p.members {
+		if member.Hostname == "" {
+			idle++
+		}
+	}
+
+	return idle
+}
+
+// spawn starts a connector for the named tunnel at the index, creating the tunnel unless it exists
+// from a previous run
+func (p *Pool) spawn(index int) (*PoolMember, error) {
+	name := fmt.Sprintf("%s-pool-%d", p.Name, index)
+
+	tunnel, err := p.Client.FindTunnel(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if tunnel == nil {
+		tunnel, err = p.Client.CreateTunnel(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := p.tunnelToken(tunnel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests are rejected until a hostname is assigned
+	err = p.Client.ConfigureTunnel(tunnel, []IngressRoute{{Service: "http_status:404"}})
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := reserveMetricsAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	service := NewService(name)
+	service.Commander = p.Commander
+
+	member := &PoolMember{
+		Tunnel:         tunnel,
+		Service:        service,
+		MetricsAddress: address,
+	}
+
+	err = member.start(token)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Started pooled connector %s", name)
+
+	return member, nil
+}
+
+// tunnelToken returns the token of the named tunnel from Credentials, or from the API if it has none
+func (p *Pool) tunnelToken(tunnel *CloudflareTunnel) (string, error) {
+	if p.Credentials != nil {
+		token, err := p.Credentials.TunnelToken(tunnel.Name)
+		if err != nil || token != "" {
+			return token, err
+		}
+	}
+
+	return p.Client.TunnelToken(tunnel)
+}
+
+// start writes the run file of the connector and starts its cloudflared process. The tunnel token is
+// kept in a file only readable by Hera rather than in the run file.
+func (m *PoolMember) start(token string) error {
+	err := m.Service.Create()
+	if err != nil {
+		return err
+	}
+
+	err = afero.WriteFile(fs, m.Service.TokenFilePath(), []byte(token), 0600)
+	if err != nil {
+		return err
+	}
+
+	runLines := []string{"#!/bin/sh"}
+	runLines = append(runLines, proxyExports()...)
+	runLines = append(runLines,
+		fmt.Sprintf("export TUNNEL_TOKEN=\"$(cat %s)\"", quoteArg(m.Service.TokenFilePath())),
+		fmt.Sprintf("exec cloudflared tunnel --no-autoupdate --metrics %s --logfile %s run", m.MetricsAddress, m.Service.LogFilePath()),
+	)
+
+	err = afero.WriteFile(fs, m.Service.RunFilePath(), []byte(strings.Join(runLines, "\n")), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	supervised, err := m.Service.IsSupervised()
+	if err != nil {
+		return err
+	}
+
+	if !supervised {
+		return m.Service.Supervise()
+	}
+
+	return m.Service.Restart()
+}
+
+// Assign routes the hostname to the origin URL through an idle connector, or through reuse if it is
+// given, and returns the connector. errPoolEmpty is returned if no connector is idle.
+func (p *Pool) Assign(hostname string, origin string, reuse *PoolMember) (*PoolMember, error) {
+	p.mu.Lock()
+	member := reuse
+	if member == nil {
+		for _, m := range p.members {
+			if m.Hostname == "" {
+				member = m
+				break
+			}
+		}
+	}
+
+	if member == nil {
+		p.mu.Unlock()
+		go p.refill()
+		return nil, errPoolEmpty
+	}
+	member.Hostname = hostname
+	p.mu.Unlock()
+
+	err := p.Route(member, origin)
+	if err != nil {
+		p.mu.Lock()
+		member.Hostname = ""
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	go p.refill()
+
+	return member, nil
+}
+
+// Route points the connector's hostname at the origin URL and the hostname's DNS at the connector
+func (p *Pool) Route(member *PoolMember, origin string) error {
+	routes := []IngressRoute{
+		{Hostname: member.Hostname, Service: origin, OriginRequest: originRequest(origin)},
+		{Service: "http_status:404"},
+	}
+
+	err := p.Client.ConfigureTunnel(member.Tunnel, routes)
+	if err != nil {
+		return err
+	}
+
+	if member.record != nil && member.record.Name == member.Hostname {
+		return nil
+	}
+
+	zone, err := p.Client.FindZone(member.Hostname)
+	if err != nil {
+		return err
+	}
+	if zone == nil {
+		return fmt.Errorf("Unable to route %s: no zone of the Cloudflare account contains it", member.Hostname)
+	}
+
+	record, err := p.Client.RouteDNS(zone, member.Hostname, member.target())
+	if err != nil {
+		return err
+	}
+
+	member.zone = zone
+	member.record = record
+
+	return nil
+}
+
+// originRequest returns the origin settings of a route to the origin URL. Like the config file of a tunnel
+// running its own cloudflared, certificates of https origins are not verified, since containers usually
+// serve self-signed ones. Other origins need no settings.
+func originRequest(origin string) map[string]interface{} {
+	if !strings.HasPrefix(origin, "https://") {
+		return nil
+	}
+
+	return map[string]interface{}{"noTLSVerify": true}
+}
+
+// Release returns the connector to the pool, removing the route of its hostname
+func (p *Pool) Release(member *PoolMember) error {
+	err := p.Client.ConfigureTunnel(member.Tunnel, []IngressRoute{{Service: "http_status:404"}})
+	if err != nil {
+		return err
+	}
+
+	if member.record != nil {
+		err = p.deleteRecord(member)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	member.Hostname = ""
+	member.zone = nil
+	member.record = nil
+	p.mu.Unlock()
+
+	return nil
+}
+
+// deleteRecord deletes the DNS record Hera created for the connector's hostname, unless it has since been
+// changed to point elsewhere
+func (p *Pool) deleteRecord(member *PoolMember) error {
+	records, err := p.Client.DNSRecords(member.zone, member.Hostname)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.ID == member.record.ID && record.Type == "CNAME" && strings.TrimSuffix(record.Content, ".") == member.target() {
+			return p.Client.DeleteDNSRecord(member.zone, record)
+		}
+	}
+
+	log.Warningf("DNS record of %s no longer points at pooled connector %s, leaving it in place", member.Hostname, member.Tunnel.Name)
+
+	return nil
+}
+
+// target returns the CNAME target routing hostnames to the connector
+func (m *PoolMember) target() string {
+	return m.Tunnel.ID + ".cfargotunnel.com"
+}
+
+// refill fills the pool in the background after connectors were assigned
+func (p *Pool) refill() {
+	err := p.Fill()
+	if err != nil {
+		reportError(err, "")
+	}
+}
+
+// startPooled hands the tunnel to an idle connector of the pool and returns whether it did. A tunnel
+// replacing a pooled tunnel for the same hostname takes over its connector, while one replacing a tunnel
+// that runs its own cloudflared keeps doing so.
+func (t *Tunnel) startPooled() (bool, error) {
+	reuse := t.pooled
+
+	if existing, err := registry.FindByHostname(t.Config.Hostname); err == nil && existing != t {
+		existing.mu.Lock()
+		if existing.pooled == nil && !existing.stopped {
+			existing.mu.Unlock()
+			return false, nil
+		}
+
+		if existing.pooled != nil {
+			reuse = existing.pooled
+			existing.pooled = nil
+			existing.stopped = true
+		}
+		existing.mu.Unlock()
+	}
+
+	origin, err := t.originURL()
+	if err != nil {
+		return false, err
+	}
+
+	member, err := pool.Assign(t.Config.Hostname, origin, reuse)
+	if err == errPoolEmpty {
+		log.Infof("No pooled connector is idle for %s, starting cloudflared", t.Config.Hostname)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log.Infof("Assigned tunnel %s to pooled connector %s", t.Config.Hostname, member.Tunnel.Name)
+
+	t.mu.Lock()
+	t.pooled = member
+	t.MetricsAddress = member.MetricsAddress
+	t.stopped = false
+	t.mu.Unlock()
+
+	return true, nil
+}
+
+// FindTunnel returns the named tunnel of the account with the name, or nil if there is none
+func (c *CloudflareClient) FindTunnel(name string) (*CloudflareTunnel, error) {
+	var tunnels []*CloudflareTunnel
+
+	err := c.request("GET", c.accountPath("/cfd_tunnel?is_deleted=false&name="+url.QueryEscape(name)), nil, &tunnels)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tunnels) == 0 {
+		return nil, nil
+	}
+
+	return tunnels[0], nil
+}
+
+// CreateTunnel creates a named tunnel whose config is managed through the API
+func (c *CloudflareClient) CreateTunnel(name string) (*CloudflareTunnel, error) {
+	tunnel := &CloudflareTunnel{}
+
+	err := c.request("POST", c.accountPath("/cfd_tunnel"), map[string]string{"name": name, "config_src": "cloudflare"}, tunnel)
+	if err != nil {
+		return nil, err
+	}
+
+	return tunnel, nil
+}
+
+// TunnelToken returns the token cloudflared runs the named tunnel with
+func (c *CloudflareClient) TunnelToken(tunnel *CloudflareTunnel) (string, error) {
+	var token string
+
+	err := c.request("GET", c.accountPath(fmt.Sprintf("/cfd_tunnel/%s/token", tunnel.ID)), nil, &token)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConfigureTunnel replaces the ingress rules of the named tunnel, which its connectors load without restarting
+func (c *CloudflareClient) ConfigureTunnel(tunnel *CloudflareTunnel, routes []IngressRoute) error {
+	body := map[string]interface{}{"config": map[string]interface{}{"ingress": routes}}
+
+	return c.request("PUT", c.accountPath(fmt.Sprintf("/cfd_tunnel/%s/configurations", tunnel.ID)), body, nil)
+}
+
+// RouteDNS points the hostname at the target with a proxied CNAME record, replacing a CNAME of the hostname
+// that points at a tunnel. An error is returned if the hostname has a CNAME pointing elsewhere, which Hera
+// did not create, or another kind of address record.
+func (c *CloudflareClient) RouteDNS(zone *Zone, hostname string, target string) (*DNSRecord, error) {
+	records, err := c.DNSRecords(zone, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"type": "CNAME", "name": hostname, "content": target, "proxied": true}
+	result := &DNSRecord{}
+
+	for _, record := range records {
+		switch record.Type {
+		case "CNAME":
+			if !isTunnelTarget(record.Content) {
+				return nil, fmt.Errorf("Unable to route %s: it has a CNAME record pointing at %s", hostname, record.Content)
+			}
+
+			err := c.request("PUT", fmt.Sprintf("/zones/%s/dns_records/%s", zone.ID, record.ID), body, result)
+			return result, err
+
+		case "A", "AAAA":
+			return nil, fmt.Errorf("Unable to route %s: it has an %s record pointing at %s", hostname, record.Type, record.Content)
+		}
+	}
+
+	err = c.request("POST", fmt.Sprintf("/zones/%s/dns_records", zone.ID), body, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func newPoolServer(requests *[]string, mu *sync.Mutex) *httptest.Server {
+	created := false
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/accounts/account")
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		if r.Method != "GET" {
+			encoded, _ := json.Marshal(body)
+			*requests = append(*requests, route+" "+string(encoded))
+		}
+		mu.Unlock()
+
+		switch {
+		case route == "GET /cfd_tunnel":
+			if r.URL.Query().Get("name") == "hera-pool-0" {
+				w.Write([]byte(`{"success": true, "result": [{"id": "existing", "name": "hera-pool-0"}]}`))
+				return
+			}
+			w.Write([]byte(`{"success": true, "result": []}`))
+
+		case route == "POST /cfd_tunnel":
+			w.Write([]byte(`{"success": true, "result": {"id": "created", "name": "hera-pool-1"}}`))
+
+		case strings.HasSuffix(route, "/token"):
+			w.Write([]byte(`{"success": true, "result": "secret"}`))
+
+		case strings.HasSuffix(route, "/configurations"):
+			w.Write([]byte(`{"success": true, "result": {}}`))
+
+		case route == "GET /zones" && r.URL.Query().Get("name") == "example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "zone", "name": "example.com"}]}`))
+
+		case route == "GET /zones/zone/dns_records" && r.URL.Query().Get("name") == "www.example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "user", "type": "CNAME", "name": "www.example.com", "content": "example.netlify.app"}]}`))
+
+		case route == "GET /zones/zone/dns_records" && created:
+			w.Write([]byte(`{"success": true, "result": [{"id": "record", "type": "CNAME", "name": "site.example.com", "content": "existing.cfargotunnel.com"}]}`))
+
+		case route == "GET /zones", route == "GET /zones/zone/dns_records":
+			w.Write([]byte(`{"success": true, "result": []}`))
+
+		case route == "POST /zones/zone/dns_records":
+			created = true
+			w.Write([]byte(`{"success": true, "result": {"id": "record", "type": "CNAME", "name": "site.example.com"}}`))
+
+		case route == "DELETE /zones/zone/dns_records/record":
+			w.Write([]byte(`{"success": true, "result": {"id": "record"}}`))
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"success": false, "errors": [{"code": 7003, "message": "Not found"}]}`))
+		}
+	}))
+}
+
+func TestPool(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	var requests []string
+	var mu sync.Mutex
+	server := newPoolServer(&requests, &mu)
+	defer server.Close()
+
+	client := NewCloudflareClient("token", "account")
+	client.BaseURL = server.URL
+
+	p := NewPool(client, 2, "hera")
+	p.Commander = MockCommander{mockRun: func() ([]byte, error) { return []byte("false"), nil }}
+
+	err := p.Fill()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Idle() != 2 {
+		t.Fatalf("Unexpected idle connectors, got %d", p.Idle())
+	}
+
+	if p.members[0].Tunnel.ID != "existing" || p.members[1].Tunnel.ID != "created" {
+		t.Errorf("Unexpected tunnels, got %s and %s", p.members[0].Tunnel.ID, p.members[1].Tunnel.ID)
+	}
+
+	run, _ := afero.ReadFile(fs, p.members[1].Service.RunFilePath())
+	token, _ := afero.ReadFile(fs, p.members[1].Service.TokenFilePath())
+	if string(token) != "secret" || strings.Contains(string(run), "secret") {
+		t.Errorf("Expected the token in its own file, got %s", token)
+	}
+
+	if !strings.Contains(string(run), `export TUNNEL_TOKEN="$(cat '`+p.members[1].Service.TokenFilePath()+`')"`) || !strings.Contains(string(run), "exec cloudflared tunnel --no-autoupdate --metrics 127.0.0.1:") {
+		t.Errorf("Unexpected run file, got %s", run)
+	}
+
+	// Keep the pool from refilling in the background
+	p.Size = 0
+
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+
+	member, err := p.Assign("site.example.com", "http://172.17.0.2:80", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if member != p.members[0] || member.Hostname != "site.example.com" || p.Idle() != 1 {
+		t.Errorf("Unexpected assignment, got %s for %s", member.Tunnel.Name, member.Hostname)
+	}
+
+	expected := []string{
+		`PUT /cfd_tunnel/existing/configurations {"config":{"ingress":[{"hostname":"site.example.com","service":"http://172.17.0.2:80"},{"service":"http_status:404"}]}}`,
+		`POST /zones/zone/dns_records {"content":"existing.cfargotunnel.com","name":"site.example.com","proxied":true,"type":"CNAME"}`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected requests, got\n%s", strings.Join(requests, "\n"))
+	}
+
+	requests = nil
+
+	err = p.Release(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{
+		`PUT /cfd_tunnel/existing/configurations {"config":{"ingress":[{"service":"http_status:404"}]}}`,
+		`DELETE /zones/zone/dns_records/record null`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected requests, got\n%s", strings.Join(requests, "\n"))
+	}
+
+	if p.Idle() != 2 {
+		t.Errorf("Expected the connector to be idle again, got %d idle", p.Idle())
+	}
+
+	// Hostnames with a CNAME Hera did not create are refused
+	_, err = p.Assign("www.example.com", "http://172.17.0.2:80", nil)
+	if err == nil || p.Idle() != 2 {
+		t.Errorf("Expected a hostname with a user CNAME to be refused, got %v", err)
+	}
+
+	p.members = nil
+
+	_, err = p.Assign("site.example.com", "http://172.17.0.2:80", nil)
+	if err != errPoolEmpty {
+		t.Errorf("Expected an empty pool, got %v", err)
+	}
+}
+
+func TestOriginRequest(t *testing.T) {
+	if request := originRequest("https://172.17.0.2:443"); request["noTLSVerify"] != true {
+		t.Errorf("Expected https origins to skip verification, got %v", request)
+	}
+
+	if request := originRequest("http://172.17.0.2:80"); request != nil {
+		t.Errorf("Expected no settings for http origins, got %v", request)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/docker/docker/api/types"
+)
+
+// maxPorts limits how many tunnels a single hera.port label can expand into
+const maxPorts = 32
+
+// PortRoute pairs a port of a container with the hostname it is published on
+type PortRoute struct {
+	Hostname string
+	Port     string
+}
+
+// parsePorts returns the ports of a hera.port label, which is a port, a range like 8080-8082, or a
+// comma separated list of both. An error is returned for ports that are not numbers between 1 and 65535.
+func parsePorts(value string) ([]string, error) {
+	var ports []string
+	seen := map[int]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("Invalid %s %q: empty port", heraPort, value)
+		}
+
+		first, last := item, item
+		if i := strings.Index(item, "-"); i > 0 {
+			first, last = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %s", heraPort, value, err)
+		}
+
+		end, err := parsePort(last)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %s", heraPort, value, err)
+		}
+
+		if end < start {
+			return nil, fmt.Errorf("Invalid %s %q: range %s ends before it starts", heraPort, value, item)
+		}
+
+		for port := start; port <= end; port++ {
+			if seen[port] {
+				continue
+			}
+			seen[port] = true
+
+			if len(ports) == maxPorts {
+				return nil, fmt.Errorf("Invalid %s %q: more than %d ports", heraPort, value, maxPorts)
+			}
+			ports = append(ports, strconv.Itoa(port))
+		}
+	}
+
+	return ports, nil
+}
+
+// parsePort returns a port number, or an error if it is not a number between 1 and 65535
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%d is out of range 1-65535", port)
+	}
+
+	return port, nil
+}
+
+// expandPorts returns the hostname of each port of the hera.port label. A hostname publishing several
+// ports must be a template using {{.Port}}, such as {{.Port}}.app.example.com, so each port gets its own
+// hostname. An empty port is returned as is, for tunnels that fall back to a default or need no port.
+func expandPorts(hostname string, value string) ([]PortRoute, error) {
+	if value == "" {
+		return []PortRoute{{Hostname: hostname}}, nil
+	}
+
+	ports, err := parsePorts(value)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(heraHostname).Option("missingkey=error").Parse(hostname)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q: %s", heraHostname, hostname, err)
+	}
+
+	var routes []PortRoute
+	for _, port := range ports {
+		var rendered bytes.Buffer
+
+		err := tmpl.Execute(&rendered, PortRoute{Port: port})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %s", heraHostname, hostname, err)
+		}
+
+		if len(ports) > 1 && rendered.String() == hostname {
+			return nil, fmt.Errorf("Unable to publish ports %s on %s: %s must contain {{.Port}} to give each port a hostname", value, hostname, heraHostname)
+		}
+
+		routes = append(routes, PortRoute{Hostname: rendered.String(), Port: port})
+	}
+
+	return routes, nil
+}
+
+// containerRoutes returns the hostname of each port the container publishes, using the default port
+// for containers without a hera.port label
+func containerRoutes(container types.ContainerJSON) ([]PortRoute, error) {
+	port := getLabel(heraPort, container)
+	if port == "" {
+		port = config.DefaultPort
+	}
+
+	return expandPorts(getLabel(heraHostname, container), port)
+}
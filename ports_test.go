@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParsePorts(t *testing.T) {
+	valid := map[string]string{
+		"8080":           "8080",
+		" 08080 ":        "8080",
+		"8080-8082":      "8080,8081,8082",
+		"80, 443":        "80,443",
+		"8080-8081,8081": "8080,8081",
+		"9000,8080-8081": "9000,8080,8081",
+	}
+
+	for value, expected := range valid {
+		ports, err := parsePorts(value)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", value, err)
+			continue
+		}
+
+		if strings.Join(ports, ",") != expected {
+			t.Errorf("Unexpected ports for %q, want %s got %s", value, expected, strings.Join(ports, ","))
+		}
+	}
+
+	invalid := map[string]string{
+		"http":      `"http" is not a number`,
+		"0":         "0 is out of range 1-65535",
+		"65536":     "65536 is out of range 1-65535",
+		"8082-8080": "range 8082-8080 ends before it starts",
+		"80,":       "empty port",
+		"8080-":     `"" is not a number`,
+		"1-100":     "more than 32 ports",
+	}
+
+	for value, expected := range invalid {
+		_, err := parsePorts(value)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error %q for %q, got %v", expected, value, err)
+		}
+	}
+}
+
+func TestExpandPorts(t *testing.T) {
+	routes, err := expandPorts("{{.Port}}.app.example.com", "8080-8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 2 || routes[0] != (PortRoute{"8080.app.example.com", "8080"}) || routes[1] != (PortRoute{"8081.app.example.com", "8081"}) {
+		t.Errorf("Unexpected routes, got %v", routes)
+	}
+
+	routes, err = expandPorts("app.example.com", "8080")
+	if err != nil || len(routes) != 1 || routes[0] != (PortRoute{"app.example.com", "8080"}) {
+		t.Errorf("Unexpected routes for a single port, got %v, %v", routes, err)
+	}
+
+	_, err = expandPorts("app.example.com", "8080,8081")
+	if err == nil || !strings.Contains(err.Error(), "must contain {{.Port}}") {
+		t.Errorf("Expected an error for several ports on one hostname, got %v", err)
+	}
+
+	_, err = expandPorts("{{.Name}}.example.com", "8080")
+	if err == nil {
+		t.Error("Expected an error for an unknown template field")
+	}
+}
+
+func TestSimulatePorts(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	container := newTTLContainer(map[string]string{"hera.hostname": "{{.Port}}.app.example.com", "hera.port": "8080-8081", "hera.ip": "10.0.0.2"}, "")
+
+	var out bytes.Buffer
+	code := simulate(&Handler{Simulate: true}, container, &out)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %d, output:\n%s", code, out.String())
+	}
+
+	for _, line := range []string{"hostname: 8080.app.example.com", "url: http://10.0.0.2:8080", "hostname: 8081.app.example.com", "url: http://10.0.0.2:8081"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	processInterval = 10 * time.Second
+
+	// clockTicks is the number of CPU time units per second reported in /proc
+	clockTicks = 100
+
+	procPath = "/proc"
+)
+
+// ProcessStats holds the resource usage and health of the cloudflared process of a tunnel
+type ProcessStats struct {
+	PID          int     `json:"pid"`
+	RSS          int64   `json:"rss_bytes"`
+	CPU          float64 `json:"cpu_percent"`
+	Restarts     int     `json:"restarts"`
+	LastExitCode *int    `json:"last_exit_code,omitempty"`
+
+	cpuTicks uint64
+	sampled  time.Time
+}
+
+// WatchProcesses samples the cloudflared process of each running tunnel at the given interval
+func WatchProcesses(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		for _, tunnel := range registry.List() {
+			if tunnel.State == TunnelDegraded || tunnel.State == TunnelObserved {
+				continue
+			}
+
+			err := tunnel.SampleProcess(time.Now())
+			if err != nil {
+				log.Debugf("Unable to sample process of %s: %s", tunnel.Config.Hostname, err)
+			}
+		}
+	}
+}
+
+// Process returns the most recent sample of the tunnel's cloudflared process, or nil if it was not sampled
+func (t *Tunnel) Process() *ProcessStats {
+	t.processMu.Lock()
+	defer t.processMu.Unlock()
+
+	return t.process
+}
+
+// SampleProcess records the resource usage of the tunnel's cloudflared process. A process with a
+// different ID than the previous sample counts as a restart, and a process that exited or was replaced
+// without Hera restarting it is published as a failure of the tunnel.
+func (t *Tunnel) SampleProcess(now time.Time) error {
+	pid, err := t.Service.PID()
+	if err != nil {
+		return err
+	}
+
+	previous := t.Process()
+	stats := &ProcessStats{PID: pid, sampled: now}
+
+	if code, ok := t.Service.LastExitCode(); ok {
+		stats.LastExitCode = &code
+	}
+
+	if previous != nil {
+		stats.Restarts = previous.Restarts
+		if pid != 0 && previous.PID != 0 && pid != previous.PID {
+			stats.Restarts++
+		}
+	}
+
+	if pid != 0 {
+		stats.RSS, stats.cpuTicks, err = readProcessUsage(pid)
+		if err != nil {
+			return err
+		}
+
+		if previous != nil && previous.PID == pid && now.After(previous.sampled) {
+			elapsed := now.Sub(previous.sampled).Seconds()
+			stats.CPU = float64(stats.cpuTicks-previous.cpuTicks) / clockTicks / elapsed * 100
+		}
+	}
+
+	t.processMu.Lock()
+	t.process = stats
+	t.processMu.Unlock()
+
+	if previous != nil && previous.PID != 0 && pid != previous.PID && !t.managedSince(previous.sampled) {
+		message := "cloudflared exited unexpectedly"
+		if stats.LastExitCode != nil {
+			message = fmt.Sprintf("cloudflared exited with code %d", *stats.LastExitCode)
+		}
+
+		t.publish(EventTunnelFailed, message)
+	}
+
+	return nil
+}
+
+// managedSince returns whether Hera started, restarted, or stopped the tunnel's process since the given time
+func (t *Tunnel) managedSince(since time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.stopped || t.managedAt.After(since)
+}
+
+// readProcessUsage returns the resident memory in bytes and the CPU time in clock ticks used by a process
+func readProcessUsage(pid int) (int64, uint64, error) {
+	dir := filepath.Join(procPath, strconv.Itoa(pid))
+
+	stat, err := afero.ReadFile(fs, filepath.Join(dir, "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The command name may contain spaces, so fields are counted from the parenthesis that closes it
+	end := strings.LastIndex(string(stat), ")")
+	if end < 0 {
+		return 0, 0, fmt.Errorf("Unexpected stat of process %d", pid)
+	}
+
+	fields := strings.Fields(string(stat)[end+1:])
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("Unexpected stat of process %d", pid)
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	status, err := afero.ReadFile(fs, filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var rss int64
+	for _, line := range strings.Split(string(status), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kilobytes, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			rss = kilobytes * 1024
+		}
+	}
+
+	return rss, utime + stime, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func writeProcess(pid string, ticks string, rss string) {
+	afero.WriteFile(fs, "/proc/"+pid+"/stat", []byte(pid+" (cloudflared tunnel) S 1 1 1 0 -1 4194560 1000 0 0 0 "+ticks+" 0 0 0 20 0 12 0"), 0644)
+	afero.WriteFile(fs, "/proc/"+pid+"/status", []byte("Name:\tcloudflared\nVmRSS:\t   "+rss+" kB\nThreads:\t12\n"), 0644)
+}
+
+func TestSampleProcess(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	pid := "1234"
+
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(pid + "\n"), nil
+		},
+	}
+
+	writeProcess("1234", "100", "20480")
+
+	start := time.Now()
+
+	err := tunnel.SampleProcess(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	process := tunnel.Process()
+	if process.PID != 1234 || process.RSS != 20480*1024 || process.CPU != 0 || process.Restarts != 0 {
+		t.Errorf("Unexpected first sample, got %+v", process)
+	}
+
+	// 50 ticks over 10 seconds is 5% of a CPU
+	writeProcess("1234", "150", "20480")
+
+	err = tunnel.SampleProcess(start.Add(10 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu := tunnel.Process().CPU; cpu != 5 {
+		t.Errorf("Unexpected CPU usage, got %f", cpu)
+	}
+
+	pid = "5678"
+	writeProcess("5678", "10", "10240")
+	afero.WriteFile(fs, tunnel.Service.ExitFilePath(), []byte("1\n"), 0644)
+
+	err = tunnel.SampleProcess(start.Add(20 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	process = tunnel.Process()
+	if process.PID != 5678 || process.Restarts != 1 || process.CPU != 0 {
+		t.Errorf("Expected a restart, got %+v", process)
+	}
+
+	if process.LastExitCode == nil || *process.LastExitCode != 1 {
+		t.Errorf("Expected the last exit code, got %v", process.LastExitCode)
+	}
+}
+
+func TestSampleProcessDown(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte("-1\n"), nil
+		},
+	}
+
+	err := tunnel.SampleProcess(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if process := tunnel.Process(); process.PID != 0 || process.RSS != 0 {
+		t.Errorf("Expected no process, got %+v", process)
+	}
+}
+
+func TestSampleProcessPublishesCrash(t *testing.T) {
+	defer func(previous *Bus) { bus = previous }(bus)
+	bus = NewBus()
+
+	var messages []string
+	bus.Subscribe(func(e *BusEvent) { messages = append(messages, e.Message) }, EventTunnelFailed)
+
+	fs = afero.NewMemMapFs()
+	pid := "1234"
+
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			return []byte(pid + "\n"), nil
+		},
+	}
+
+	writeProcess("1234", "100", "20480")
+	start := time.Now()
+	tunnel.SampleProcess(start)
+
+	// A new process after Hera restarted the tunnel is not a crash
+	tunnel.managedAt = start.Add(5 * time.Second)
+	pid = "5678"
+	writeProcess("5678", "10", "10240")
+	tunnel.SampleProcess(start.Add(10 * time.Second))
+
+	if len(messages) != 0 {
+		t.Fatalf("Expected no failure for a restart by Hera, got %v", messages)
+	}
+
+	pid = "9012"
+	writeProcess("9012", "10", "10240")
+	afero.WriteFile(fs, tunnel.Service.ExitFilePath(), []byte("1\n"), 0644)
+	tunnel.SampleProcess(start.Add(20 * time.Second))
+
+	if len(messages) != 1 || messages[0] != "cloudflared exited with code 1" {
+		t.Errorf("Expected the crash to be published, got %v", messages)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+)
+
+// StopProject stops the tunnels of the containers in the compose project and removes them from the
+// registry, leaving the containers running. The project is marked as stopped, so its tunnels are not
+// started again, even when its containers are restarted, until StartProject is called. The stopped
+// tunnels are returned.
+func StopProject(r *Registry, project string) ([]*Tunnel, error) {
+	if project == "" {
+		return nil, fmt.Errorf("No project given")
+	}
+
+	tunnels := projectTunnels(r, project)
+	if len(tunnels) == 0 {
+		return nil, fmt.Errorf("No tunnels found for project %s", project)
+	}
+
+	r.SetProjectStopped(project, true)
+
+	var stopped []*Tunnel
+	for _, tunnel := range tunnels {
+		_, err := tunnel.Stop()
+		if err != nil {
+			return stopped, err
+		}
+
+		r.Remove(tunnel)
+		stopped = append(stopped, tunnel)
+	}
+
+	log.Infof("Stopped %d tunnels of project %s", len(stopped), project)
+
+	return stopped, nil
+}
+
+// StartProject clears the stopped mark of the compose project and starts the tunnels of its running
+// containers again. The tunnels of the project are returned.
+func (h *Handler) StartProject(r *Registry, project string) ([]*Tunnel, error) {
+	if project == "" {
+		return nil, fmt.Errorf("No project given")
+	}
+
+	if !r.IsProjectStopped(project) {
+		return nil, fmt.Errorf("Project %s is not stopped", project)
+	}
+
+	r.SetProjectStopped(project, false)
+
+	containers, err := h.Client.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		if c.Labels[composeProject] != project {
+			continue
+		}
+
+		err := h.HandleContainer(c.ID)
+		if err != nil {
+			reportError(err, c.ID)
+		}
+	}
+
+	tunnels := projectTunnels(r, project)
+	log.Infof("Started %d tunnels of project %s", len(tunnels), project)
+
+	return tunnels, nil
+}
+
+// projectTunnels returns the registered tunnels of the containers in the compose project
+func projectTunnels(r *Registry, project string) []*Tunnel {
+	var tunnels []*Tunnel
+	for _, tunnel := range r.List() {
+		if project != "" && tunnel.Project == project {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	return tunnels
+}
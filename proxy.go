@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// proxyExports returns the shell lines of a run file that pass the configured outbound proxy to
+// cloudflared, since supervised services don't inherit the environment of Hera
+func proxyExports() []string {
+	var lines []string
+
+	for _, variable := range []struct{ name, value string }{
+		{"HTTPS_PROXY", config.HTTPSProxy},
+		{"HTTP_PROXY", config.HTTPProxy},
+		{"NO_PROXY", config.NoProxy},
+	} {
+		if variable.value != "" {
+			lines = append(lines, fmt.Sprintf("export %s=%s", variable.name, quoteArg(variable.value)))
+		}
+	}
+
+	return lines
+}
+
+// redactProxy returns the proxy URL without its password so it can be shared
+func redactProxy(proxy string) string {
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.User == nil {
+		return proxy
+	}
+
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), "redacted")
+	}
+
+	return parsed.String()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	proxyDNSServiceName = "proxy-dns"
+)
+
+// ProxyDNS holds config for a cloudflared proxy-dns process, which serves DNS queries over HTTPS
+type ProxyDNS struct {
+	Address   string
+	Port      string
+	Upstreams []string
+	Service   *Service
+}
+
+// NewProxyDNS returns a new ProxyDNS supervised by its own service
+func NewProxyDNS(address string, port string, upstreams []string) *ProxyDNS {
+	proxy := &ProxyDNS{
+		Address:   address,
+		Port:      port,
+		Upstreams: upstreams,
+		Service:   NewService(proxyDNSServiceName),
+	}
+
+	return proxy
+}
+
+// Start creates the proxy-dns service and starts it
+func (p *ProxyDNS) Start() error {
+	err := p.Service.Create()
+	if err != nil {
+		return err
+	}
+
+	err = p.writeRunFile()
+	if err != nil {
+		return err
+	}
+
+	supervised, err := p.Service.IsSupervised()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Starting proxy-dns on %s:%s", p.Address, p.Port)
+
+	if !supervised {
+		return p.Service.Supervise()
+	}
+
+	running, err := p.Service.IsRunning()
+	if err != nil {
+		return err
+	}
+
+	if running {
+		return p.Service.Restart()
+	}
+
+	return p.Service.Start()
+}
+
+// writeRunFile creates the run file for the proxy-dns service
+func (p *ProxyDNS) writeRunFile() error {
+	args := []string{
+		"--address", p.Address,
+		"--port", p.Port,
+		"--logfile", p.Service.LogFilePath(),
+	}
+
+	for _, upstream := range p.Upstreams {
+		args = append(args, "--upstream", upstream)
+	}
+
+	runLines := []string{"#!/bin/sh"}
+	runLines = append(runLines, proxyExports()...)
+	runLines = append(runLines, fmt.Sprintf("exec cloudflared proxy-dns %s", strings.Join(args, " ")))
+	contents := strings.Join(runLines, "\n")
+
+	err := afero.WriteFile(fs, p.Service.RunFilePath(), []byte(contents), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestProxyDNSWriteRunFile(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	proxy := NewProxyDNS("0.0.0.0", "5053", []string{"https://1.1.1.1/dns-query", "https://1.0.0.1/dns-query"})
+
+	err := proxy.writeRunFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := afero.ReadFile(fs, proxy.Service.RunFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "exec cloudflared proxy-dns --address 0.0.0.0 --port 5053 --logfile /var/log/hera/proxy-dns.log --upstream https://1.1.1.1/dns-query --upstream https://1.0.0.1/dns-query"
+	if !strings.Contains(string(contents), expected) {
+		t.Errorf("Unexpected run file contents:\n%s", contents)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+)
+
+const (
+	CheckDocker       = "docker"
+	CheckCertificates = "certificates"
+	CheckEvents       = "events"
+	CheckReconciled   = "reconciled"
+)
+
+var (
+	readiness = NewReadiness()
+)
+
+// Readiness tracks the checks that must pass before Hera is able to manage tunnels
+type Readiness struct {
+	mu     sync.RWMutex
+	checks map[string]bool
+}
+
+// NewReadiness returns a Readiness with all checks failing
+func NewReadiness() *Readiness {
+	readiness := &Readiness{
+		checks: map[string]bool{
+			CheckDocker:       false,
+			CheckCertificates: false,
+			CheckEvents:       false,
+			CheckReconciled:   false,
+		},
+	}
+
+	return readiness
+}
+
+// Set updates the result of a check
+func (r *Readiness) Set(check string, passed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[check] = passed
+}
+
+// Checks returns a snapshot of the check results and whether all of them passed
+func (r *Readiness) Checks() (map[string]bool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ready := true
+	checks := make(map[string]bool)
+	for check, passed := range r.checks {
+		checks[check] = passed
+		ready = ready && passed
+	}
+
+	return checks, ready
+}
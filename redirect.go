@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	heraRedirect       = "hera.redirect"
+	heraRedirectStatus = "hera.redirect-status"
+)
+
+var (
+	redirects = &RedirectServer{}
+)
+
+// Redirect sends the requests of a tunnel to another URL instead of proxying them to a container
+type Redirect struct {
+	Target string
+	Status int
+}
+
+// RedirectServer serves the redirects of tunnels by their hostname. cloudflared cannot redirect on its
+// own, so redirecting tunnels point at this server, which is started on a local address when first needed.
+type RedirectServer struct {
+	mu      sync.Mutex
+	address string
+}
+
+// URL returns the URL of the redirect server, starting it if it is not running yet
+func (s *RedirectServer) URL() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.address == "" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", fmt.Errorf("Unable to start redirect server: %s", err)
+		}
+
+		go http.Serve(listener, http.HandlerFunc(s.serveRedirect))
+		s.address = listener.Addr().String()
+	}
+
+	return fmt.Sprintf("http://%s", s.address), nil
+}
+
+// serveRedirect redirects a request to the target of the tunnel for its hostname, keeping its path and query
+func (s *RedirectServer) serveRedirect(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	tunnel, err := registry.FindByHostname(host)
+	if err != nil || tunnel.Config.Redirect.Target == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	redirect := tunnel.Config.Redirect
+	http.Redirect(w, r, strings.TrimSuffix(redirect.Target, "/")+r.URL.RequestURI(), redirect.Status)
+}
+
+// parseRedirect returns the redirect of a container from its hera.redirect and hera.redirect-status labels
+func parseRedirect(container types.ContainerJSON) (Redirect, error) {
+	redirect := Redirect{Target: getLabel(heraRedirect, container), Status: http.StatusMovedPermanently}
+
+	if redirect.Target == "" {
+		return Redirect{}, nil
+	}
+
+	target, err := url.Parse(redirect.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return Redirect{}, fmt.Errorf("Invalid URL for %s: %s", heraRedirect, redirect.Target)
+	}
+
+	if value := getLabel(heraRedirectStatus, container); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || (status != 301 && status != 302 && status != 307 && status != 308) {
+			return Redirect{}, fmt.Errorf("Invalid status for %s: %s must be 301, 302, 307, or 308", heraRedirectStatus, value)
+		}
+
+		redirect.Status = status
+	}
+
+	return redirect, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRedirect(t *testing.T) {
+	redirect, err := parseRedirect(newTenantContainer(map[string]string{heraRedirect: "https://new.example.com"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if redirect.Target != "https://new.example.com" || redirect.Status != http.StatusMovedPermanently {
+		t.Errorf("Unexpected redirect, got %+v", redirect)
+	}
+
+	redirect, err = parseRedirect(newTenantContainer(map[string]string{heraRedirect: "https://new.example.com", heraRedirectStatus: "302"}))
+	if err != nil || redirect.Status != http.StatusFound {
+		t.Errorf("Expected 302 redirect, got %+v %v", redirect, err)
+	}
+
+	redirect, err = parseRedirect(newTenantContainer(map[string]string{}))
+	if err != nil || redirect.Target != "" {
+		t.Errorf("Expected no redirect, got %+v %v", redirect, err)
+	}
+
+	invalid := []map[string]string{
+		{heraRedirect: "new.example.com"},
+		{heraRedirect: "ftp://new.example.com"},
+		{heraRedirect: "https://new.example.com", heraRedirectStatus: "200"},
+	}
+
+	for _, labels := range invalid {
+		_, err := parseRedirect(newTenantContainer(labels))
+		if err == nil {
+			t.Errorf("Expected error for %v", labels)
+		}
+	}
+}
+
+func TestServeRedirect(t *testing.T) {
+	registry = NewRegistry()
+	tunnel := newRegistryTunnel("old.example.com", "container-a")
+	tunnel.Config.Redirect = Redirect{Target: "https://new.example.com/", Status: http.StatusFound}
+	registry.Add(tunnel)
+
+	rec := httptest.NewRecorder()
+	redirects.serveRedirect(rec, httptest.NewRequest("GET", "http://old.example.com/blog?page=2", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Errorf("Unexpected status, got %d", rec.Code)
+	}
+
+	if location := rec.Header().Get("Location"); location != "https://new.example.com/blog?page=2" {
+		t.Errorf("Unexpected location, got %s", location)
+	}
+
+	rec = httptest.NewRecorder()
+	redirects.serveRedirect(rec, httptest.NewRequest("GET", "http://other.example.com/", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown hostname to not be found, got %d", rec.Code)
+	}
+}
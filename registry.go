@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	registry = NewRegistry()
+)
+
+// Registry holds the active tunnels and allows them to be looked up by hostname, container ID, or name.
+// It is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	hostnames  map[string]*Tunnel
+	containers map[string]*Tunnel
+	names      map[string]*Tunnel
+	paused     map[string]bool
+
+	// stoppedProjects holds the compose projects whose tunnels were stopped and must not be started
+	stoppedProjects map[string]bool
+}
+
+// NewRegistry returns a new, empty Registry
+func NewRegistry() *Registry {
+	registry := &Registry{
+		hostnames:  make(map[string]*Tunnel),
+		containers: make(map[string]*Tunnel),
+		names:      make(map[string]*Tunnel),
+		paused:     make(map[string]bool),
+
+		stoppedProjects: make(map[string]bool),
+	}
+
+	return registry
+}
+
+// Add registers a tunnel, replacing any tunnel previously registered for the same hostname
+func (r *Registry) Add(tunnel *Tunnel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.hostnames[tunnel.Config.Hostname]; ok {
+		r.remove(existing)
+	}
+
+	r.hostnames[tunnel.Config.Hostname] = tunnel
+	r.names[tunnel.Name()] = tunnel
+	if tunnel.ContainerID != "" {
+		r.containers[tunnel.ContainerID] = tunnel
+	}
+}
+
+// Remove unregisters a tunnel. Nothing is removed if a different tunnel has since claimed its hostname.
+func (r *Registry) Remove(tunnel *Tunnel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remove(tunnel)
+}
+
+// remove unregisters a tunnel, the caller must hold the lock
+func (r *Registry) remove(tunnel *Tunnel) {
+	if r.hostnames[tunnel.Config.Hostname] != tunnel {
+		return
+	}
+
+	delete(r.hostnames, tunnel.Config.Hostname)
+	delete(r.names, tunnel.Name())
+	if r.containers[tunnel.ContainerID] == tunnel {
+		delete(r.containers, tunnel.ContainerID)
+	}
+}
+
+// SetPaused marks a hostname as paused so that tunnels started for it serve the maintenance response
+func (r *Registry) SetPaused(hostname string, paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if paused {
+		r.paused[hostname] = true
+	} else {
+		delete(r.paused, hostname)
+	}
+}
+
+// IsPaused returns a bool to indicate if a hostname has been paused
+func (r *Registry) IsPaused(hostname string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.paused[hostname]
+}
+
+// SetProjectStopped marks a compose project as stopped so that no tunnels are started for its containers
+func (r *Registry) SetProjectStopped(project string, stopped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stopped {
+		r.stoppedProjects[project] = true
+	} else {
+		delete(r.stoppedProjects, project)
+	}
+}
+
+// IsProjectStopped returns a bool to indicate if a compose project has been stopped
+func (r *Registry) IsProjectStopped(project string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.stoppedProjects[project]
+}
+
+// FindByHostname returns the tunnel for a given hostname.
+// An error is returned if a tunnel is not found.
+func (r *Registry) FindByHostname(hostname string) (*Tunnel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tunnel, ok := r.hostnames[hostname]
+	if !ok {
+		return nil, fmt.Errorf("No tunnel exists for %s", hostname)
+	}
+
+	return tunnel, nil
+}
+
+// FindByContainer returns the tunnel created for the container with the given ID.
+// An error is returned if a tunnel is not found.
+func (r *Registry) FindByContainer(id string) (*Tunnel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tunnel, ok := r.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("No tunnel exists for container %s", id)
+	}
+
+	return tunnel, nil
+}
+
+// FindAllByContainer returns the tunnels created for the container with the given ID, such as one for
+// each port it publishes
+func (r *Registry) FindAllByContainer(id string) []*Tunnel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tunnels []*Tunnel
+	for _, tunnel := range r.hostnames {
+		if tunnel.ContainerID == id {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	return tunnels
+}
+
+// FindByName returns the tunnel with the given name.
+// An error is returned if a tunnel is not found.
+func (r *Registry) FindByName(name string) (*Tunnel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tunnel, ok := r.names[name]
+	if !ok {
+		return nil, fmt.Errorf("No tunnel exists with name %s", name)
+	}
+
+	return tunnel, nil
+}
+
+// FindByOrigin returns the tunnels pointing at the origin container with the given ID
+func (r *Registry) FindByOrigin(id string) []*Tunnel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tunnels []*Tunnel
+	for _, tunnel := range r.hostnames {
+		if tunnel.OriginID != "" && tunnel.OriginID == id {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	return tunnels
+}
+
+// List returns a snapshot of all registered tunnels sorted by hostname
+func (r *Registry) List() []*Tunnel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tunnels := make([]*Tunnel, 0, len(r.hostnames))
+	for _, tunnel := range r.hostnames {
+		tunnels = append(tunnels, tunnel)
+	}
+
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].Config.Hostname < tunnels[j].Config.Hostname
+	})
+
+	return tunnels
+}
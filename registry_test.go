@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func newRegistryTunnel(hostname string, containerID string) *Tunnel {
+	config := &TunnelConfig{
+		IP:       "172.23.0.4",
+		Hostname: hostname,
+		Port:     "80",
+	}
+	cert := NewCertificate("site.tld.pem", afero.NewMemMapFs())
+
+	tunnel := NewTunnel(config, cert)
+	tunnel.ContainerID = containerID
+
+	return tunnel
+}
+
+func TestRegistryFind(t *testing.T) {
+	r := NewRegistry()
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	r.Add(tunnel)
+
+	found, err := r.FindByHostname("site.tld")
+	if err != nil || found != tunnel {
+		t.Error("Expected tunnel by hostname")
+	}
+
+	found, err = r.FindByContainer("container-a")
+	if err != nil || found != tunnel {
+		t.Error("Expected tunnel by container")
+	}
+
+	found, err = r.FindByName(tunnel.Name())
+	if err != nil || found != tunnel {
+		t.Error("Expected tunnel by name")
+	}
+
+	_, err = r.FindByHostname("other.tld")
+	if err == nil {
+		t.Error("Expected error for unknown hostname")
+	}
+}
+
+func TestRegistryFindByOrigin(t *testing.T) {
+	r := NewRegistry()
+	tunnel := newRegistryTunnel("site.tld", "container-a")
+	tunnel.OriginID = "origin"
+	r.Add(tunnel)
+
+	if len(r.FindByOrigin("origin")) != 1 {
+		t.Error("Expected tunnel for origin")
+	}
+
+	if len(r.FindByOrigin("other")) != 0 {
+		t.Error("Expected no tunnels for other origin")
+	}
+}
+
+func TestRegistryReplaceHostname(t *testing.T) {
+	r := NewRegistry()
+	blue := newRegistryTunnel("site.tld", "container-a")
+	green := newRegistryTunnel("site.tld", "container-b")
+
+	r.Add(blue)
+	r.Add(green)
+
+	_, err := r.FindByContainer("container-a")
+	if err == nil {
+		t.Error("Expected replaced container to be unregistered")
+	}
+
+	// Removing the replaced tunnel must not remove the new one
+	r.Remove(blue)
+
+	found, err := r.FindByHostname("site.tld")
+	if err != nil || found != green {
+		t.Error("Expected green tunnel to remain registered")
+	}
+
+	r.Remove(green)
+
+	if len(r.List()) != 0 {
+		t.Errorf("Unexpected tunnel count, got %d", len(r.List()))
+	}
+}
+
+func TestRegistryList(t *testing.T) {
+	r := NewRegistry()
+	r.Add(newRegistryTunnel("b.tld", "container-b"))
+	r.Add(newRegistryTunnel("a.tld", "container-a"))
+
+	tunnels := r.List()
+	if len(tunnels) != 2 {
+		t.Fatalf("Unexpected tunnel count, got %d", len(tunnels))
+	}
+
+	if tunnels[0].Config.Hostname != "a.tld" {
+		t.Errorf("Expected tunnels sorted by hostname, got %s", tunnels[0].Config.Hostname)
+	}
+}
+
+func TestRegistryConcurrentAccess(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			hostname := fmt.Sprintf("%d.site.tld", i%10)
+			tunnel := newRegistryTunnel(hostname, fmt.Sprintf("container-%d", i))
+
+			r.Add(tunnel)
+			r.FindByHostname(hostname)
+			r.List()
+			r.Remove(tunnel)
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(r.List()) != 0 {
+		t.Errorf("Unexpected tunnel count, got %d", len(r.List()))
+	}
+}
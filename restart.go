@@ -0,0 +1,204 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+var (
+	restarts = NewRestartWindows()
+
+	restartsKept = NewCounterVec("hera_restarts_kept_total", "Number of container restarts a tunnel was kept alive across, by outcome.", "outcome")
+)
+
+// RestartWindows holds a timer for each container that exited but is expected to be restarted by its
+// restart policy. The tunnels of the container are only stopped when its timer fires. It is safe for
+// concurrent use.
+type RestartWindows struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewRestartWindows returns a new, empty RestartWindows
+func NewRestartWindows() *RestartWindows {
+	windows := &RestartWindows{
+		timers: make(map[string]*time.Timer),
+	}
+
+	return windows
+}
+
+// Add calls expire once the window has passed unless the container is cancelled before, replacing any
+// window the container already has
+func (r *RestartWindows) Add(id string, window time.Duration, expire func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if timer, ok := r.timers[id]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(window, func() {
+		r.mu.Lock()
+		current := r.timers[id] == timer
+		if current {
+			delete(r.timers, id)
+		}
+		r.mu.Unlock()
+
+		if current {
+			expire()
+		}
+	})
+	r.timers[id] = timer
+}
+
+// Cancel stops the window of the container and returns whether it had one
+func (r *RestartWindows) Cancel(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timer, ok := r.timers[id]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(r.timers, id)
+
+	return true
+}
+
+// Has returns whether the container has a window
+func (r *RestartWindows) Has(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.timers[id]
+
+	return ok
+}
+
+// List returns the IDs of the containers with a window, sorted
+func (r *RestartWindows) List() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := []string{}
+	for id := range r.timers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// willRestart returns whether Docker is expected to restart the exited container because of its restart
+// policy. A container stopped with docker stop is reported as restarting too, since its die event does
+// not tell; its window is cancelled by the stop event that follows.
+func willRestart(container types.ContainerJSON) bool {
+	if container.State != nil && container.State.Restarting {
+		return true
+	}
+
+	if container.HostConfig == nil {
+		return false
+	}
+
+	policy := container.HostConfig.RestartPolicy
+
+	switch policy.Name {
+	case "always", "unless-stopped":
+		return true
+	case "on-failure":
+		if container.State == nil || container.State.ExitCode == 0 {
+			return false
+		}
+
+		return policy.MaximumRetryCount == 0 || container.RestartCount < policy.MaximumRetryCount
+	}
+
+	return false
+}
+
+// keepAlive keeps the tunnels of the exited container running for the restart keep-alive window if its
+// restart policy is expected to start it again, and returns whether it did
+func (h *Handler) keepAlive(container types.ContainerJSON) bool {
+	window := config.RestartKeepAlive
+	if window <= 0 || !willRestart(container) {
+		return false
+	}
+
+	log.Infof("Container %s exited and should be restarted by its restart policy, keeping its tunnels for %s", shortID(container.ID), window)
+
+	restarts.Add(container.ID, window, func() {
+		eventLoop.Do(func() {
+			h.expireRestart(container)
+		})
+	})
+
+	return true
+}
+
+// expireRestart stops the tunnels of a container that was expected to restart, unless it is running again.
+// It runs on the event loop.
+func (h *Handler) expireRestart(container types.ContainerJSON) {
+	h.Client.Invalidate(container.ID)
+
+	current, err := h.Client.Inspect(container.ID)
+	if err == nil && current.State != nil && current.State.Running {
+		return
+	}
+
+	// Destroyed containers have had their tunnels released already
+	if len(registry.FindAllByContainer(container.ID)) == 0 {
+		return
+	}
+
+	log.Infof("Container %s did not restart within %s, stopping its tunnels", shortID(container.ID), config.RestartKeepAlive)
+	restartsKept.Inc("expired")
+
+	err = releaseContainer(container)
+	if err != nil {
+		reportError(err, container.ID)
+	}
+}
+
+// handleStopEvent stops the tunnels of a container kept alive for its restart policy right away, since
+// Docker does not restart a container that was stopped by hand
+func (h *Handler) handleStopEvent(event events.Message) error {
+	if !restarts.Cancel(event.ID) {
+		return nil
+	}
+
+	container, err := h.Client.Inspect(event.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Container %s was stopped, stopping its tunnels", shortID(container.ID))
+	restartsKept.Inc("stopped")
+
+	return releaseContainer(container)
+}
+
+// isKeptAlive returns whether the tunnel of a restarted container is already running unchanged, so it
+// does not need to be restarted
+func isKeptAlive(tunnel *Tunnel) bool {
+	existing, err := registry.FindByHostname(tunnel.Config.Hostname)
+	if err != nil || existing.ContainerID != tunnel.ContainerID || existing.Balancer != nil {
+		return false
+	}
+
+	if existing.State == TunnelDegraded || *existing.Config != *tunnel.Config {
+		return false
+	}
+
+	return existing.Certificate == tunnel.Certificate ||
+		(existing.Certificate != nil && tunnel.Certificate != nil && existing.Certificate.Name == tunnel.Certificate.Name)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"hera/harness"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// newRestartingContainer returns a harness container with the given restart policy
+func newRestartingContainer(id string, policy string) types.ContainerJSON {
+	c := harness.NewContainer(id, map[string]string{"hera.hostname": "app.example.com", "hera.port": "8080"}, "172.17.0.2")
+	c.HostConfig = &container.HostConfig{RestartPolicy: container.RestartPolicy{Name: policy}}
+
+	return c
+}
+
+func TestWillRestart(t *testing.T) {
+	tests := []struct {
+		policy   container.RestartPolicy
+		exitCode int
+		restarts int
+		expected bool
+	}{
+		{container.RestartPolicy{}, 1, 0, false},
+		{container.RestartPolicy{Name: "no"}, 1, 0, false},
+		{container.RestartPolicy{Name: "always"}, 0, 0, true},
+		{container.RestartPolicy{Name: "unless-stopped"}, 0, 0, true},
+		{container.RestartPolicy{Name: "on-failure"}, 0, 0, false},
+		{container.RestartPolicy{Name: "on-failure"}, 1, 0, true},
+		{container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 2, true},
+		{container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, 1, 3, false},
+	}
+
+	for _, test := range tests {
+		c := newRestartingContainer("5aa5a300dd0e5aa5a300dd0e", "")
+		c.HostConfig.RestartPolicy = test.policy
+		c.State.ExitCode = test.exitCode
+		c.RestartCount = test.restarts
+
+		if actual := willRestart(c); actual != test.expected {
+			t.Errorf("Unexpected result for %v exiting with %d after %d restarts, got %t", test.policy, test.exitCode, test.restarts, actual)
+		}
+	}
+}
+
+func TestRestartKeepsTunnelAlive(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+	defer func(window time.Duration) { config.RestartKeepAlive = window }(config.RestartKeepAlive)
+	config.RestartKeepAlive = time.Minute
+
+	id := "5aa5a300dd0e5aa5a300dd0e"
+	c := newRestartingContainer(id, "always")
+	docker.Run(c)
+	nextEvent(t, handler, messages)
+
+	docker.Stop(id)
+	nextEvent(t, handler, messages)
+
+	if _, err := registry.FindByHostname("app.example.com"); err != nil || !restarts.Has(id) {
+		t.Fatal("Expected the tunnel to be kept while the container restarts")
+	}
+
+	docker.Run(c)
+	nextEvent(t, handler, messages)
+
+	if restarts.Has(id) {
+		t.Error("Expected the restart window to be cancelled")
+	}
+
+	if s6.Running("app.example.com") == nil || s6.Starts("app.example.com") != 1 {
+		t.Errorf("Expected cloudflared to keep running, started %d times", s6.Starts("app.example.com"))
+	}
+}
+
+func TestRestartKeepsTunnelAliveWithoutDie(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+	defer func(window time.Duration) { config.RestartKeepAlive = window }(config.RestartKeepAlive)
+	config.RestartKeepAlive = time.Minute
+
+	id := "8dd8d633aa318dd8d633aa31"
+	docker.Run(newRestartingContainer(id, "always"))
+	nextEvent(t, handler, messages)
+
+	// The die event was dropped as stale, since the container was running again when it was handled
+	docker.Emit(events.Message{ID: id, Status: "start", Type: events.ContainerEventType, Action: "start"})
+	nextEvent(t, handler, messages)
+
+	if s6.Running("app.example.com") == nil || s6.Starts("app.example.com") != 1 {
+		t.Errorf("Expected cloudflared to keep running, started %d times", s6.Starts("app.example.com"))
+	}
+}
+
+func TestRestartWindowExpires(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+	defer func(window time.Duration) { config.RestartKeepAlive = window }(config.RestartKeepAlive)
+	config.RestartKeepAlive = 50 * time.Millisecond
+
+	id := "6bb6b411ee1f6bb6b411ee1f"
+	docker.Run(newRestartingContainer(id, "unless-stopped"))
+	nextEvent(t, handler, messages)
+
+	docker.Stop(id)
+	nextEvent(t, handler, messages)
+
+	// The expiry is handed to the event loop once the window passes
+	runTask(t)
+
+	if _, err := registry.FindByHostname("app.example.com"); err == nil {
+		t.Error("Expected the tunnel to be removed once the window passed")
+	}
+
+	if s6.Running("app.example.com") != nil {
+		t.Error("Expected cloudflared to be stopped")
+	}
+}
+
+func TestRestartWindowCancelledByStop(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+	defer func(window time.Duration) { config.RestartKeepAlive = window }(config.RestartKeepAlive)
+	config.RestartKeepAlive = time.Minute
+
+	id := "7cc7c522ff207cc7c522ff20"
+	docker.Run(newRestartingContainer(id, "always"))
+	nextEvent(t, handler, messages)
+
+	// docker stop emits a stop event after the die event
+	docker.Stop(id)
+	nextEvent(t, handler, messages)
+	docker.Emit(events.Message{ID: id, Status: "stop", Type: events.ContainerEventType, Action: "stop"})
+	nextEvent(t, handler, messages)
+
+	if restarts.Has(id) {
+		t.Error("Expected the restart window to be cancelled")
+	}
+
+	if _, err := registry.FindByHostname("app.example.com"); err == nil || s6.Running("app.example.com") != nil {
+		t.Error("Expected the tunnel to be stopped right away")
+	}
+}
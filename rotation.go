@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// certificateFingerprints returns the SHA-256 of the contents of each certificate, keyed by name
+func certificateFingerprints(fs afero.Fs) map[string]string {
+	fingerprints := make(map[string]string)
+
+	certs, err := FindAllCertificates(fs)
+	if err != nil {
+		return fingerprints
+	}
+
+	for _, cert := range certs {
+		contents, err := afero.ReadFile(fs, cert.FullPath())
+		if err != nil {
+			continue
+		}
+
+		sum := sha256.Sum256(contents)
+		fingerprints[cert.Name] = hex.EncodeToString(sum[:])
+	}
+
+	return fingerprints
+}
+
+// changedCertificates returns the sorted names of the certificates in both known and current
+// whose contents have changed
+func changedCertificates(known, current map[string]string) []string {
+	var names []string
+
+	for name, fingerprint := range current {
+		previous, ok := known[name]
+		if ok && previous != fingerprint {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// tunnelsUsingCertificates returns the running tunnels that use one of the named certificates
+func tunnelsUsingCertificates(names []string) []*Tunnel {
+	rotated := make(map[string]bool)
+	for _, name := range names {
+		rotated[name] = true
+	}
+
+	var tunnels []*Tunnel
+	for _, tunnel := range registry.List() {
+		if tunnel.State == TunnelDegraded || tunnel.State == TunnelObserved || tunnel.Certificate == nil {
+			continue
+		}
+
+		if rotated[tunnel.Certificate.Name] {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+
+	return tunnels
+}
+
+// rotateCertificates restarts the tunnels using the named certificates one at a time, waiting stagger
+// between restarts so the hostnames are not all down at once. Each restart runs on the event loop so it
+// doesn't race with the events of the tunnel's container, while the wait between restarts does not.
+func rotateCertificates(names []string, stagger time.Duration) {
+	var tunnels []*Tunnel
+	eventLoop.Do(func() {
+		tunnels = tunnelsUsingCertificates(names)
+	})
+
+	for i, tunnel := range tunnels {
+		if i > 0 && stagger > 0 {
+			time.Sleep(stagger)
+		}
+
+		eventLoop.Do(func() {
+			restartRotated(tunnel)
+		})
+	}
+}
+
+// restartRotated restarts a tunnel after its certificate changed, unless it was stopped or replaced since
+func restartRotated(tunnel *Tunnel) {
+	current, err := registry.FindByHostname(tunnel.Config.Hostname)
+	if err != nil || current != tunnel {
+		return
+	}
+
+	log.Infof("Restarting tunnel %s after its certificate %s changed", tunnel.Config.Hostname, tunnel.Certificate.Name)
+
+	err = tunnel.Restart()
+	if err != nil {
+		reportError(err, tunnel.ContainerID)
+	}
+}
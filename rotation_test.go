@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCertificateFingerprints(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte("first"), 0644)
+	afero.WriteFile(fs, "/certs/notes.txt", []byte{}, 0644)
+
+	known := certificateFingerprints(fs)
+	if len(known) != 1 || known["example.com.pem"] == "" {
+		t.Fatalf("Unexpected certificate fingerprints, got %v", known)
+	}
+
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte("second"), 0644)
+
+	current := certificateFingerprints(fs)
+	if current["example.com.pem"] == known["example.com.pem"] {
+		t.Error("Expected fingerprint to change with the contents")
+	}
+}
+
+func TestChangedCertificates(t *testing.T) {
+	known := map[string]string{"a.tld.pem": "1", "b.tld.pem": "2", "c.tld.pem": "3"}
+	current := map[string]string{"a.tld.pem": "1", "b.tld.pem": "4", "d.tld.pem": "5"}
+
+	changed := changedCertificates(known, current)
+	if !reflect.DeepEqual(changed, []string{"b.tld.pem"}) {
+		t.Errorf("Unexpected changed certificates, got %v", changed)
+	}
+}
+
+func TestTunnelsUsingCertificates(t *testing.T) {
+	registry = NewRegistry()
+
+	a := newRegistryTunnel("a.tld", "container-a")
+	a.Certificate = NewCertificate("a.tld.pem", afero.NewMemMapFs())
+	registry.Add(a)
+
+	b := newRegistryTunnel("b.tld", "container-b")
+	b.Certificate = NewCertificate("b.tld.pem", afero.NewMemMapFs())
+	registry.Add(b)
+
+	degraded := newRegistryTunnel("c.tld", "container-c")
+	degraded.Certificate = NewCertificate("a.tld.pem", afero.NewMemMapFs())
+	degraded.State = TunnelDegraded
+	registry.Add(degraded)
+
+	tunnels := tunnelsUsingCertificates([]string{"a.tld.pem"})
+	if len(tunnels) != 1 || tunnels[0] != a {
+		t.Errorf("Expected only the running tunnel of the certificate, got %d tunnels", len(tunnels))
+	}
+}
+
+func TestRotateCertificatesRestartsEachTunnel(t *testing.T) {
+	registry = NewRegistry()
+
+	var restarted []string
+	for _, hostname := range []string{"a.site.tld", "b.site.tld"} {
+		hostname := hostname
+		tunnel := newRegistryTunnel(hostname, "container-"+hostname)
+		tunnel.Service.Commander = &MockCommander{
+			mockRun: func() ([]byte, error) {
+				restarted = append(restarted, hostname)
+				return []byte(""), nil
+			},
+		}
+		registry.Add(tunnel)
+	}
+
+	done := make(chan bool)
+	go func() {
+		rotateCertificates([]string{"site.tld.pem"}, 0)
+		done <- true
+	}()
+
+	// Once to list the tunnels and once for each restart
+	for i := 0; i < 3; i++ {
+		runTask(t)
+	}
+	<-done
+
+	hostnames := map[string]bool{}
+	for _, hostname := range restarted {
+		hostnames[hostname] = true
+	}
+
+	if len(hostnames) != 2 {
+		t.Errorf("Expected both tunnels to be restarted, got %v", restarted)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	scheduleInterval = 30 * time.Second
+)
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// Schedule holds the windows during which a tunnel is available
+type Schedule struct {
+	Windows []*ScheduleWindow
+}
+
+// ScheduleWindow is a time range on a set of days, in minutes since midnight. Windows ending before
+// they start run past midnight.
+type ScheduleWindow struct {
+	Days  [7]bool
+	Start int
+	End   int
+}
+
+// ParseSchedule parses windows separated by semicolons in the form "Mon-Fri 08:00-18:00". Days can be a
+// single day, a range, or a comma separated list, and are matched in the local time zone.
+func ParseSchedule(value string) (*Schedule, error) {
+	schedule := &Schedule{}
+
+	for _, entry := range strings.Split(value, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid schedule window: %s", entry)
+		}
+
+		window := &ScheduleWindow{}
+
+		err := window.parseDays(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		err = window.parseTimes(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.Windows = append(schedule.Windows, window)
+	}
+
+	if len(schedule.Windows) == 0 {
+		return nil, fmt.Errorf("Invalid schedule: %s", value)
+	}
+
+	return schedule, nil
+}
+
+// IsActive returns whether the time falls within one of the windows of the schedule
+func (s *Schedule) IsActive(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	yesterday := (t.Weekday() + 6) % 7
+
+	for _, window := range s.Windows {
+		if window.Start < window.End {
+			if window.Days[t.Weekday()] && minute >= window.Start && minute < window.End {
+				return true
+			}
+			continue
+		}
+
+		// Windows past midnight belong to the day they start on
+		if (window.Days[t.Weekday()] && minute >= window.Start) || (window.Days[yesterday] && minute < window.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDays sets the days of the window from a day, a range such as Mon-Fri, or a list such as Sat,Sun
+func (w *ScheduleWindow) parseDays(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return fmt.Errorf("Invalid schedule day: %s", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[strings.ToLower(bounds[1])]
+			if !ok {
+				return fmt.Errorf("Invalid schedule day: %s", bounds[1])
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			w.Days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseTimes sets the start and end of the window from a range such as 08:00-18:00
+func (w *ScheduleWindow) parseTimes(value string) error {
+	bounds := strings.SplitN(value, "-", 2)
+	if len(bounds) != 2 {
+		return fmt.Errorf("Invalid schedule times: %s", value)
+	}
+
+	start, err := time.Parse("15:04", bounds[0])
+	if err != nil {
+		return fmt.Errorf("Invalid schedule time: %s", bounds[0])
+	}
+
+	end, err := time.Parse("15:04", bounds[1])
+	if err != nil {
+		return fmt.Errorf("Invalid schedule time: %s", bounds[1])
+	}
+
+	w.Start = start.Hour()*60 + start.Minute()
+	w.End = end.Hour()*60 + end.Minute()
+
+	if w.Start == w.End {
+		return fmt.Errorf("Invalid schedule times: %s", value)
+	}
+
+	return nil
+}
+
+// WatchSchedules periodically starts the tunnels of scheduled containers whose window has begun
+// and stops the tunnels whose window has ended. Schedules are applied on the event loop so they don't
+// race with the events of the same containers.
+func WatchSchedules(handler *Handler, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		var err error
+		eventLoop.Do(func() {
+			err = handler.applySchedules(time.Now())
+		})
+		if err != nil {
+			reportError(err, "")
+		}
+	}
+}
+
+// applySchedules starts or stops the tunnels of running containers with a hera.schedule label, or one set
+// through an environment variable or domain default
+func (h *Handler) applySchedules(now time.Time) error {
+	containers, err := h.Client.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		// Containers configured through environment variables can only be found by inspecting them
+		if c.Labels[heraHostname] == "" && !config.EnvLabels {
+			continue
+		}
+
+		container, err := h.Client.Inspect(c.ID)
+		if err != nil {
+			reportError(err, c.ID)
+			continue
+		}
+
+		value := getLabel(heraSchedule, container)
+		if value == "" {
+			continue
+		}
+
+		schedule, err := ParseSchedule(value)
+		if err != nil {
+			reportError(err, c.ID)
+			continue
+		}
+
+		tunnels := registry.FindAllByContainer(c.ID)
+		running := len(tunnels) > 0
+
+		// Containers still waiting to be started are left alone, since starting them again would cancel the wait
+		waiting := startWaits.Has(c.ID) || pendingCertificates.Has(c.ID) || pendingDependencies.Has(c.ID)
+
+		if schedule.IsActive(now) && !running && !waiting {
+			log.Infof("Schedule of %s has begun", c.ID[:12])
+
+			err := h.HandleContainer(c.ID)
+			if err != nil {
+				reportError(err, c.ID)
+			}
+		} else if !schedule.IsActive(now) && running {
+			log.Infof("Schedule of %s has ended", c.ID[:12])
+
+			for _, tunnel := range tunnels {
+				_, err := tunnel.Stop()
+				if err != nil {
+					reportError(err, c.ID)
+					continue
+				}
+
+				registry.Remove(tunnel)
+			}
+		}
+	}
+
+	return nil
+}
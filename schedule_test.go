@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"hera/harness"
+)
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("Mon-Fri 08:00-18:00; Sat,Sun 10:00-12:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schedule.Windows) != 2 {
+		t.Fatalf("Unexpected window count, got %d", len(schedule.Windows))
+	}
+
+	window := schedule.Windows[0]
+	if !window.Days[time.Monday] || !window.Days[time.Friday] || window.Days[time.Saturday] {
+		t.Errorf("Unexpected days, got %v", window.Days)
+	}
+
+	if window.Start != 8*60 || window.End != 18*60 {
+		t.Errorf("Unexpected times, got %d-%d", window.Start, window.End)
+	}
+
+	for _, value := range []string{"", "Mon-Fri", "Someday 08:00-18:00", "Mon 8am-6pm", "Mon 08:00-08:00"} {
+		if _, err := ParseSchedule(value); err == nil {
+			t.Errorf("Expected error for schedule %q", value)
+		}
+	}
+}
+
+func TestScheduleIsActive(t *testing.T) {
+	schedule, _ := ParseSchedule("Mon-Fri 08:00-18:00; Fri 22:00-02:00")
+
+	// 2020-01-06 is a Monday
+	times := map[string]bool{
+		"2020-01-06T08:00:00Z": true,
+		"2020-01-06T17:59:00Z": true,
+		"2020-01-06T18:00:00Z": false,
+		"2020-01-06T07:59:00Z": false,
+		"2020-01-11T12:00:00Z": false,
+		"2020-01-10T23:00:00Z": true,
+		"2020-01-11T01:00:00Z": true,
+		"2020-01-11T02:00:00Z": false,
+	}
+
+	for value, expected := range times {
+		now, _ := time.Parse(time.RFC3339, value)
+
+		if schedule.IsActive(now) != expected {
+			t.Errorf("Unexpected activity at %s, expected %t", value, expected)
+		}
+	}
+}
+
+func TestApplySchedulesSkipsWaitingContainers(t *testing.T) {
+	docker, s6, handler, messages := newHarness(t)
+	defer docker.Close()
+	defer s6.Close()
+	defer func() { supervisor = Command{} }()
+
+	id := "9ee9e744bb429ee9e744bb42"
+	labels := map[string]string{"hera.hostname": "tools.example.com", "hera.port": "8080", heraSchedule: "Mon-Sun 00:00-12:00; Mon-Sun 12:00-00:00"}
+	docker.Run(harness.NewContainer(id, labels, "172.17.0.2"))
+	nextEvent(t, handler, messages)
+
+	tunnel, err := registry.FindByHostname("tools.example.com")
+	if err != nil {
+		t.Fatal("Expected the tunnel to start within its schedule")
+	}
+	tunnel.Stop()
+	registry.Remove(tunnel)
+
+	// A container waiting for its readiness command is not started again
+	generation := startWaits.Begin(id)
+
+	err = handler.applySchedules(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.FindByHostname("tools.example.com"); err == nil {
+		t.Error("Expected the waiting container to be left alone")
+	}
+
+	if !startWaits.Finish(id, generation) {
+		t.Error("Expected the wait to not be cancelled")
+	}
+
+	err = handler.applySchedules(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := registry.FindByHostname("tools.example.com"); err != nil {
+		t.Error("Expected the tunnel to be started once the container is no longer waiting")
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"time"
     "path/filepath"
     "strings"
 
@@ -11,14 +14,21 @@ import (
 const (
 	ServicesPath = "/var/run/s6/services"
 	LogPath      = "/var/log/hera"
+	StopTimeout  = 10 * time.Second
 )
 
 var fs = afero.NewOsFs()
 
+// supervisor runs the s6 commands of new services, and is replaced by the harness in end-to-end tests
+var supervisor Commander = Command{}
+
 // Service holds config for an s6 service
 type Service struct {
 	Hostname string
 	Commander
+
+	// GracePeriod is how long the process is given to finish in-flight requests before it is killed
+	GracePeriod time.Duration
 }
 
 // NewService returns a new Service. Services are used to start and stop tunnel processes,
@@ -26,7 +36,7 @@ type Service struct {
 func NewService(hostname string) *Service {
 	service := &Service{
 		Hostname:  hostname,
-		Commander: Command{},
+		Commander: supervisor,
 	}
 
 	return service
@@ -47,6 +57,21 @@ func (s *Service) RunFilePath() string {
 	return filepath.Join(s.servicePath(), "run")
 }
 
+// FinishFilePath returns the full path for the service finish command
+func (s *Service) FinishFilePath() string {
+	return filepath.Join(s.servicePath(), "finish")
+}
+
+// ExitFilePath returns the full path for the file the finish command records the last exit code in
+func (s *Service) ExitFilePath() string {
+	return filepath.Join(s.servicePath(), "last-exit")
+}
+
+// TokenFilePath returns the full path for the file holding the token of a named tunnel
+func (s *Service) TokenFilePath() string {
+	return filepath.Join(s.servicePath(), "token")
+}
+
 // supervisePath returns the full path for the service supervise command
 func (s *Service) supervisePath() string {
 	return filepath.Join(s.servicePath(), "supervise")
@@ -93,19 +118,58 @@ func (s *Service) Start() error {
 	return nil
 }
 
-// Stop stops a service
+// Stop stops a service by sending its process SIGTERM and waits for it to exit. The process is killed
+// if it has not exited after its grace period and StopTimeout. Services with a grace period are waited
+// on in the background, so the tunnel and the event loop aren't held up while requests finish.
 func (s *Service) Stop() error {
 	_, err := s.Commander.Run("s6-svc", "-d", s.servicePath())
 	if err != nil {
 		return err
 	}
 
+	if s.GracePeriod > 0 {
+		go func() {
+			err := s.awaitStop()
+			if err != nil {
+				reportError(err, "")
+			}
+		}()
+
+		return nil
+	}
+
+	return s.awaitStop()
+}
+
+// awaitStop waits for the process of a stopped service to exit, and kills it if it has not exited after
+// its grace period and StopTimeout
+func (s *Service) awaitStop() error {
+	timeout := s.GracePeriod + StopTimeout
+
+	err := s.waitUntilDown(timeout)
+	if err == nil {
+		return nil
+	}
+
+	log.Warningf("Service %s did not stop within %s, killing it", s.Hostname, timeout)
+
+	_, err = s.Commander.Run("s6-svc", "-k", s.servicePath())
+	if err != nil {
+		return err
+	}
+
+	err = s.waitUntilDown(StopTimeout)
+	if err != nil {
+		return fmt.Errorf("Service %s did not stop: %s", s.Hostname, err)
+	}
+
 	return nil
 }
 
-// Restart restarts a service
+// Restart stops a service, waits for it to go down, and starts it again. Services with a grace period
+// are brought back up by s6 once their process has exited.
 func (s *Service) Restart() error {
-	err := s.waitUntilDown()
+	err := s.Stop()
 	if err != nil {
 		return err
 	}
@@ -118,9 +182,11 @@ func (s *Service) Restart() error {
 	return nil
 }
 
-// waitUntilDown returns when the service is down
-func (s *Service) waitUntilDown() error {
-	_, err := s.Commander.Run("s6-svwait", "-d", s.servicePath())
+// waitUntilDown returns when the service is down, or an error if it is still up after the timeout
+func (s *Service) waitUntilDown(timeout time.Duration) error {
+	milliseconds := strconv.FormatInt(int64(timeout/time.Millisecond), 10)
+
+	_, err := s.Commander.Run("s6-svwait", "-d", "-t", milliseconds, s.servicePath())
 	if err != nil {
 		return err
 	}
@@ -147,3 +213,37 @@ func (s *Service) IsRunning() (bool, error) {
 
 	return strings.Contains(string(out), "true"), nil
 }
+
+// PID returns the process ID of a service, or 0 if it is down
+func (s *Service) PID() (int, error) {
+	out, err := s.Commander.Run("s6-svstat", "-o", "pid", s.servicePath())
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected status of service %s: %s", s.Hostname, out)
+	}
+
+	if pid < 0 {
+		return 0, nil
+	}
+
+	return pid, nil
+}
+
+// LastExitCode returns the exit code of the last process of a service to exit, and false if none has
+func (s *Service) LastExitCode() (int, bool) {
+	contents, err := afero.ReadFile(fs, s.ExitFilePath())
+	if err != nil {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 0, false
+	}
+
+	return code, true
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 )
@@ -125,3 +127,83 @@ func TestIsRunning(t *testing.T) {
 		t.Error("Service should not be running")
 	}
 }
+
+func TestRestart(t *testing.T) {
+	calls := 0
+	service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			calls++
+			return []byte(""), nil
+		},
+	}
+
+	err := service.Restart()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// stop, wait until down, and start
+	if calls != 3 {
+		t.Errorf("Unexpected command count, got %d", calls)
+	}
+}
+
+func TestStopKillsAfterTimeout(t *testing.T) {
+	calls := 0
+	service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			calls++
+
+			// The first wait for the service to go down times out
+			if calls == 2 {
+				return nil, errors.New("timed out")
+			}
+			return []byte(""), nil
+		},
+	}
+
+	err := service.Stop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// stop, wait until down, kill, and wait until down again
+	if calls != 4 {
+		t.Errorf("Unexpected command count, got %d", calls)
+	}
+}
+
+type recordingCommander struct {
+	commands chan []string
+}
+
+func (c *recordingCommander) Run(name string, arg ...string) ([]byte, error) {
+	c.commands <- append([]string{name}, arg...)
+	return []byte(""), nil
+}
+
+func TestStopWaitsForGracePeriod(t *testing.T) {
+	commander := &recordingCommander{commands: make(chan []string, 4)}
+	service := NewService("site.tld")
+	service.Commander = commander
+	service.GracePeriod = 30 * time.Second
+
+	err := service.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stop := <-commander.commands; stop[0] != "s6-svc" || stop[1] != "-d" {
+		t.Errorf("Unexpected stop, got %v", stop)
+	}
+
+	// The grace period is added to the stop timeout before the process is killed, waiting in the background
+	select {
+	case wait := <-commander.commands:
+		if wait[0] != "s6-svwait" || wait[3] != "40000" {
+			t.Errorf("Unexpected wait, got %v", wait)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a wait for the service to go down")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/afero"
+)
+
+// runSimulate builds the tunnel for a running container or a container fixture without starting
+// cloudflared and prints its config, so label configurations can be validated in CI
+func runSimulate(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	containerID := flags.String("container", "", "ID or name of a container to simulate")
+	fixture := flags.String("fixture", "", "Path to the JSON output of docker inspect to simulate")
+
+	err := flags.Parse(args)
+	if err != nil || (*containerID == "") == (*fixture == "") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	handler := &Handler{
+		Resolver: newResolver(config.ResolverAddress),
+		Simulate: true,
+	}
+
+	var container types.ContainerJSON
+	if *fixture != "" {
+		container, err = loadFixture(*fixture)
+	} else {
+		handler.Client, err = NewClient()
+		if err == nil {
+			container, err = handler.Client.Inspect(*containerID)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load container: %s\n", err)
+		return 1
+	}
+
+	return simulate(handler, container, os.Stdout)
+}
+
+// simulate builds the tunnels for the container and writes the config cloudflared would be started with for each
+func simulate(handler *Handler, container types.ContainerJSON, w io.Writer) int {
+	if handler.Client == nil && getLabel(heraOrigin, container) != "" {
+		fmt.Fprintf(w, "Error: %s requires a connection to Docker, simulate with --container instead\n", heraOrigin)
+		return 1
+	}
+
+	warnings := checkLabels(container)
+	for _, name := range warnings.Missing {
+		fmt.Fprintf(w, "Warning: missing label %s\n", name)
+	}
+	for _, name := range warnings.Unknown {
+		fmt.Fprintf(w, "Warning: unknown label %s is ignored%s\n", name, suggestionHint(name))
+	}
+
+	tunnels, err := handler.newTunnels(container)
+	if err != nil {
+		fmt.Fprintf(w, "Error (%s): %s\n", KindOf(err), err)
+		return 1
+	}
+
+	if len(tunnels) == 0 {
+		fmt.Fprintln(w, "Container is not configured for a tunnel")
+		return 1
+	}
+
+	for i, tunnel := range tunnels {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		contents, err := tunnel.configFileContents()
+		if err != nil {
+			fmt.Fprintf(w, "Error: %s\n", err)
+			return 1
+		}
+
+		fmt.Fprintf(w, "# Tunnel for %s\n%s\n", tunnel.Config.Hostname, contents)
+
+		if tunnel.Config.Args != "" {
+			fmt.Fprintf(w, "# Extra cloudflared arguments\n%s\n", tunnel.Config.Args)
+		}
+
+		fmt.Fprintf(w, "# Effective settings\n%s", tunnel.Effective.String())
+	}
+
+	return 0
+}
+
+// loadFixture reads a container from the JSON output of docker inspect, which is either a single
+// container or a list holding one container
+func loadFixture(path string) (types.ContainerJSON, error) {
+	var container types.ContainerJSON
+
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return container, err
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(contents)), "[") {
+		var containers []types.ContainerJSON
+
+		err = json.Unmarshal(contents, &containers)
+		if err != nil {
+			return container, err
+		}
+
+		if len(containers) != 1 {
+			return container, fmt.Errorf("Expected one container in %s, found %d", path, len(containers))
+		}
+
+		return containers[0], nil
+	}
+
+	err = json.Unmarshal(contents, &container)
+
+	return container, err
+}
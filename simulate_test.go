@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+const simulateFixture = `[{
+	"Id": "5aa5a300dd0e5aa5a300dd0e",
+	"State": {"Running": true, "StartedAt": "2020-01-01T10:00:00Z"},
+	"Config": {"Labels": {"hera.hostname": "app.example.com", "hera.port": "8080", "hera.ip": "10.0.0.2"}}
+}]`
+
+func TestSimulate(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/fixture.json", []byte(simulateFixture), 0644)
+
+	container, err := loadFixture("/fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := simulate(&Handler{Simulate: true}, container, &out)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %d, output:\n%s", code, out.String())
+	}
+
+	for _, line := range []string{"hostname: app.example.com", "url: http://10.0.0.2:8080", "origincert: /certs/app.example.com.pem"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestSimulateUnlabeled(t *testing.T) {
+	container := newTTLContainer(map[string]string{}, "")
+
+	var out bytes.Buffer
+	if simulate(&Handler{Simulate: true}, container, &out) != 1 {
+		t.Error("Expected unlabeled container to fail")
+	}
+
+	container = newTTLContainer(map[string]string{heraHostname: "app.example.com", heraPort: "80", heraOrigin: "db"}, "")
+	out.Reset()
+	if simulate(&Handler{Simulate: true}, container, &out) != 1 || !strings.Contains(out.String(), "requires a connection to Docker") {
+		t.Errorf("Expected origin container to require Docker, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/afero"
+)
+
+const heraStaticDir = "hera.static-dir"
+
+var (
+	sites = &SiteServer{}
+)
+
+// SiteServer serves the static directories of tunnels by their hostname, so docs or status pages mounted
+// into the Hera container can be exposed without another container. It is started on a local address when
+// first needed.
+type SiteServer struct {
+	mu      sync.Mutex
+	address string
+}
+
+// URL returns the URL of the site server, starting it if it is not running yet
+func (s *SiteServer) URL() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.address == "" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", fmt.Errorf("Unable to start static file server: %s", err)
+		}
+
+		go http.Serve(listener, http.HandlerFunc(s.serveSite))
+		s.address = listener.Addr().String()
+	}
+
+	return fmt.Sprintf("http://%s", s.address), nil
+}
+
+// serveSite serves a file from the static directory of the tunnel for the request's hostname
+func (s *SiteServer) serveSite(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	tunnel, err := registry.FindByHostname(host)
+	if err != nil || tunnel.Config.StaticDir == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.FileServer(afero.NewHttpFs(fs).Dir(tunnel.Config.StaticDir)).ServeHTTP(w, r)
+}
+
+// parseStaticDir returns the directory from the container's hera.static-dir label, which must be an
+// absolute path to a directory inside HERA_STATIC_ROOT. Directories holding certificates or tunnel and
+// Access tokens, or containing them, are refused so a label can't publish them.
+func parseStaticDir(container types.ContainerJSON) (string, error) {
+	dir := getLabel(heraStaticDir, container)
+	if dir == "" {
+		return "", nil
+	}
+
+	if config.StaticRoot == "" {
+		return "", fmt.Errorf("Invalid directory for %s: static directories require HERA_STATIC_ROOT", heraStaticDir)
+	}
+
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("Invalid directory for %s: %s must be an absolute path", heraStaticDir, dir)
+	}
+
+	dir = filepath.Clean(dir)
+
+	if !isWithinDir(dir, filepath.Clean(config.StaticRoot)) {
+		return "", fmt.Errorf("Invalid directory for %s: %s is not inside HERA_STATIC_ROOT %s", heraStaticDir, dir, config.StaticRoot)
+	}
+
+	for _, protected := range []string{CertificatePath, VaultCertificatePath, DecryptedCertificatePath, AccessTokenPath, ServicesPath} {
+		if isWithinDir(dir, protected) || isWithinDir(protected, dir) {
+			return "", fmt.Errorf("Invalid directory for %s: %s would publish the certificates or tokens in %s", heraStaticDir, dir, protected)
+		}
+	}
+
+	isDir, err := afero.IsDir(fs, dir)
+	if err != nil || !isDir {
+		return "", fmt.Errorf("Invalid directory for %s: %s is not a directory mounted into Hera", heraStaticDir, dir)
+	}
+
+	return dir, nil
+}
+
+// isWithinDir returns whether the cleaned path is the directory or inside it
+func isWithinDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseStaticDir(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	fs.MkdirAll("/srv/site", 0755)
+	fs.MkdirAll("/srv/other", 0755)
+	fs.MkdirAll(CertificatePath, 0755)
+
+	_, err := parseStaticDir(newTenantContainer(map[string]string{heraStaticDir: "/srv/site"}))
+	if err == nil {
+		t.Error("Expected error without HERA_STATIC_ROOT")
+	}
+
+	config.StaticRoot = "/srv/site"
+	defer func() { config.StaticRoot = "" }()
+
+	dir, err := parseStaticDir(newTenantContainer(map[string]string{heraStaticDir: "/srv/site/"}))
+	if err != nil || dir != "/srv/site" {
+		t.Errorf("Unexpected directory, got %s %v", dir, err)
+	}
+
+	invalid := []string{"srv/site", "/srv/site/missing", "/srv/other", "/srv/site/../other", "/", CertificatePath}
+
+	for _, value := range invalid {
+		_, err := parseStaticDir(newTenantContainer(map[string]string{heraStaticDir: value}))
+		if err == nil {
+			t.Errorf("Expected error for %s", value)
+		}
+	}
+
+	// Certificates are never published, even when they are inside the root
+	config.StaticRoot = "/"
+
+	for _, value := range []string{"/", CertificatePath, "/var/run/hera"} {
+		_, err := parseStaticDir(newTenantContainer(map[string]string{heraStaticDir: value}))
+		if err == nil {
+			t.Errorf("Expected error for %s", value)
+		}
+	}
+}
+
+func TestServeSite(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/srv/site/status.html", []byte("all systems operational"), 0644)
+
+	registry = NewRegistry()
+	tunnel := newRegistryTunnel("status.example.com", "container-a")
+	tunnel.Config.StaticDir = "/srv/site"
+	registry.Add(tunnel)
+
+	rec := httptest.NewRecorder()
+	sites.serveSite(rec, httptest.NewRequest("GET", "http://status.example.com/status.html", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "all systems operational" {
+		t.Errorf("Unexpected response, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	sites.serveSite(rec, httptest.NewRequest("GET", "http://other.example.com/status.html", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown hostname to not be found, got %d", rec.Code)
+	}
+}
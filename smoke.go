@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	heraSmokePath   = "hera.smoke-test-path"
+	heraSmokeStatus = "hera.smoke-test-status"
+
+	SmokeVerified = "verified"
+	SmokeDegraded = "degraded"
+
+	smokeAttempts = 6
+	smokeInterval = 10 * time.Second
+	smokeTimeout  = 10 * time.Second
+)
+
+// SmokeTest is the request made through the public hostname of a tunnel to verify it serves the origin
+type SmokeTest struct {
+	Path string
+
+	// Status is the expected status code, or 0 to accept any 2xx response
+	Status int
+}
+
+// SmokeResult is the outcome of the most recent smoke test of a tunnel
+type SmokeResult struct {
+	Result     string    `json:"result"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// parseSmokeTest returns the smoke test of a container from its hera.smoke-test-* labels
+func parseSmokeTest(container types.ContainerJSON) (SmokeTest, error) {
+	test := SmokeTest{Path: getLabel(heraSmokePath, container)}
+
+	if test.Path == "" {
+		test.Path = "/"
+	} else if test.Path[0] != '/' {
+		return test, fmt.Errorf("Invalid path for %s: %s must start with /", heraSmokePath, test.Path)
+	}
+
+	if value := getLabel(heraSmokeStatus, container); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return test, fmt.Errorf("Invalid status for %s: %s", heraSmokeStatus, value)
+		}
+
+		test.Status = status
+	}
+
+	return test, nil
+}
+
+// Smoke returns the result of the tunnel's most recent smoke test, or nil if it was not tested
+func (t *Tunnel) Smoke() *SmokeResult {
+	t.smokeMu.Lock()
+	defer t.smokeMu.Unlock()
+
+	return t.smoke
+}
+
+// runSmokeTest requests the smoke test path from the base URL until the expected response is received,
+// and marks the tunnel as verified, or as degraded if every attempt fails
+func (t *Tunnel) runSmokeTest(baseURL string, attempts int, interval time.Duration) {
+	var result *SmokeResult
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		result = t.SmokeTest.check(baseURL)
+		if result.Result == SmokeVerified {
+			break
+		}
+
+		if attempt < attempts {
+			time.Sleep(interval)
+		}
+	}
+
+	t.smokeMu.Lock()
+	t.smoke = result
+	t.smokeMu.Unlock()
+
+	if result.Result == SmokeVerified {
+		log.Infof("Tunnel %s passed its smoke test", t.Config.Hostname)
+		return
+	}
+
+	t.publish(EventTunnelDegraded, fmt.Sprintf("its smoke test failed: %s", result.Error))
+}
+
+// check makes a single smoke test request to the base URL
+func (s SmokeTest) check(baseURL string) *SmokeResult {
+	result := &SmokeResult{Result: SmokeDegraded, CheckedAt: time.Now()}
+
+	client := &http.Client{Timeout: smokeTimeout}
+
+	// An expected status such as a redirect must be checked before it is followed
+	if s.Status != 0 {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	resp, err := client.Get(baseURL + s.Path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if s.Status != 0 {
+		ok = resp.StatusCode == s.Status
+	}
+
+	if !ok {
+		result.Error = fmt.Sprintf("unexpected response %s", resp.Status)
+		return result
+	}
+
+	result.Result = SmokeVerified
+
+	return result
+}
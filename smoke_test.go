@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseSmokeTest(t *testing.T) {
+	test, err := parseSmokeTest(newTenantContainer(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if test.Path != "/" || test.Status != 0 {
+		t.Errorf("Unexpected default smoke test, got %+v", test)
+	}
+
+	test, err = parseSmokeTest(newTenantContainer(map[string]string{heraSmokePath: "/healthz", heraSmokeStatus: "204"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if test.Path != "/healthz" || test.Status != 204 {
+		t.Errorf("Unexpected smoke test, got %+v", test)
+	}
+
+	invalid := []map[string]string{
+		{heraSmokePath: "healthz"},
+		{heraSmokeStatus: "ok"},
+		{heraSmokeStatus: "999"},
+	}
+
+	for _, labels := range invalid {
+		if _, err := parseSmokeTest(newTenantContainer(labels)); err == nil {
+			t.Errorf("Expected error for %v", labels)
+		}
+	}
+}
+
+func TestSmokeTestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/login", http.StatusFound)
+		case "/login":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	tests := map[SmokeTest]string{
+		{Path: "/"}:                           SmokeVerified,
+		{Path: "/", Status: http.StatusFound}: SmokeVerified,
+		{Path: "/", Status: http.StatusOK}:    SmokeDegraded,
+		{Path: "/api"}:                        SmokeDegraded,
+	}
+
+	for test, expected := range tests {
+		result := test.check(server.URL)
+		if result.Result != expected {
+			t.Errorf("Unexpected result for %+v, got %+v", test, result)
+		}
+	}
+}
+
+func TestRunSmokeTestDegrades(t *testing.T) {
+	defer func(previous *Bus) { bus = previous }(bus)
+	bus = NewBus()
+
+	var degraded *BusEvent
+	bus.Subscribe(func(e *BusEvent) { degraded = e }, EventTunnelDegraded)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	tunnel := newTunnel()
+	tunnel.SmokeTest = SmokeTest{Path: "/"}
+	tunnel.runSmokeTest(server.URL, 2, 0)
+
+	smoke := tunnel.Smoke()
+	if smoke.Result != SmokeDegraded || smoke.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected the tunnel to be degraded, got %+v", smoke)
+	}
+
+	if degraded == nil || degraded.Hostname != "site.tld" {
+		t.Error("Expected a degraded event for the tunnel")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	stateVersion = 1
+
+	SourceContainer = "container"
+	SourceAdHoc     = "adhoc"
+	SourceStatic    = "static"
+)
+
+// State is a portable snapshot of the tunnels Hera manages, for moving a deployment to a new host.
+// Certificates and credentials are referenced by name and are not included.
+type State struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	PoolName   string         `json:"pool_name,omitempty"`
+	Tunnels    []*TunnelState `json:"tunnels"`
+}
+
+// TunnelState is a tunnel of a State
+type TunnelState struct {
+	Hostname string `json:"hostname"`
+
+	// Source is how the tunnel was created: from a container, on demand, or from a cloudflared config
+	Source  string `json:"source"`
+	Project string `json:"project,omitempty"`
+
+	// Origin is the host:port the tunnel proxies to, with Protocol
+	Origin   string `json:"origin,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+
+	// Certificate is the name of the certificate file in /certs
+	Certificate string `json:"certificate,omitempty"`
+
+	// PooledTunnel is the named tunnel of the pool serving the hostname, which is reused by name
+	PooledTunnel *CloudflareTunnel `json:"pooled_tunnel,omitempty"`
+
+	Paused    bool              `json:"paused,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// ExportState returns the state of the tunnels
+func ExportState(tunnels []*Tunnel, now time.Time) *State {
+	state := &State{
+		Version:    stateVersion,
+		ExportedAt: now.UTC(),
+		Tunnels:    []*TunnelState{},
+	}
+
+	if pool != nil {
+		state.PoolName = pool.Name
+	}
+
+	for _, tunnel := range tunnels {
+		state.Tunnels = append(state.Tunnels, newTunnelState(tunnel))
+	}
+
+	return state
+}
+
+// newTunnelState returns the state of a tunnel
+func newTunnelState(t *Tunnel) *TunnelState {
+	state := &TunnelState{
+		Hostname: t.Config.Hostname,
+		Source:   tunnelSource(t),
+		Project:  t.Project,
+		Protocol: t.Config.Protocol,
+		Paused:   t.Paused,
+		Tags:     t.Tags,
+	}
+
+	if !t.Config.isLocal() {
+		host := t.Config.IP
+		if t.Config.OriginName != "" {
+			host = t.Config.OriginName
+		}
+		state.Origin = net.JoinHostPort(host, t.Config.Port)
+	}
+
+	if t.Certificate != nil {
+		state.Certificate = t.Certificate.Name
+	}
+
+	if t.pooled != nil {
+		state.PooledTunnel = t.pooled.Tunnel
+	}
+
+	if !t.ExpiresAt.IsZero() {
+		expiresAt := t.ExpiresAt.UTC()
+		state.ExpiresAt = &expiresAt
+	}
+
+	return state
+}
+
+// tunnelSource returns how the tunnel was created
+func tunnelSource(t *Tunnel) string {
+	switch {
+	case t.ContainerID != "":
+		return SourceContainer
+	case !t.ExpiresAt.IsZero():
+		return SourceAdHoc
+	default:
+		return SourceStatic
+	}
+}
+
+// ImportState re-establishes the state exported on another host and returns a report of each tunnel.
+// Paused hostnames stay paused and on-demand tunnels are started again until they expire. Tunnels of
+// containers and cloudflared configs start on their own once the containers run on this host, so they
+// are only checked for a certificate. It must be called from the event loop.
+func (h *Handler) ImportState(state *State, now time.Time) ([]string, error) {
+	if state == nil || state.Version != stateVersion {
+		return nil, fmt.Errorf("Unsupported state version, expected %d", stateVersion)
+	}
+
+	var report []string
+
+	if state.PoolName != "" && (pool == nil || pool.Name != state.PoolName) {
+		report = append(report, fmt.Sprintf("Pooled tunnels were named after %s, set HERA_POOL_NAME=%s to reuse them", state.PoolName, state.PoolName))
+	}
+
+	tunnels := append([]*TunnelState{}, state.Tunnels...)
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Hostname < tunnels[j].Hostname })
+
+	for _, tunnel := range tunnels {
+		report = append(report, fmt.Sprintf("%s: %s", tunnel.Hostname, h.importTunnel(tunnel, now)))
+	}
+
+	return report, nil
+}
+
+// importTunnel re-establishes a tunnel of an imported state and returns what was done
+func (h *Handler) importTunnel(tunnel *TunnelState, now time.Time) string {
+	if tunnel.Paused {
+		registry.SetPaused(tunnel.Hostname, true)
+	}
+
+	if _, err := getCertificate(tunnel.Hostname); err != nil {
+		return fmt.Sprintf("missing certificate %s, copy it to %s", tunnel.Certificate, CertificatePath)
+	}
+
+	if existing, err := registry.FindByHostname(tunnel.Hostname); err == nil {
+		if tunnel.Paused && !existing.Paused {
+			_, err := SetMaintenance(registry, tunnel.Hostname, true)
+			if err != nil {
+				return fmt.Sprintf("running, unable to pause: %s", err)
+			}
+			return "running, paused"
+		}
+
+		return "running"
+	}
+
+	switch tunnel.Source {
+	case SourceAdHoc:
+		if tunnel.ExpiresAt == nil || !tunnel.ExpiresAt.After(now) {
+			return "expired, not started"
+		}
+
+		request := AdHocRequest{
+			Hostname: tunnel.Hostname,
+			Origin:   tunnel.Origin,
+			Protocol: tunnel.Protocol,
+			TTL:      tunnel.ExpiresAt.Sub(now).Round(time.Second).String(),
+		}
+
+		_, err := h.StartAdHocTunnel(request)
+		if err != nil {
+			return fmt.Sprintf("unable to start: %s", err)
+		}
+
+		return "started until " + tunnel.ExpiresAt.Format(time.RFC3339)
+
+	case SourceStatic:
+		return "waiting for HERA_CLOUDFLARED_CONFIG to list it"
+
+	default:
+		return "waiting for its container to start"
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestExportState(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	container := newRegistryTunnel("app.site.tld", "5aa5a300dd0e")
+	container.Project = "shop"
+	container.Paused = true
+	container.Tags = map[string]string{"team": "web"}
+
+	adhoc := newRegistryTunnel("debug.site.tld", "")
+	adhoc.Config.IP = ""
+	adhoc.Config.OriginName = "debug.lan"
+	adhoc.Config.Port = "8080"
+	adhoc.ExpiresAt = now.Add(time.Hour)
+
+	state := ExportState([]*Tunnel{container, adhoc}, now)
+
+	encoded, _ := json.Marshal(state)
+	expected := `{"version":1,"exported_at":"2020-01-01T10:00:00Z","tunnels":[` +
+		`{"hostname":"app.site.tld","source":"container","project":"shop","origin":"172.23.0.4:80","certificate":"site.tld.pem","paused":true,"tags":{"team":"web"}},` +
+		`{"hostname":"debug.site.tld","source":"adhoc","origin":"debug.lan:8080","certificate":"site.tld.pem","expires_at":"2020-01-01T11:00:00Z"}]}`
+
+	if string(encoded) != expected {
+		t.Errorf("Unexpected state, got %s", encoded)
+	}
+}
+
+func TestImportState(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	registry = NewRegistry()
+	fs.Create("/certs/site.tld.pem")
+	defer func() { registry = NewRegistry() }()
+
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+
+	state := &State{
+		Version: stateVersion,
+		Tunnels: []*TunnelState{
+			{Hostname: "app.site.tld", Source: SourceContainer, Paused: true},
+			{Hostname: "old.site.tld", Source: SourceAdHoc, Origin: "10.0.0.5:8080", ExpiresAt: &expired},
+			{Hostname: "app.other.tld", Source: SourceContainer, Certificate: "other.tld.pem"},
+			{Hostname: "static.site.tld", Source: SourceStatic},
+		},
+	}
+
+	report, err := NewHandler(nil).ImportState(state, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"app.other.tld: missing certificate other.tld.pem, copy it to /certs",
+		"app.site.tld: waiting for its container to start",
+		"old.site.tld: expired, not started",
+		"static.site.tld: waiting for HERA_CLOUDFLARED_CONFIG to list it",
+	}
+	if strings.Join(report, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected report, got\n%s", strings.Join(report, "\n"))
+	}
+
+	if !registry.IsPaused("app.site.tld") {
+		t.Error("Expected the paused hostname to stay paused")
+	}
+
+	_, err = NewHandler(nil).ImportState(&State{Version: 2}, now)
+	if err == nil {
+		t.Error("Expected an error for an unsupported version")
+	}
+}
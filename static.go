@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// CloudflaredConfig is the subset of a cloudflared config file that describes where requests are routed
+type CloudflaredConfig struct {
+	Hostname string        `yaml:"hostname"`
+	URL      string        `yaml:"url"`
+	Ingress  []IngressRule `yaml:"ingress"`
+}
+
+// IngressRule routes requests for a hostname to a service
+type IngressRule struct {
+	Hostname string `yaml:"hostname"`
+	Service  string `yaml:"service"`
+}
+
+// LoadStaticTunnels parses the cloudflared config file at the given path and returns a tunnel for each
+// hostname it routes to a URL. Rules without a hostname, such as the catch-all rule, are skipped.
+func LoadStaticTunnels(path string) ([]*Tunnel, error) {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read cloudflared config: %s", err)
+	}
+
+	cloudflaredConfig := &CloudflaredConfig{}
+
+	err = yaml.Unmarshal(contents, cloudflaredConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse cloudflared config %s: %s", path, err)
+	}
+
+	rules := cloudflaredConfig.Ingress
+	if cloudflaredConfig.Hostname != "" {
+		rules = append(rules, IngressRule{Hostname: cloudflaredConfig.Hostname, Service: cloudflaredConfig.URL})
+	}
+
+	var tunnels []*Tunnel
+	for _, rule := range rules {
+		if rule.Hostname == "" {
+			continue
+		}
+
+		tunnel, err := newStaticTunnel(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		tunnels = append(tunnels, tunnel)
+	}
+
+	return tunnels, nil
+}
+
+// StartStaticTunnels starts a tunnel for each hostname of the cloudflared config file at the given path,
+// resolving origins that are declared by DNS name. Tunnels whose origin can't be resolved yet are registered
+// as degraded and started by WatchOrigins once it resolves.
+func StartStaticTunnels(handler *Handler, path string) error {
+	tunnels, err := LoadStaticTunnels(path)
+	if err != nil {
+		return err
+	}
+
+	for _, tunnel := range tunnels {
+		log.Infof("Adopting tunnel %s from %s", tunnel.Config.Hostname, path)
+
+		err := handler.resolveOrigin(tunnel.Config)
+		if err != nil {
+			reportError(NewError(ErrUnresolvableOrigin, err), "")
+
+			tunnel.State = TunnelDegraded
+			registry.Add(tunnel)
+			continue
+		}
+
+		err = tunnel.Start()
+		if err != nil {
+			reportError(err, "")
+		}
+	}
+
+	return nil
+}
+
+// WatchOrigins periodically resolves the origins of static tunnels that are declared by DNS name and
+// restarts the tunnels whose origin address changed, or starts them if their origin did not resolve before
+func WatchOrigins(handler *Handler, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		var tunnels []*Tunnel
+		eventLoop.Do(func() {
+			tunnels = registry.List()
+		})
+
+		for _, tunnel := range tunnels {
+			err := handler.refreshOrigin(tunnel)
+			if err != nil {
+				reportError(NewError(ErrUnresolvableOrigin, err), "")
+			}
+		}
+	}
+}
+
+// refreshOrigin resolves the origin of a static tunnel again and applies it on the event loop. The lookup
+// itself runs off the event loop so a slow resolver doesn't hold up Docker events.
+func (h *Handler) refreshOrigin(tunnel *Tunnel) error {
+	var previous TunnelConfig
+	eventLoop.Do(func() {
+		previous = *tunnel.Config
+	})
+
+	if previous.OriginName == "" {
+		return nil
+	}
+
+	updated := previous
+
+	err := h.resolveOrigin(&updated)
+	if err != nil {
+		return err
+	}
+
+	eventLoop.Do(func() {
+		err = applyOrigin(tunnel, &previous, &updated)
+	})
+
+	return err
+}
+
+// applyOrigin starts a static tunnel at its resolved origin if the address changed or did not resolve before,
+// unless the tunnel was replaced or its config changed since the origin was resolved
+func applyOrigin(tunnel *Tunnel, previous *TunnelConfig, updated *TunnelConfig) error {
+	current, err := registry.FindByHostname(tunnel.Config.Hostname)
+	if err != nil || current != tunnel || *tunnel.Config != *previous {
+		return nil
+	}
+
+	if updated.IP == previous.IP && updated.Port == previous.Port {
+		return nil
+	}
+
+	if previous.IP == "" {
+		log.Infof("Origin of %s resolved to %s:%s", tunnel.Config.Hostname, updated.IP, updated.Port)
+	} else {
+		log.Infof("Origin of %s changed from %s:%s to %s:%s", tunnel.Config.Hostname, previous.IP, previous.Port, updated.IP, updated.Port)
+	}
+	tunnel.Config = updated
+
+	return tunnel.Start()
+}
+
+// resolveOrigin sets the IP, and the port for SRV records, of a tunnel whose origin is declared by DNS name.
+// The current address is kept while the name still resolves to it, so tunnels are not restarted just
+// because the resolver returned the answers in a different order.
+func (h *Handler) resolveOrigin(tunnelConfig *TunnelConfig) error {
+	if tunnelConfig.OriginName == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ResolverTimeout)
+	defer cancel()
+
+	host := tunnelConfig.OriginName
+	port := tunnelConfig.Port
+
+	if tunnelConfig.OriginSRV {
+		_, records, err := h.Resolver.LookupSRV(ctx, "", "", host)
+		if err != nil {
+			return fmt.Errorf("Unable to look up SRV records for %s: %s", host, err)
+		}
+
+		if len(records) == 0 {
+			return fmt.Errorf("No SRV records found for %s", host)
+		}
+
+		// Keep the current target if one with the current port still resolves to the current IP
+		if tunnelConfig.IP != "" {
+			for _, record := range records {
+				if strconv.Itoa(int(record.Port)) != tunnelConfig.Port {
+					continue
+				}
+
+				addresses, err := h.Resolver.LookupHost(ctx, strings.TrimSuffix(record.Target, "."))
+				if err == nil && containsAddress(addresses, tunnelConfig.IP) {
+					return nil
+				}
+			}
+		}
+
+		// Records are sorted by priority and randomized by weight
+		host = strings.TrimSuffix(records[0].Target, ".")
+		port = strconv.Itoa(int(records[0].Port))
+	}
+
+	addresses, err := h.Resolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("Unable to resolve %s: %s", host, err)
+	}
+
+	if port == tunnelConfig.Port && containsAddress(addresses, tunnelConfig.IP) {
+		return nil
+	}
+
+	tunnelConfig.IP = addresses[0]
+	tunnelConfig.Port = port
+
+	return nil
+}
+
+// containsAddress returns whether the address is in the list
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newStaticTunnel returns a tunnel for an ingress rule. An error is returned if the service is not
+// an http or https URL, the hostname is not allowed, or a certificate cannot be found.
+// Services with an srv+http or srv+https scheme are routed to the target of the SRV record of their host.
+func newStaticTunnel(rule IngressRule) (*Tunnel, error) {
+	origin, err := url.Parse(rule.Service)
+	if err != nil || origin.Hostname() == "" {
+		return nil, fmt.Errorf("Unsupported service for %s: %s", rule.Hostname, rule.Service)
+	}
+
+	srv := strings.HasPrefix(origin.Scheme, "srv+")
+	protocol := strings.TrimPrefix(origin.Scheme, "srv+")
+	if protocol != "http" && protocol != "https" {
+		return nil, fmt.Errorf("Unsupported service for %s: %s", rule.Hostname, rule.Service)
+	}
+
+	port := origin.Port()
+	if port == "" {
+		port = "80"
+		if protocol == "https" {
+			port = "443"
+		}
+	}
+
+	err = checkHostname(rule.Hostname, config.DenyHostnames, config.AllowDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := getCertificate(rule.Hostname)
+	if err != nil {
+		return nil, NewError(ErrNoCertificate, err)
+	}
+
+	tunnelConfig := &TunnelConfig{
+		IP:       origin.Hostname(),
+		Hostname: rule.Hostname,
+		Port:     port,
+		Protocol: protocol,
+	}
+
+	if srv || net.ParseIP(origin.Hostname()) == nil {
+		tunnelConfig.IP = ""
+		tunnelConfig.OriginName = origin.Hostname()
+		tunnelConfig.OriginSRV = srv
+	}
+
+	return NewTunnel(tunnelConfig, cert), nil
+}
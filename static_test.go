@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLoadStaticTunnels(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte{}, 0644)
+	afero.WriteFile(fs, "/etc/cloudflared/config.yml", []byte(`
+tunnel: 6ff42ae2-765d-4adf-8112-31c55c1551ef
+ingress:
+  - hostname: app.example.com
+    service: http://192.168.1.10:8000
+  - hostname: nas.example.com
+    service: https://nas.local
+  - service: http_status:404
+`), 0644)
+
+	tunnels, err := LoadStaticTunnels("/etc/cloudflared/config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tunnels) != 2 {
+		t.Fatalf("Unexpected tunnel count, got %d", len(tunnels))
+	}
+
+	if tunnels[0].directURL() != "http://192.168.1.10:8000" || tunnels[0].ContainerID != "" {
+		t.Errorf("Unexpected tunnel for app.example.com, got %s", tunnels[0].directURL())
+	}
+
+	if tunnels[1].Config.OriginName != "nas.local" || tunnels[1].Config.IP != "" || tunnels[1].Config.Port != "443" {
+		t.Errorf("Expected nas.example.com to resolve nas.local, got %+v", tunnels[1].Config)
+	}
+}
+
+func TestNewStaticTunnelSRV(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte{}, 0644)
+
+	tunnel, err := newStaticTunnel(IngressRule{Hostname: "vm.example.com", Service: "srv+https://_web._tcp.example.lan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tunnel.Config.OriginSRV || tunnel.Config.OriginName != "_web._tcp.example.lan" || tunnel.Config.Protocol != "https" {
+		t.Errorf("Unexpected SRV origin, got %+v", tunnel.Config)
+	}
+}
+
+func TestResolveOrigin(t *testing.T) {
+	handler := &Handler{Resolver: net.DefaultResolver}
+	tunnelConfig := &TunnelConfig{OriginName: "localhost", Port: "80"}
+
+	err := handler.resolveOrigin(tunnelConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if net.ParseIP(tunnelConfig.IP) == nil || !net.ParseIP(tunnelConfig.IP).IsLoopback() {
+		t.Errorf("Unexpected IP for localhost, got %s", tunnelConfig.IP)
+	}
+
+	addresses, err := net.DefaultResolver.LookupHost(context.Background(), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := addresses[len(addresses)-1]
+	tunnelConfig = &TunnelConfig{OriginName: "localhost", IP: current, Port: "80"}
+
+	err = handler.resolveOrigin(tunnelConfig)
+	if err != nil || tunnelConfig.IP != current {
+		t.Errorf("Expected current address %s to be kept, got %s", current, tunnelConfig.IP)
+	}
+
+	tunnelConfig = &TunnelConfig{IP: "192.168.1.10", Port: "80"}
+
+	err = handler.resolveOrigin(tunnelConfig)
+	if err != nil || tunnelConfig.IP != "192.168.1.10" {
+		t.Errorf("Expected IP origin to be kept, got %s", tunnelConfig.IP)
+	}
+}
+
+func TestLoadStaticTunnelsLegacy(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte{}, 0644)
+	afero.WriteFile(fs, "/config.yml", []byte("hostname: example.com\nurl: http://localhost:8080\n"), 0644)
+
+	tunnels, err := LoadStaticTunnels("/config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tunnels) != 1 || tunnels[0].Config.Hostname != "example.com" {
+		t.Errorf("Unexpected tunnels, got %v", tunnels)
+	}
+}
+
+func TestLoadStaticTunnelsUnsupportedService(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/certs/example.com.pem", []byte{}, 0644)
+	afero.WriteFile(fs, "/config.yml", []byte("ingress:\n  - hostname: example.com\n    service: hello_world\n"), 0644)
+
+	_, err := LoadStaticTunnels("/config.yml")
+	if err == nil {
+		t.Error("Expected error for unsupported service")
+	}
+}
+
+func TestApplyOriginStartsUnresolvedTunnel(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	registry = NewRegistry()
+
+	started := false
+	tunnel := newRegistryTunnel("nas.example.com", "")
+	tunnel.Config.IP = ""
+	tunnel.Config.OriginName = "nas.local"
+	tunnel.State = TunnelDegraded
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			started = true
+			return []byte(""), nil
+		},
+	}
+	registry.Add(tunnel)
+
+	previous := *tunnel.Config
+	updated := previous
+	updated.IP = "192.168.1.20"
+
+	err := applyOrigin(tunnel, &previous, &updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !started || tunnel.State != TunnelActive || tunnel.Config.IP != "192.168.1.20" {
+		t.Errorf("Expected tunnel to be started at its resolved origin, got %s at %s", tunnel.State, tunnel.Config.IP)
+	}
+}
+
+func TestApplyOriginSkipsReplacedTunnel(t *testing.T) {
+	registry = NewRegistry()
+
+	tunnel := newRegistryTunnel("nas.example.com", "")
+	tunnel.Config.OriginName = "nas.local"
+	registry.Add(tunnel)
+	registry.Add(newRegistryTunnel("nas.example.com", "container-a"))
+
+	previous := *tunnel.Config
+	updated := previous
+	updated.IP = "192.168.1.20"
+
+	err := applyOrigin(tunnel, &previous, &updated)
+	if err != nil || tunnel.Config.IP != previous.IP {
+		t.Errorf("Expected replaced tunnel to be left alone, got %s", tunnel.Config.IP)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	statsTimeout = 2 * time.Second
+)
+
+// TunnelStats holds the traffic statistics of a tunnel as reported by its cloudflared metrics endpoint
+type TunnelStats struct {
+	Requests           float64            `json:"requests"`
+	ResponseCodes      map[string]float64 `json:"response_codes"`
+	ActiveConnections  float64            `json:"active_connections"`
+	ConcurrentRequests float64            `json:"concurrent_requests"`
+}
+
+// ScrapeStats requests the metrics endpoint at the given address and returns the parsed TunnelStats
+func ScrapeStats(address string) (*TunnelStats, error) {
+	if address == "" {
+		return nil, fmt.Errorf("No metrics address")
+	}
+
+	client := &http.Client{Timeout: statsTimeout}
+
+	resp, err := client.Get(fmt.Sprintf("http://%s/metrics", address))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected metrics response: %s", resp.Status)
+	}
+
+	return parseStats(resp.Body)
+}
+
+// reserveMetricsAddress returns a free local address for a cloudflared metrics endpoint
+func reserveMetricsAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
+
+// parseStats reads metrics in the Prometheus text format and returns the TunnelStats they contain
+func parseStats(r io.Reader) (*TunnelStats, error) {
+	stats := &TunnelStats{
+		ResponseCodes: make(map[string]float64),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			continue
+		}
+
+		switch name {
+		case "cloudflared_tunnel_total_requests":
+			stats.Requests += value
+		case "cloudflared_tunnel_response_by_code":
+			stats.ResponseCodes[labels["status_code"]] += value
+		case "cloudflared_tunnel_ha_connections":
+			stats.ActiveConnections += value
+		case "cloudflared_tunnel_concurrent_requests_per_tunnel":
+			stats.ConcurrentRequests += value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// parseSample parses a single Prometheus sample line into its name, labels, and value
+func parseSample(line string) (string, map[string]string, float64, error) {
+	labels := make(map[string]string)
+
+	separator := strings.LastIndex(line, " ")
+	if separator == -1 {
+		return "", nil, 0, fmt.Errorf("Invalid sample: %s", line)
+	}
+
+	value, err := strconv.ParseFloat(line[separator+1:], 64)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	name := strings.TrimSpace(line[:separator])
+	if start := strings.Index(name, "{"); start != -1 {
+		for _, pair := range strings.Split(strings.TrimSuffix(name[start+1:], "}"), ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			labels[strings.TrimSpace(parts[0])] = strings.Trim(parts[1], `"`)
+		}
+
+		name = name[:start]
+	}
+
+	return name, labels, value, nil
+}
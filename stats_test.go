@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const cloudflaredMetrics = `# HELP cloudflared_tunnel_total_requests Amount of requests proxied through all the tunnels
+# TYPE cloudflared_tunnel_total_requests counter
+cloudflared_tunnel_total_requests 42
+# HELP cloudflared_tunnel_response_by_code Count of responses by HTTP status code
+# TYPE cloudflared_tunnel_response_by_code counter
+cloudflared_tunnel_response_by_code{status_code="200"} 40
+cloudflared_tunnel_response_by_code{status_code="502"} 2
+# HELP cloudflared_tunnel_ha_connections Number of active ha connections
+# TYPE cloudflared_tunnel_ha_connections gauge
+cloudflared_tunnel_ha_connections 4
+cloudflared_tunnel_concurrent_requests_per_tunnel{connection_id="0"} 1
+cloudflared_tunnel_concurrent_requests_per_tunnel{connection_id="1"} 2
+`
+
+func TestParseStats(t *testing.T) {
+	stats, err := parseStats(strings.NewReader(cloudflaredMetrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Requests != 42 {
+		t.Errorf("Unexpected request count, got %v", stats.Requests)
+	}
+
+	if stats.ResponseCodes["200"] != 40 || stats.ResponseCodes["502"] != 2 {
+		t.Errorf("Unexpected response codes, got %v", stats.ResponseCodes)
+	}
+
+	if stats.ActiveConnections != 4 {
+		t.Errorf("Unexpected active connections, got %v", stats.ActiveConnections)
+	}
+
+	if stats.ConcurrentRequests != 3 {
+		t.Errorf("Unexpected concurrent requests, got %v", stats.ConcurrentRequests)
+	}
+}
+
+func TestScrapeStatsWithoutAddress(t *testing.T) {
+	_, err := ScrapeStats("")
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ANSI escape codes used to highlight the console summary
+const (
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiReset = "\033[0m"
+)
+
+// TunnelSummary counts the tunnels by state, along with the containers waiting to get a tunnel
+type TunnelSummary struct {
+	Active   int
+	Observed int
+	Paused   int
+	Pending  int
+	Failed   []string
+}
+
+// summarizeTunnels returns the summary of the tunnels and the number of pending containers
+func summarizeTunnels(tunnels []*Tunnel, pending int) TunnelSummary {
+	summary := TunnelSummary{Pending: pending}
+
+	for _, tunnel := range tunnels {
+		switch tunnel.State {
+		case TunnelDegraded:
+			summary.Failed = append(summary.Failed, tunnel.Config.Hostname)
+		case TunnelPaused:
+			summary.Paused++
+		case TunnelObserved:
+			summary.Observed++
+		default:
+			summary.Active++
+		}
+	}
+	sort.Strings(summary.Failed)
+
+	return summary
+}
+
+// Format returns the summary as a table of the counts by state, highlighting the active and failed
+// rows in color when color is set. Observed and paused tunnels are only listed if there are any.
+func (s TunnelSummary) Format(color bool) string {
+	var buf bytes.Buffer
+
+	table := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "STATE\tCOUNT")
+	fmt.Fprintf(table, "active\t%d\n", s.Active)
+
+	if s.Observed > 0 {
+		fmt.Fprintf(table, "observed\t%d\n", s.Observed)
+	}
+
+	if s.Paused > 0 {
+		fmt.Fprintf(table, "paused\t%d\n", s.Paused)
+	}
+
+	fmt.Fprintf(table, "pending\t%d\n", s.Pending)
+
+	if len(s.Failed) > 0 {
+		fmt.Fprintf(table, "failed\t%d (%s)\n", len(s.Failed), strings.Join(s.Failed, ", "))
+	} else {
+		fmt.Fprintf(table, "failed\t0\n")
+	}
+
+	table.Flush()
+
+	// Rows are colored after the table is laid out, since escape codes would count towards its widths
+	rows := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, row := range rows {
+		if color && strings.HasPrefix(row, "active ") {
+			rows[i] = ansiGreen + row + ansiReset
+		} else if color && strings.HasPrefix(row, "failed ") && len(s.Failed) > 0 {
+			rows[i] = ansiRed + row + ansiReset
+		}
+	}
+
+	return "Tunnels:\n" + strings.Join(rows, "\n")
+}
+
+// WatchSummary logs a summary of the tunnels every interval, for following Hera from a terminal
+func WatchSummary(registry *Registry, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		pending := len(pendingCertificates.List()) + len(pendingDependencies.List()) + startWaits.Count()
+		log.Info(summarizeTunnels(registry.List(), pending).Format(true))
+	}
+}
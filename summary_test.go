@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizeTunnels(t *testing.T) {
+	active := newRegistryTunnel("a.example.com", "5aa5a300dd0e")
+	active.State = TunnelActive
+	paused := newRegistryTunnel("b.example.com", "6bb6b411ee1f")
+	paused.State = TunnelPaused
+	degraded := newRegistryTunnel("c.example.com", "7cc7c522ff20")
+	degraded.State = TunnelDegraded
+
+	observed := newRegistryTunnel("d.example.com", "8dd8d633aa31")
+	observed.State = TunnelObserved
+
+	summary := summarizeTunnels([]*Tunnel{active, paused, degraded, observed}, 2)
+
+	if summary.Active != 1 || summary.Observed != 1 {
+		t.Errorf("Expected observed tunnels to be counted apart from active ones, got %+v", summary)
+	}
+
+	expected := "Tunnels:\n" +
+		"STATE     COUNT\n" +
+		"active    1\n" +
+		"observed  1\n" +
+		"paused    1\n" +
+		"pending   2\n" +
+		"failed    1 (c.example.com)"
+	if table := summary.Format(false); table != expected {
+		t.Errorf("Unexpected summary, got %q", table)
+	}
+
+	expected = "Tunnels:\n" +
+		"STATE    COUNT\n" +
+		"active   0\n" +
+		"pending  0\n" +
+		"failed   0"
+	if table := summarizeTunnels(nil, 0).Format(false); table != expected {
+		t.Errorf("Unexpected empty summary, got %q", table)
+	}
+
+	if table := summary.Format(true); !strings.Contains(table, ansiRed+"failed    1 (c.example.com)"+ansiReset) {
+		t.Errorf("Expected failed tunnels in red, got %q", table)
+	}
+}
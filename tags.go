@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const heraTagPrefix = "hera.tag."
+
+// parseTags returns the hera.tag.* labels of a container by tag name, such as team for hera.tag.team,
+// or nil if it has none
+func parseTags(container types.ContainerJSON) map[string]string {
+	if container.Config == nil {
+		return nil
+	}
+
+	var tags map[string]string
+	for name, value := range container.Config.Labels {
+		tag := strings.TrimPrefix(name, heraTagPrefix)
+		if tag == name || tag == "" {
+			continue
+		}
+
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[tag] = value
+	}
+
+	return tags
+}
+
+// tagMetricLabel returns the metric label of a tag, replacing the characters metric label names
+// may not contain
+func tagMetricLabel(tag string) string {
+	label := []byte("tag_" + tag)
+	for i, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			label[i] = '_'
+		}
+	}
+
+	return string(label)
+}
+
+// metricLabels returns the labels of the tunnel's metrics, which are its hostname and its tags
+func (t *Tunnel) metricLabels() map[string]string {
+	labels := map[string]string{"hostname": t.Config.Hostname}
+	for tag, value := range t.Tags {
+		labels[tagMetricLabel(tag)] = value
+	}
+
+	return labels
+}
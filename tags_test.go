@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	container := newTenantContainer(map[string]string{
+		heraHostname:           "site.tld",
+		"hera.tag.team":        "payments",
+		"hera.tag.cost-center": "42",
+		"hera.tag.":            "ignored",
+	})
+
+	tags := parseTags(container)
+	if !reflect.DeepEqual(tags, map[string]string{"team": "payments", "cost-center": "42"}) {
+		t.Errorf("Unexpected tags, got %v", tags)
+	}
+
+	if tags := parseTags(newTenantContainer(map[string]string{heraHostname: "site.tld"})); tags != nil {
+		t.Errorf("Expected no tags, got %v", tags)
+	}
+
+	warnings := checkLabels(container)
+	if !reflect.DeepEqual(warnings.Unknown, []string{"hera.tag."}) {
+		t.Errorf("Unexpected unknown labels, got %v", warnings.Unknown)
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	tunnel := newTunnel()
+	tunnel.Tags = map[string]string{"team": "payments", "cost-center": "42"}
+
+	labels := tunnel.metricLabels()
+	expected := map[string]string{"hostname": "site.tld", "tag_team": "payments", "tag_cost_center": "42"}
+
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Unexpected metric labels, got %v", labels)
+	}
+}
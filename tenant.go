@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	composeProject = "com.docker.compose.project"
+)
+
+// parseTenants parses a tenant mapping of the form "tenant=value,value;tenant=value", such as the
+// certificate domains or the Docker networks of each tenant
+func parseTenants(value string) map[string][]string {
+	tenants := make(map[string][]string)
+
+	for _, entry := range strings.Split(value, ";") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+
+		tenant := strings.TrimSpace(parts[0])
+		tenants[tenant] = append(tenants[tenant], splitList(parts[1])...)
+	}
+
+	return tenants
+}
+
+// getTenant returns the tenant whose networks the container is attached to. The tenant is set by the
+// operator rather than by a label, so a container can't claim the certificates of another tenant. No tenant
+// is returned if the container is attached to the networks of none or of several tenants.
+func getTenant(container types.ContainerJSON, networks map[string][]string) string {
+	if container.NetworkSettings == nil {
+		return ""
+	}
+
+	tenant := ""
+	for name, names := range networks {
+		for _, network := range names {
+			if _, ok := container.NetworkSettings.Networks[network]; !ok {
+				continue
+			}
+
+			if tenant != "" && tenant != name {
+				return ""
+			}
+			tenant = name
+		}
+	}
+
+	return tenant
+}
+
+// checkTenant returns an error if tenants are configured and the container's tenant may not use the
+// certificate. Rejections are recorded in the audit log.
+func checkTenant(container types.ContainerJSON, hostname string, cert *Certificate, tenants map[string][]string, networks map[string][]string) error {
+	if len(tenants) == 0 {
+		return nil
+	}
+
+	tenant := getTenant(container, networks)
+	domain := strings.TrimSuffix(cert.Name, ".pem")
+
+	var reason string
+	domains, ok := tenants[tenant]
+	if !ok {
+		reason = "container does not belong to a configured tenant"
+	} else if !containsDomain(domains, domain) {
+		reason = fmt.Sprintf("tenant may not use the certificate for %s", domain)
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	bus.Publish(&BusEvent{
+		Kind:        EventHostnameRejected,
+		ContainerID: container.ID,
+		Tenant:      tenant,
+		Tags:        parseTags(container),
+		Hostname:    hostname,
+		Message:     reason,
+	})
+
+	return NewError(ErrTenantNotAllowed, fmt.Errorf("Tunnel %s rejected: %s", hostname, reason))
+}
+
+// containsDomain returns true if the domain or one of its parent domains is in the list
+func containsDomain(list []string, domain string) bool {
+	for _, item := range list {
+		if domain == item || strings.HasSuffix(domain, "."+item) {
+			return true
+		}
+	}
+
+	return false
+}
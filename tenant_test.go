@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/spf13/afero"
+)
+
+func newTenantContainer(labels map[string]string) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "5aa5a300dd0e5aa5a300dd0e"},
+		Config:            &container.Config{Labels: labels},
+	}
+}
+
+func TestParseTenants(t *testing.T) {
+	tenants := parseTenants("shop=a.example.com, b.example.com; blog=c.example.com;invalid")
+
+	if len(tenants) != 2 {
+		t.Fatalf("Unexpected tenant count, got %d", len(tenants))
+	}
+
+	if len(tenants["shop"]) != 2 || tenants["shop"][1] != "b.example.com" {
+		t.Errorf("Unexpected domains for shop, got %v", tenants["shop"])
+	}
+}
+
+func TestGetTenant(t *testing.T) {
+	networks := parseTenants("shop=shop_default,shop_internal;blog=blog_default")
+
+	container := newContainerWithNetworks(map[string]string{"shop_internal": "172.20.0.5", "bridge": "172.17.0.2"})
+	if getTenant(container, networks) != "shop" {
+		t.Errorf("Expected tenant of the network, got %s", getTenant(container, networks))
+	}
+
+	container = newContainerWithNetworks(map[string]string{"shop_default": "172.20.0.5", "blog_default": "172.21.0.5"})
+	if getTenant(container, networks) != "" {
+		t.Errorf("Expected no tenant for networks of several tenants, got %s", getTenant(container, networks))
+	}
+
+	container = newTenantContainer(map[string]string{composeProject: "shop", "hera.tenant": "shop"})
+	if getTenant(container, networks) != "" {
+		t.Errorf("Expected labels to be ignored, got %s", getTenant(container, networks))
+	}
+}
+
+func TestCheckTenant(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tenants := parseTenants("shop=a.example.com")
+	networks := parseTenants("shop=shop_default")
+	cert := NewCertificate("a.example.com.pem", fs)
+	other := NewCertificate("c.example.com.pem", fs)
+
+	if err := checkTenant(newTenantContainer(nil), "x.c.example.com", other, nil, nil); err != nil {
+		t.Errorf("Expected no check without tenants, got %s", err)
+	}
+
+	shop := newContainerWithNetworks(map[string]string{"shop_default": "172.20.0.5"})
+	shop.Config = &container.Config{}
+	if err := checkTenant(shop, "www.a.example.com", cert, tenants, networks); err != nil {
+		t.Errorf("Expected tenant to be allowed, got %s", err)
+	}
+
+	err := checkTenant(shop, "www.c.example.com", other, tenants, networks)
+	if err == nil || KindOf(err) != ErrTenantNotAllowed {
+		t.Errorf("Expected tenant to be rejected, got %v", err)
+	}
+
+	err = checkTenant(newTenantContainer(map[string]string{composeProject: "shop"}), "www.a.example.com", cert, tenants, networks)
+	if err == nil {
+		t.Error("Expected container outside the tenant networks to be rejected")
+	}
+
+	contents, _ := afero.ReadFile(fs, auditLog.Path)
+	if strings.Count(string(contents), "tunnel_rejected") != 2 {
+		t.Errorf("Expected rejections in audit log, got:\n%s", contents)
+	}
+}
+
+func TestContainsDomain(t *testing.T) {
+	domains := []string{"example.com"}
+
+	if !containsDomain(domains, "example.com") || !containsDomain(domains, "app.example.com") {
+		t.Error("Expected domain and its subdomains to be contained")
+	}
+
+	if containsDomain(domains, "badexample.com") {
+		t.Error("Expected unrelated domain not to be contained")
+	}
+}
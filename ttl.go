@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	expiryInterval = 10 * time.Second
+)
+
+// getExpiry returns when the tunnel of the container expires according to its hera.ttl label, or the
+// configured default TTL. The TTL counts from when the container started, so restarting Hera or the
+// tunnel does not extend it. A zero time is returned if the tunnel does not expire.
+func getExpiry(container types.ContainerJSON, defaultTTL time.Duration) (time.Time, error) {
+	ttl := defaultTTL
+
+	if value := getLabel(heraTTL, container); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return time.Time{}, fmt.Errorf("Invalid TTL for %s: %s", heraTTL, value)
+		}
+
+		ttl = parsed
+	}
+
+	if ttl == 0 {
+		return time.Time{}, nil
+	}
+
+	started := time.Now()
+	if container.ContainerJSONBase != nil && container.State != nil {
+		if parsed, err := time.Parse(time.RFC3339Nano, container.State.StartedAt); err == nil {
+			started = parsed
+		}
+	}
+
+	return started.Add(ttl), nil
+}
+
+// isExpired returns whether the expiry has passed
+func isExpired(expiresAt time.Time, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// WatchExpiry periodically stops and removes the tunnels whose TTL has passed, on the event loop so
+// they don't race with the events of their containers
+func WatchExpiry(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		eventLoop.Do(func() {
+			expireTunnels(time.Now())
+		})
+	}
+}
+
+// expireTunnels stops and removes the tunnels whose TTL has passed
+func expireTunnels(now time.Time) {
+	for _, tunnel := range registry.List() {
+		if !isExpired(tunnel.ExpiresAt, now) {
+			continue
+		}
+
+		log.Infof("Tunnel %s has expired", tunnel.Config.Hostname)
+
+		_, err := tunnel.Stop()
+		if err != nil {
+			reportError(err, tunnel.ContainerID)
+			continue
+		}
+
+		registry.Remove(tunnel)
+	}
+}
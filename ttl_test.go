@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func newTTLContainer(labels map[string]string, startedAt string) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "5aa5a300dd0e5aa5a300dd0e",
+			State: &types.ContainerState{Running: true, StartedAt: startedAt},
+		},
+		Config: &container.Config{Labels: labels},
+	}
+}
+
+func TestGetExpiry(t *testing.T) {
+	container := newTTLContainer(map[string]string{heraTTL: "2h"}, "2020-01-01T10:00:00Z")
+
+	expiresAt, err := getExpiry(container, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !expiresAt.Equal(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected expiry, got %s", expiresAt)
+	}
+
+	container = newTTLContainer(nil, "2020-01-01T10:00:00Z")
+
+	expiresAt, err = getExpiry(container, time.Hour)
+	if err != nil || !expiresAt.Equal(time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected default TTL to apply, got %s", expiresAt)
+	}
+
+	expiresAt, err = getExpiry(container, 0)
+	if err != nil || !expiresAt.IsZero() {
+		t.Errorf("Expected no expiry, got %s", expiresAt)
+	}
+
+	_, err = getExpiry(newTTLContainer(map[string]string{heraTTL: "soon"}, ""), 0)
+	if err == nil {
+		t.Error("Expected error for invalid TTL")
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Now()
+
+	if isExpired(time.Time{}, now) {
+		t.Error("Expected zero expiry to never expire")
+	}
+
+	if isExpired(now.Add(time.Minute), now) {
+		t.Error("Expected future expiry not to have expired")
+	}
+
+	if !isExpired(now.Add(-time.Minute), now) {
+		t.Error("Expected past expiry to have expired")
+	}
+}
+
+func TestExpireTunnels(t *testing.T) {
+	registry = NewRegistry()
+	now := time.Now()
+
+	expired := newRegistryTunnel("expired.example.com", "5aa5a300dd0e")
+	expired.ExpiresAt = now.Add(-time.Minute)
+	expired.Service.Commander = &MockCommander{mockRun: func() ([]byte, error) { return []byte(""), nil }}
+	registry.Add(expired)
+
+	current := newRegistryTunnel("current.example.com", "6bb6b411ee1f")
+	current.ExpiresAt = now.Add(time.Minute)
+	registry.Add(current)
+
+	expireTunnels(now)
+
+	if _, err := registry.FindByHostname("expired.example.com"); err == nil {
+		t.Error("Expected the expired tunnel to be removed")
+	}
+
+	if _, err := registry.FindByHostname("current.example.com"); err != nil {
+		t.Error("Expected the current tunnel to be kept")
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/afero"
 )
 
-var (
-	registry = make(map[string]*Tunnel)
+const (
+	TunnelActive   = "active"
+	TunnelDegraded = "degraded"
+	TunnelPaused   = "paused"
+	TunnelObserved = "observed"
 )
 
 // Tunnel holds the corresponding config, certificate, and service for a tunnel
@@ -17,6 +22,59 @@ type Tunnel struct {
 	Config      *TunnelConfig
 	Certificate *Certificate
 	Service     *Service
+	ContainerID string
+	OriginID    string
+	Project     string
+	State       string
+	Paused      bool
+
+	// Announce is set when the tunnel's state changes are written to the logs of its container
+	Announce bool
+
+	// Tags are the hera.tag.* labels of the container, carried to the API, metrics, audit log, and notifications
+	Tags map[string]string
+
+	// Balancer splits requests between weighted containers when set
+	Balancer *Balancer
+
+	// MetricsAddress is the local address of the cloudflared metrics endpoint
+	MetricsAddress string
+
+	// Drifted is set when the running config no longer matches the desired config
+	Drifted bool
+
+	// Latency holds the duration of each phase of the most recent start
+	Latency *StartLatency
+
+	// ExpiresAt is when the tunnel is torn down, or zero if it does not expire
+	ExpiresAt time.Time
+
+	// Effective holds the resolved settings of a container's tunnel and where they came from
+	Effective EffectiveConfig
+
+	// protocolDetected is set when the protocol was detected by probing the origin
+	protocolDetected bool
+
+	// SmokeTest is the request that verifies the tunnel through its public hostname once it is up
+	SmokeTest SmokeTest
+
+	// smoke holds the result of the most recent smoke test
+	smoke   *SmokeResult
+	smokeMu sync.Mutex
+
+	// pooled is the connector of the warm-standby pool serving the tunnel, or nil if it runs its own cloudflared
+	pooled *PoolMember
+
+	// process holds the most recent sample of the cloudflared process
+	process   *ProcessStats
+	processMu sync.Mutex
+
+	mu      sync.Mutex
+	stopped bool
+
+	// managedAt is when Hera last started, restarted, or stopped the cloudflared process, so the
+	// process changes it causes are not reported as crashes
+	managedAt time.Time
 }
 
 // TunnelConfig holds the necessary configuration for a tunnel
@@ -25,11 +83,39 @@ type TunnelConfig struct {
 	Hostname string
 	Port     string
 	Protocol string
+	LogLevel string
+	LogFile  string
+
+	// KeepAlive tunes the connection pool to the origin
+	KeepAlive KeepAlive
+
+	// Redirect sends requests to another URL instead of an origin when its target is set
+	Redirect Redirect
+
+	// StaticDir is a directory inside the Hera container served instead of an origin when it is set
+	StaticDir string
+
+	// GracePeriod is how long cloudflared waits for in-flight requests when it is stopped
+	GracePeriod time.Duration
+
+	// Args are the extra cloudflared arguments from hera.cloudflared-args, quoted for the run file
+	Args string
+
+	// OriginName is the DNS name the IP of a static tunnel is resolved from, either by address
+	// or by SRV record when OriginSRV is set
+	OriginName string
+	OriginSRV  bool
+}
+
+// isLocal returns whether the tunnel is served by Hera itself rather than by an origin container
+func (c *TunnelConfig) isLocal() bool {
+	return c.Redirect.Target != "" || c.StaticDir != ""
 }
 
 // NewTunnel returns a Tunnel with its corresponding config and certificate
 func NewTunnel(config *TunnelConfig, certificate *Certificate) *Tunnel {
 	service := NewService(config.Hostname)
+	service.GracePeriod = config.GracePeriod
 
 	tunnel := &Tunnel{
 		Config:      config,
@@ -40,47 +126,289 @@ func NewTunnel(config *TunnelConfig, certificate *Certificate) *Tunnel {
 	return tunnel
 }
 
-// GetTunnelForHost returns the tunnel for a given hostname.
-// An error is returned if a tunnel is not found.
-func GetTunnelForHost(hostname string) (*Tunnel, error) {
-	tunnel, ok := registry[hostname]
+// Name returns the name of the tunnel, which is also the name of its service
+func (t *Tunnel) Name() string {
+	return t.Service.Hostname
+}
+
+// Stats returns the traffic statistics reported by the tunnel's cloudflared process
+func (t *Tunnel) Stats() (*TunnelStats, error) {
+	return ScrapeStats(t.MetricsAddress)
+}
 
-	if !ok {
-		return nil, fmt.Errorf("No tunnel exists for %s", hostname)
+// Start starts a tunnel. Errors are categorized as ErrCloudflaredStart.
+func (t *Tunnel) Start() error {
+	err := t.start()
+	if err != nil {
+		t.publish(EventTunnelFailed, err.Error())
+		return NewError(ErrCloudflaredStart, err)
 	}
 
-	return tunnel, nil
+	t.publish(EventTunnelStarted, "")
+
+	return nil
 }
 
-// Start starts a tunnel
-func (t *Tunnel) Start() error {
-	err := t.prepareService()
+// start prepares and starts the tunnel service and registers the tunnel
+func (t *Tunnel) start() error {
+	// Tunnels that are restarted or weren't created from a start event only measure the later phases
+	if t.Latency == nil || t.Latency.isObserved() {
+		t.Latency = NewStartLatency()
+	}
+
+	err := checkTunnelLimit(t.Config.Hostname, config.MaxTunnels)
 	if err != nil {
 		return err
 	}
 
+	if config.IsObserving() {
+		t.observe()
+		return nil
+	}
+
+	t.Paused = registry.IsPaused(t.Config.Hostname)
+
+	pooled := false
+	if pool != nil && t.Balancer == nil {
+		pooled, err = t.startPooled()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !pooled {
+		err = t.spawn()
+		if err != nil {
+			return err
+		}
+	}
+
+	t.Latency.Mark("spawn")
+	go t.waitForEdge(t.Latency, t.MetricsAddress)
+
+	t.State = TunnelActive
+	if t.Paused {
+		t.State = TunnelPaused
+	}
+	t.Drifted = false
+	registry.Add(t)
+
+	return nil
+}
+
+// spawn starts a cloudflared process for the tunnel
+func (t *Tunnel) spawn() error {
+	address, err := reserveMetricsAddress()
+	if err != nil {
+		return err
+	}
+	t.MetricsAddress = address
+
+	err = t.prepareService()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	err = t.startService()
 	if err != nil {
 		return err
 	}
+	t.stopped = false
+	t.managedAt = time.Now()
 
-	registry[t.Config.Hostname] = t
+	return nil
+}
+
+// observe registers the tunnel without starting cloudflared, so it is reported as a tunnel Hera would manage
+func (t *Tunnel) observe() {
+	log.Infof("Observing tunnel %s without starting cloudflared", t.Config.Hostname)
+
+	t.mu.Lock()
+	t.stopped = false
+	t.mu.Unlock()
+
+	t.State = TunnelObserved
+	t.Paused = registry.IsPaused(t.Config.Hostname)
+	registry.Add(t)
+}
+
+// checkTunnelLimit returns an error if starting a tunnel for the hostname would run more than limit
+// cloudflared processes. Restarting a registered hostname does not count against the limit.
+func checkTunnelLimit(hostname string, limit int) error {
+	if limit == 0 {
+		return nil
+	}
+
+	running := 0
+	for _, tunnel := range registry.List() {
+		if tunnel.Config.Hostname != hostname && tunnel.State != TunnelDegraded {
+			running++
+		}
+	}
+
+	if running >= limit {
+		return fmt.Errorf("Unable to start tunnel %s: the limit of %d tunnels has been reached", hostname, limit)
+	}
 
 	return nil
 }
 
-// Stop stops a tunnel
-func (t *Tunnel) Stop() error {
+// publish publishes an event about the tunnel on the bus
+func (t *Tunnel) publish(kind EventKind, message string) {
+	bus.Publish(&BusEvent{Kind: kind, Hostname: t.Config.Hostname, ContainerID: t.ContainerID, Tags: t.Tags, Message: message})
+}
+
+// IsOwnedBy returns a bool to indicate if the tunnel was created for the container with the given ID
+func (t *Tunnel) IsOwnedBy(id string) bool {
+	return t.ContainerID == "" || t.ContainerID == id
+}
+
+// Stop stops a tunnel and returns whether it was running. Stop is safe to call concurrently and
+// more than once, such as for a die event and the reconciler, and only stops the process once.
+func (t *Tunnel) Stop() (bool, error) {
+	stopped, err := t.stop()
+	if stopped {
+		t.publish(EventTunnelStopped, "")
+	}
+
+	return stopped, err
+}
+
+// stop stops the tunnel process if it is running and returns whether it was
+func (t *Tunnel) stop() (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return false, nil
+	}
+
 	log.Infof("Stopping tunnel %s", t.Config.Hostname)
 
-	err := t.Service.Stop()
+	switch {
+	// Pooled connectors are returned to the pool instead of being stopped
+	case t.pooled != nil:
+		err := pool.Release(t.pooled)
+		if err != nil {
+			return false, err
+		}
+		t.pooled = nil
+
+	// Observed tunnels have no cloudflared process to stop
+	case !config.IsObserving():
+		err := t.Service.Stop()
+		if err != nil {
+			return false, err
+		}
+	}
+	t.stopped = true
+	t.managedAt = time.Now()
+
+	return true, nil
+}
+
+// Degrade stops the tunnel process but keeps the tunnel registered so it can be started again
+// once its origin becomes reachable
+func (t *Tunnel) Degrade() error {
+	_, err := t.stop()
+	if err != nil {
+		return err
+	}
+
+	t.State = TunnelDegraded
+	t.publish(EventTunnelDegraded, "its origin has no usable network")
+
+	return nil
+}
+
+// SetPaused switches the tunnel between proxying to its origin and serving the maintenance response,
+// and restarts the tunnel process with the new config
+func (t *Tunnel) SetPaused(paused bool) error {
+	if config.IsObserving() {
+		return fmt.Errorf("Unable to pause tunnel %s: Hera is observing and does not run cloudflared", t.Config.Hostname)
+	}
+
+	t.Paused = paused
+
+	// Pooled tunnels have no config file, their connector is reconfigured on restart
+	if t.pooled == nil {
+		err := t.writeConfigFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := t.Restart()
+	if err != nil {
+		return err
+	}
+
+	t.State = TunnelActive
+	if paused {
+		t.State = TunnelPaused
+	}
+
+	return nil
+}
+
+// Restart restarts the tunnel process with its current config file, such as to load a replaced certificate
+func (t *Tunnel) Restart() error {
+	if config.IsObserving() {
+		return nil
+	}
+
+	if t.pooled != nil {
+		origin, err := t.originURL()
+		if err != nil {
+			return err
+		}
+
+		return pool.Route(t.pooled, origin)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.Service.Restart()
 	if err != nil {
 		return err
 	}
+	t.stopped = false
+	t.managedAt = time.Now()
 
 	return nil
 }
 
+// originURL returns the URL cloudflared proxies requests to, which is the maintenance server when paused
+// or the balancer of a weighted hostname
+func (t *Tunnel) originURL() (string, error) {
+	if t.Paused {
+		return maintenance.URL()
+	}
+
+	if t.Config.Redirect.Target != "" {
+		return redirects.URL()
+	}
+
+	if t.Config.StaticDir != "" {
+		return sites.URL()
+	}
+
+	if t.Balancer != nil {
+		return t.Balancer.URL(), nil
+	}
+
+	return t.directURL(), nil
+}
+
+// directURL returns the URL of the tunnel's origin
+func (t *Tunnel) directURL() string {
+	return fmt.Sprintf("%s://%s:%s", t.Config.Protocol, t.Config.IP, t.Config.Port)
+}
+
 // prepareService creates the service and necessary files for the tunnel service
 func (t *Tunnel) prepareService() error {
 	err := t.Service.Create()
@@ -98,6 +426,11 @@ func (t *Tunnel) prepareService() error {
 		return err
 	}
 
+	err = t.writeFinishFile()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -144,32 +477,88 @@ func (t *Tunnel) startService() error {
 
 // writeConfigFile creates the config file for a tunnel
 func (t *Tunnel) writeConfigFile() error {
+	contents, err := t.configFileContents()
+	if err != nil {
+		return err
+	}
+
+	err = afero.WriteFile(fs, t.Service.ConfigFilePath(), []byte(contents), 0644)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configFileContents returns the contents of the config file for a tunnel
+func (t *Tunnel) configFileContents() (string, error) {
 	configLines := []string{
 		"hostname: %s",
-		"url: %s://%s:%s",
+		"url: %s",
 		"logfile: %s",
 		"origincert: %s",
+		"metrics: %s",
 		"no-autoupdate: true",
 		"no-tls-verify: true",
 	}
 
-	contents := fmt.Sprintf(strings.Join(configLines[:], "\n"), t.Config.Hostname, t.Config.Protocol, t.Config.IP, t.Config.Port, t.Service.LogFilePath(), t.Certificate.FullPath())
+	url, err := t.originURL()
+	if err != nil {
+		return "", err
+	}
 
-	err := afero.WriteFile(fs, t.Service.ConfigFilePath(), []byte(contents), 0644)
+	logFile := t.Service.LogFilePath()
+	if t.Config.LogFile != "" {
+		logFile = t.Config.LogFile
+	}
+
+	contents := fmt.Sprintf(strings.Join(configLines[:], "\n"), t.Config.Hostname, url, logFile, t.Certificate.FullPath(), t.MetricsAddress)
+
+	if t.Config.LogLevel != "" {
+		contents += fmt.Sprintf("\nloglevel: %s", t.Config.LogLevel)
+	}
+
+	for _, line := range t.Config.KeepAlive.configLines() {
+		contents += "\n" + line
+	}
+
+	if t.Config.GracePeriod > 0 {
+		contents += fmt.Sprintf("\ngrace-period: %s", t.Config.GracePeriod)
+	}
+
+	return contents, nil
+}
+
+// hasConfigDrifted returns whether the config file of the tunnel differs from the config it was started with
+func (t *Tunnel) hasConfigDrifted() (bool, error) {
+	// Pooled tunnels are configured through the Cloudflare API instead of a config file
+	if t.pooled != nil {
+		return false, nil
+	}
+
+	expected, err := t.configFileContents()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	actual, err := afero.ReadFile(fs, t.Service.ConfigFilePath())
+	if err != nil {
+		return true, nil
+	}
+
+	return string(actual) != expected, nil
 }
 
 // writeRunFile creates the run file for a tunnel
 func (t *Tunnel) writeRunFile() error {
-	runLines := []string{
-		"#!/bin/sh",
-		"exec cloudflared --config %s",
+	runLines := []string{"#!/bin/sh"}
+	runLines = append(runLines, proxyExports()...)
+	runLines = append(runLines, fmt.Sprintf("exec cloudflared --config %s", t.Service.ConfigFilePath()))
+	contents := strings.Join(runLines, "\n")
+
+	if t.Config.Args != "" {
+		contents += " " + t.Config.Args
 	}
-	contents := fmt.Sprintf(strings.Join(runLines[:], "\n"), t.Service.ConfigFilePath())
 
 	err := afero.WriteFile(fs, t.Service.RunFilePath(), []byte(contents), os.ModePerm)
 	if err != nil {
@@ -178,3 +567,11 @@ func (t *Tunnel) writeRunFile() error {
 
 	return nil
 }
+
+// writeFinishFile creates the finish command for a tunnel, which s6 runs with the exit code of the
+// process each time it exits
+func (t *Tunnel) writeFinishFile() error {
+	contents := fmt.Sprintf("#!/bin/sh\necho \"$1\" > %s", t.Service.ExitFilePath())
+
+	return afero.WriteFile(fs, t.Service.FinishFilePath(), []byte(contents), os.ModePerm)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
     "github.com/spf13/afero"
 )
@@ -54,3 +57,181 @@ func TestWriteRunFile(t *testing.T) {
 		t.Error("Expected run to exist")
 	}
 }
+
+func TestWriteRunFileWithArgs(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tunnel := newTunnel()
+	tunnel.Config.Args = "'--grace-period' '45s'"
+
+	err := tunnel.writeRunFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _ := afero.ReadFile(fs, tunnel.Service.RunFilePath())
+	if !strings.HasSuffix(string(contents), "--config /var/run/s6/services/site.tld/config.yml '--grace-period' '45s'") {
+		t.Errorf("Unexpected run file, got %s", contents)
+	}
+}
+
+func TestIsOwnedBy(t *testing.T) {
+	tunnel := newTunnel()
+	tunnel.ContainerID = "container-b"
+
+	if tunnel.IsOwnedBy("container-a") {
+		t.Error("Expected tunnel to not be owned by container-a")
+	}
+
+	if !tunnel.IsOwnedBy("container-b") {
+		t.Error("Expected tunnel to be owned by container-b")
+	}
+}
+
+func TestWriteConfigFileLogging(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	tunnel := newTunnel()
+	tunnel.Config.LogLevel = "debug"
+	tunnel.Config.LogFile = "/var/log/hera/debug.log"
+
+	err := tunnel.writeConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, _ := afero.ReadFile(fs, tunnel.Service.ConfigFilePath())
+	for _, line := range []string{"loglevel: debug", "logfile: /var/log/hera/debug.log"} {
+		if !strings.Contains(string(contents), line) {
+			t.Errorf("Expected config to contain %s", line)
+		}
+	}
+}
+
+func TestCheckTunnelLimit(t *testing.T) {
+	registry = NewRegistry()
+	registry.Add(newRegistryTunnel("a.tld", "container-a"))
+
+	degraded := newRegistryTunnel("b.tld", "container-b")
+	degraded.State = TunnelDegraded
+	registry.Add(degraded)
+
+	if err := checkTunnelLimit("c.tld", 0); err != nil {
+		t.Errorf("Expected no limit, got %s", err)
+	}
+
+	if err := checkTunnelLimit("a.tld", 1); err != nil {
+		t.Errorf("Expected restarting a tunnel to be allowed, got %s", err)
+	}
+
+	if err := checkTunnelLimit("c.tld", 2); err != nil {
+		t.Errorf("Expected degraded tunnels not to count, got %s", err)
+	}
+
+	if err := checkTunnelLimit("c.tld", 1); err == nil {
+		t.Error("Expected limit to be reached")
+	}
+}
+
+func TestStopIsIdempotent(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls++
+			return []byte(""), nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan bool, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			stopped, err := tunnel.Stop()
+			if err != nil {
+				t.Error(err)
+			}
+			results <- stopped
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	stops := 0
+	for stopped := range results {
+		if stopped {
+			stops++
+		}
+	}
+
+	if stops != 1 {
+		t.Errorf("Expected the tunnel to be stopped once, got %d", stops)
+	}
+
+	// stop and wait until down
+	if calls != 2 {
+		t.Errorf("Unexpected command count, got %d", calls)
+	}
+}
+
+func TestConfigFileGracePeriod(t *testing.T) {
+	tunnel := newTunnel()
+	tunnel.Config.GracePeriod = 45 * time.Second
+
+	contents, err := tunnel.configFileContents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(contents, "\ngrace-period: 45s") {
+		t.Errorf("Expected the grace period in the config file, got %s", contents)
+	}
+}
+
+func TestObserveMode(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	registry = NewRegistry()
+	config.Mode = ModeObserve
+	defer func() { config.Mode = ModeManage }()
+
+	calls := 0
+	tunnel := newTunnel()
+	tunnel.Service.Commander = &MockCommander{
+		mockRun: func() ([]byte, error) {
+			calls++
+			return []byte(""), nil
+		},
+	}
+
+	err := tunnel.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tunnel.State != TunnelObserved {
+		t.Errorf("Unexpected state, got %s", tunnel.State)
+	}
+
+	if _, err := registry.FindByHostname("site.tld"); err != nil {
+		t.Error("Expected observed tunnel to be registered")
+	}
+
+	stopped, err := tunnel.Stop()
+	if err != nil || !stopped {
+		t.Errorf("Expected observed tunnel to stop, got %t %v", stopped, err)
+	}
+
+	if calls != 0 {
+		t.Errorf("Expected cloudflared to never be run, got %d commands", calls)
+	}
+
+	if exists, _ := afero.Exists(fs, tunnel.Service.ConfigFilePath()); exists {
+		t.Error("Expected no config file for an observed tunnel")
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	VaultCertificatePath = "/var/run/hera/certs"
+	vaultTimeout         = 10 * time.Second
+
+	// vaultTokenMargin is how long before it expires an AppRole token is replaced
+	vaultTokenMargin = 30 * time.Second
+)
+
+var errVaultNotFound = errors.New("Not found in Vault")
+
+// TunnelCredentialSource provides the tokens named tunnels are run with
+type TunnelCredentialSource interface {
+	// TunnelToken returns the token of the named tunnel, or an empty token if the source has none
+	TunnelToken(name string) (string, error)
+}
+
+// VaultSource provides certificates stored in a HashiCorp Vault KV version 2 secrets engine. Each secret
+// under Path is a certificate named after the secret, with the PEM contents in its "cert" field.
+// Certificates are written to VaultCertificatePath for cloudflared and cached for CacheTTL. The tokens
+// of named tunnels are read from the "token" field of the secrets under Path/tunnels.
+type VaultSource struct {
+	Address  string
+	Path     string
+	Token    string
+	RoleID   string
+	SecretID string
+	CacheTTL time.Duration
+
+	client  *http.Client
+	mu      sync.Mutex
+	certs   []*Certificate
+	fetched time.Time
+	tokens  map[string]*vaultTunnelToken
+
+	// loginToken and loginExpires hold the token of the last AppRole login
+	loginToken   string
+	loginExpires time.Time
+}
+
+// vaultTunnelToken is a cached tunnel token
+type vaultTunnelToken struct {
+	token   string
+	fetched time.Time
+}
+
+// NewVaultSource returns a VaultSource for the secrets under the path of the Vault server at the address
+func NewVaultSource(address string, path string) *VaultSource {
+	source := &VaultSource{
+		Address:  strings.TrimSuffix(address, "/"),
+		Path:     strings.Trim(path, "/"),
+		CacheTTL: 5 * time.Minute,
+		client:   &http.Client{Timeout: vaultTimeout},
+		tokens:   make(map[string]*vaultTunnelToken),
+	}
+
+	return source
+}
+
+// Certificates returns the certificates stored in Vault. The cached certificates are returned if they
+// are younger than CacheTTL, or if Vault cannot be reached.
+func (v *VaultSource) Certificates(fs afero.Fs) ([]*Certificate, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.certs != nil && time.Since(v.fetched) < v.CacheTTL {
+		return v.certs, nil
+	}
+
+	certs, err := v.fetch(fs)
+	if err != nil {
+		v.loginToken = ""
+
+		if v.certs != nil {
+			log.Warningf("Unable to refresh certificates from Vault, using cached certificates: %s", err)
+			return v.certs, nil
+		}
+
+		return nil, err
+	}
+
+	v.certs = certs
+	v.fetched = time.Now()
+
+	return certs, nil
+}
+
+// fetch reads all certificates from Vault and writes them to VaultCertificatePath
+func (v *VaultSource) fetch(fs afero.Fs) ([]*Certificate, error) {
+	token, err := v.login()
+	if err != nil {
+		return nil, err
+	}
+
+	mount, path := v.mountPath()
+
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+
+	err = v.request("GET", fmt.Sprintf("/v1/%s/metadata/%s?list=true", mount, path), token, nil, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.MkdirAll(VaultCertificatePath, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*Certificate
+	for _, key := range list.Data.Keys {
+		// Keys ending in a slash are folders rather than secrets
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		var secret struct {
+			Data struct {
+				Data map[string]string `json:"data"`
+			} `json:"data"`
+		}
+
+		err := v.request("GET", fmt.Sprintf("/v1/%s/data/%s", mount, strings.TrimPrefix(path+"/"+key, "/")), token, nil, &secret)
+		if err != nil {
+			return nil, err
+		}
+
+		pem := secret.Data.Data["cert"]
+		if pem == "" {
+			log.Warningf("Vault secret %s has no cert field, skipping", key)
+			continue
+		}
+
+		cert := NewCertificate(strings.TrimSuffix(key, ".pem")+".pem", fs)
+		cert.Dir = VaultCertificatePath
+
+		err = afero.WriteFile(fs, cert.FullPath(), []byte(pem), 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// TunnelToken returns the token of the named tunnel from the "token" field of the secret named after
+// it under Path/tunnels, or an empty token if there is no such secret. Tokens are cached for CacheTTL.
+func (v *VaultSource) TunnelToken(name string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if cached := v.tokens[name]; cached != nil && time.Since(cached.fetched) < v.CacheTTL {
+		return cached.token, nil
+	}
+
+	token, err := v.fetchTunnelToken(name)
+	if err != nil {
+		v.loginToken = ""
+
+		if cached := v.tokens[name]; cached != nil {
+			log.Warningf("Unable to refresh the token of tunnel %s from Vault, using cached token: %s", name, err)
+			return cached.token, nil
+		}
+
+		return "", err
+	}
+
+	v.tokens[name] = &vaultTunnelToken{token: token, fetched: time.Now()}
+
+	return token, nil
+}
+
+// fetchTunnelToken reads the token of the named tunnel from Vault
+func (v *VaultSource) fetchTunnelToken(name string) (string, error) {
+	token, err := v.login()
+	if err != nil {
+		return "", err
+	}
+
+	mount, path := v.mountPath()
+
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+
+	err = v.request("GET", fmt.Sprintf("/v1/%s/data/%s", mount, strings.TrimPrefix(path+"/tunnels/"+name, "/")), token, nil, &secret)
+	if err == errVaultNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return secret.Data.Data["token"], nil
+}
+
+// mountPath returns the mount of the secrets engine and the path of the secrets within it
+func (v *VaultSource) mountPath() (string, string) {
+	if parts := strings.SplitN(v.Path, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+
+	return v.Path, ""
+}
+
+// login returns the configured token, or a token from logging in with the AppRole credentials. The
+// AppRole token is reused until shortly before its lease expires.
+func (v *VaultSource) login() (string, error) {
+	if v.Token != "" {
+		return v.Token, nil
+	}
+
+	if v.RoleID == "" {
+		return "", fmt.Errorf("No Vault token or AppRole role ID configured")
+	}
+
+	if v.loginToken != "" && (v.loginExpires.IsZero() || time.Now().Before(v.loginExpires)) {
+		return v.loginToken, nil
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+
+	body := map[string]string{"role_id": v.RoleID, "secret_id": v.SecretID}
+
+	err := v.request("POST", "/v1/auth/approle/login", "", body, &login)
+	if err != nil {
+		return "", err
+	}
+
+	v.loginToken = login.Auth.ClientToken
+	v.loginExpires = time.Time{}
+
+	// A lease duration of zero means the token does not expire
+	if login.Auth.LeaseDuration > 0 {
+		v.loginExpires = time.Now().Add(time.Duration(login.Auth.LeaseDuration)*time.Second - vaultTokenMargin)
+	}
+
+	return v.loginToken, nil
+}
+
+// request sends a request to the Vault API and decodes the JSON response into result
+func (v *VaultSource) request(method string, path string, token string, body interface{}, result interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.Address+path, &payload)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to reach Vault: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errVaultNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response from Vault for %s: %s", strings.Split(path, "?")[0], resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// newCertificateSource returns the certificate source selected by the config
+func newCertificateSource(c *Config) (CertificateSource, error) {
+	switch c.CertificateSource {
+	case "", "directory":
+		return &DirectorySource{Path: CertificatePath}, nil
+
+	case "vault":
+		if c.VaultAddress == "" || c.VaultPath == "" {
+			return nil, fmt.Errorf("HERA_VAULT_ADDR and HERA_VAULT_PATH are required for the vault certificate source")
+		}
+
+		source := NewVaultSource(c.VaultAddress, c.VaultPath)
+		source.Token = c.VaultToken
+		source.RoleID = c.VaultRoleID
+		source.SecretID = c.VaultSecretID
+		if c.VaultCacheTTL > 0 {
+			source.CacheTTL = c.VaultCacheTTL
+		}
+
+		return source, nil
+	}
+
+	return nil, fmt.Errorf("Unknown certificate source: %s", c.CertificateSource)
+}
+
+// firstEnv returns the value of the first set environment variable
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}